@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"OpnLaaS.cyber.unh.edu/database"
+)
+
+func registerAuditRoutes() {
+	// Latest audit entries, optionally for a single target
+	http.HandleFunc("/api/audit", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		limit := 100
+
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := database.ListAudit(r.URL.Query().Get("target"), limit)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, entries)
+	})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func registerBIOSRoutes() {
+	// Named BIOS attribute profiles
+	http.HandleFunc("/api/bios/profiles", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		profiles, err := database.ListBIOSProfiles()
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, profiles)
+	})
+
+	// PUT creates or replaces a profile with {"description", "attributes"},
+	// where attributes are named as in the BMC's Bios resource, e.g.
+	// {"ProcVirtualization": "Enabled", "SriovGlobalEnable": "Enabled"}
+	http.HandleFunc("/api/bios/profiles/{name}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		switch r.Method {
+		case "GET":
+			profile, err := database.GetBIOSProfile(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if profile == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(profile.JSON())
+		case "PUT":
+			obj := struct {
+				Description string                 `json:"description"`
+				Attributes  map[string]interface{} `json:"attributes"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if !lib.IsProfileNameValid(name) || len(obj.Description) > 256 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			profile, err := database.SetBIOSProfile(name, obj.Description, obj.Attributes, currentUser(r))
+
+			switch err {
+			case nil:
+			case database.ErrBIOSProfileAttributes:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "bios.profile", name, fmt.Sprintf("%d attribute(s)", len(profile.Attributes))); err != nil {
+				lib.Log.Error("Could not record BIOS profile: " + err.Error())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(profile.JSON())
+		case "DELETE":
+			if err := database.DeleteBIOSProfile(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "bios.profile_delete", name, ""); err != nil {
+				lib.Log.Error("Could not record BIOS profile removal: " + err.Error())
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Every host whose BIOS, as of its last hardware poll, differs from the
+	// profile, with the attributes that differ
+	http.HandleFunc("/api/bios/profiles/{name}/drift", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		profile, err := database.GetBIOSProfile(r.PathValue("name"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if profile == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		hosts, err := database.ListHostBIOS()
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		type hostDrift struct {
+			HostName string                `json:"host_name"`
+			Drift    []*database.BIOSDrift `json:"drift"`
+		}
+
+		drifted := []*hostDrift{}
+
+		for _, host := range hosts {
+			if drift := profile.Drift(host.Attributes); len(drift) > 0 {
+				drifted = append(drifted, &hostDrift{host.HostName, drift})
+			}
+		}
+
+		writeJSON(w, drifted)
+	})
+
+	// The host's BIOS attributes as of the last hardware poll and the last
+	// profile applied to it. With ?profile=, the attributes that differ from
+	// that profile are listed as well.
+	http.HandleFunc("/api/hosts/{name}/bios", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		bios, err := database.GetHostBIOS(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		apply, err := database.GetHostBIOSApply(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		obj := map[string]interface{}{"bios": bios, "apply": apply}
+
+		if profileName := r.URL.Query().Get("profile"); profileName != "" {
+			profile, err := database.GetBIOSProfile(profileName)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if profile == nil || bios == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			obj["drift"] = profile.Drift(bios.Attributes)
+		}
+
+		writeJSON(w, obj)
+	})
+
+	// Apply a profile with {"profile"}. The host is reset for the settings to
+	// take, and the apply is followed on GET /api/hosts/{name}/bios.
+	http.HandleFunc("/api/hosts/{name}/bios/apply", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		obj := struct {
+			Profile string `json:"profile"`
+		}{}
+
+		if !readJSON(w, r, &obj) {
+			return
+		}
+
+		profile, err := database.GetBIOSProfile(obj.Profile)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if profile == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		apply, err := host.ApplyBIOSProfile(profile, false, currentUser(r))
+
+		switch err {
+		case nil:
+		case database.ErrBIOSApplyBusy:
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.Audit(currentUser(r), "bios.apply", name, profile.Name); err != nil {
+			lib.Log.Error("Could not record BIOS profile apply: " + err.Error())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(apply.JSON())
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+	"github.com/gorilla/websocket"
+)
+
+var consoleUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     consoleOriginAllowed,
+}
+
+// consoleOriginAllowed keeps other sites from opening consoles with the
+// user's cookies. WebSockets aren't subject to CORS, so unlike the rest of
+// the API the origin has to be checked here. Only FRONTEND_URL may, or the
+// server itself when it isn't set. Clients that aren't browsers send no
+// origin.
+func consoleOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	if lib.Config.FrontendURL == "" {
+		return strings.EqualFold(u.Host, r.Host)
+	}
+
+	frontend, err := url.Parse(lib.Config.FrontendURL)
+
+	return err == nil && strings.EqualFold(u.Scheme, frontend.Scheme) && strings.EqualFold(u.Host, frontend.Host)
+}
+
+func registerConsoleRoutes() {
+	// The host's serial console as a WebSocket. Binary or text messages are
+	// typed into the console and its output comes back as binary messages.
+	// The user never sees the BMC's credentials, and every session is
+	// recorded.
+	http.HandleFunc("/api/hosts/{name}/console", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !websocket.IsWebSocketUpgrade(r) {
+			w.WriteHeader(http.StatusUpgradeRequired)
+			return
+		}
+
+		// Checked again by the upgrade, but before the BMC is logged in to
+		if !consoleOriginAllowed(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		// The console is opened first so that failures get a proper status
+		console, err := host.OpenConsole(currentUser(r))
+
+		switch {
+		case err == nil:
+		case errors.Is(err, database.ErrConsoleBusy):
+			w.WriteHeader(http.StatusConflict)
+			return
+		case errors.Is(err, redfish.ErrConsoleUnsupported):
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		case errors.Is(err, database.ErrConsoleHostKeyChanged):
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			lib.Log.Warning(fmt.Sprintf("Could not open console of host %s: %s", name, err.Error()))
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		defer console.Close()
+
+		conn, err := consoleUpgrader.Upgrade(w, r, nil)
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		if err := database.Audit(currentUser(r), "console.open", name, fmt.Sprintf("session %d", console.ID)); err != nil {
+			lib.Log.Error("Could not record console session: " + err.Error())
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Console of host %s opened by %s", name, currentUser(r)))
+
+		go func() {
+			buf := make([]byte, 4096)
+
+			for {
+				n, err := console.Read(buf)
+
+				if n > 0 {
+					if writeErr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); writeErr != nil {
+						break
+					}
+				}
+
+				if err != nil {
+					break
+				}
+			}
+
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "console closed"), time.Now().Add(time.Second))
+			conn.Close()
+		}()
+
+		for {
+			_, data, err := conn.ReadMessage()
+
+			if err != nil {
+				break
+			}
+
+			if _, err := console.Write(data); err != nil {
+				break
+			}
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Console of host %s closed by %s", name, currentUser(r)))
+	})
+
+	// Recorded console sessions of a host
+	http.HandleFunc("/api/hosts/{name}/console/sessions", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		sessions, err := database.ListConsoleSessions(r.PathValue("name"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, sessions)
+	})
+
+	// The recording of a console session, as an asciicast file
+	http.HandleFunc("/api/hosts/{name}/console/sessions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		session, err := database.GetConsoleSession(id)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if session == nil || session.HostName != r.PathValue("name") || session.Recording == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-asciicast")
+		http.ServeFile(w, r, session.Recording)
+	})
+
+	// Forget the SSH host key pinned for the host's BMC, after an admin has
+	// made sure the BMC was replaced or reset on purpose
+	http.HandleFunc("/api/hosts/{name}/console/host-key", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := database.ResetHostSSHKey(name); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.Audit(currentUser(r), "console.host_key_reset", name, ""); err != nil {
+			lib.Log.Error("Could not record SSH host key reset: " + err.Error())
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func createUser(t *testing.T, email string, privilege int) {
+	t.Helper()
+
+	if _, err := database.CreateUser(email, "Test", "User", ""); err != nil && err != database.ErrUserExists {
+		t.Fatal(err)
+	}
+
+	if err := database.UpdateUserPrivilege(email, privilege); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openConsole asks for the console as email, without logging in when email
+// is empty. Only WebSocket upgrades get as far as the origin check.
+func openConsole(t *testing.T, url, email, origin string, upgrade bool) int {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", url, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email != "" {
+		req.AddCookie(&http.Cookie{Name: "email", Value: email})
+		req.AddCookie(&http.Cookie{Name: "token", Value: TokenFor(email)})
+	}
+
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+
+	if upgrade {
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestConsoleAccess(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "console-access-1", "90:B1:1C:00:01:01")
+
+	createUser(t, "user@example.com", database.UserPrivilegeBasic)
+	createUser(t, "other@example.com", database.UserPrivilegeBasic)
+	createUser(t, "admin@example.com", database.UserPrivilegeAdmin)
+
+	if status := request(t, "POST", server.URL+"/api/hosts/console-access-1/users", "admin@example.com", `{"email": "user@example.com"}`); status != http.StatusNoContent {
+		t.Fatalf("assign: status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	url := server.URL + "/api/hosts/console-access-1/console"
+
+	tests := []struct {
+		email string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"other@example.com", http.StatusForbidden},
+
+		// Past the access check, plain requests are turned away
+		{"user@example.com", http.StatusUpgradeRequired},
+		{"admin@example.com", http.StatusUpgradeRequired},
+	}
+
+	for _, test := range tests {
+		if status := openConsole(t, url, test.email, "", false); status != test.want {
+			t.Errorf("%q: status = %d, want %d", test.email, status, test.want)
+		}
+	}
+
+	// Another site can't use the holder's cookies
+	if status := openConsole(t, url, "user@example.com", "https://evil.example.net", true); status != http.StatusForbidden {
+		t.Errorf("cross-site: status = %d, want %d", status, http.StatusForbidden)
+	}
+}
+
+func TestConsoleOrigin(t *testing.T) {
+	defer func(frontend string) { lib.Config.FrontendURL = frontend }(lib.Config.FrontendURL)
+
+	tests := []struct {
+		frontend string
+		origin   string
+		want     bool
+	}{
+		{"", "", true},
+		{"", "http://coordinator.example.com:8090", true},
+		{"", "https://evil.example.net", false},
+		{"https://laas.example.com", "https://laas.example.com", true},
+		{"https://laas.example.com/", "https://LAAS.example.com", true},
+		{"https://laas.example.com", "http://laas.example.com", false},
+		{"https://laas.example.com", "https://laas.example.com.evil.example.net", false},
+		{"https://laas.example.com", "http://coordinator.example.com:8090", false},
+		{"https://laas.example.com", "null", false},
+	}
+
+	for _, test := range tests {
+		lib.Config.FrontendURL = test.frontend
+
+		r := httptest.NewRequest("GET", "http://coordinator.example.com:8090/api/hosts/h1/console", nil)
+
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+
+		if got := consoleOriginAllowed(r); got != test.want {
+			t.Errorf("origin %q with frontend %q = %t, want %t", test.origin, test.frontend, got, test.want)
+		}
+	}
+}
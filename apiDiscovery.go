@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func registerDiscoveryRoutes() {
+	// POST starts scanning an IPv4 range for BMCs with {"cidr", "port"}. The
+	// port defaults to DISCOVERY_PORT.
+	http.HandleFunc("/api/discovery", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			discoveries, err := database.ListDiscoveries()
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, discoveries)
+		case "POST":
+			obj := struct {
+				CIDR string `json:"cidr"`
+				Port int    `json:"port"`
+			}{Port: lib.Config.DiscoveryPort}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.Port < 1 || obj.Port > 65535 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			discovery, err := database.StartDiscovery(obj.CIDR, obj.Port, currentUser(r))
+
+			switch err {
+			case nil:
+			case database.ErrDiscoveryCIDR, database.ErrDiscoveryTooLarge:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "discovery.start", obj.CIDR, fmt.Sprintf("port %d", obj.Port)); err != nil {
+				lib.Log.Error("Could not record discovery: " + err.Error())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(discovery.JSON())
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// A discovery and the BMCs it has found so far, with the host each is
+	// registered to
+	http.HandleFunc("/api/discovery/{id}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		discovery, ok := discoveryFromPath(w, r)
+
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(discovery.JSON())
+	})
+
+	// Create hosts for discovered BMCs. The body lists them like a YAML
+	// import: {"hosts": [{"name", "address", "username", "password",
+	// "labels"}]}.
+	http.HandleFunc("/api/discovery/{id}/adopt", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		discovery, ok := discoveryFromPath(w, r)
+
+		if !ok {
+			return
+		}
+
+		obj := struct {
+			Hosts []*database.HostImportRow `json:"hosts"`
+		}{}
+
+		if !readJSON(w, r, &obj) {
+			return
+		}
+
+		results := database.AdoptDiscoveredBMCs(discovery, obj.Hosts)
+		created := 0
+
+		for _, result := range results {
+			if result.Status == database.HostImportCreated {
+				created++
+
+				if err := database.Audit(currentUser(r), "discovery.adopt", result.Name, fmt.Sprintf("discovery %d", discovery.ID)); err != nil {
+					lib.Log.Error("Could not record adoption: " + err.Error())
+				}
+			}
+		}
+
+		lib.Log.Basic(fmt.Sprintf("%d host(s) adopted from discovery %d by %s", created, discovery.ID, currentUser(r)))
+
+		writeJSON(w, map[string]interface{}{
+			"created": created,
+			"rows":    results,
+		})
+	})
+}
+
+func discoveryFromPath(w http.ResponseWriter, r *http.Request) (*database.DBDiscovery, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	discovery, err := database.GetDiscovery(id)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if discovery == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	return discovery, true
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+const maxEventBytes = 1 << 20
+
+// fromBMC checks that a request came from the address the host's BMC is
+// reached at
+func fromBMC(r *http.Request, host *database.DBHost) bool {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return false
+	}
+
+	address := host.IPMI.Address
+
+	if bmc, _, err := net.SplitHostPort(address); err == nil {
+		address = bmc
+	}
+
+	ips, err := net.LookupHost(address)
+
+	if err != nil {
+		return false
+	}
+
+	for _, ip := range ips {
+		if net.ParseIP(ip).Equal(net.ParseIP(remote)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func registerEventRoutes() {
+	// Where BMCs send their events. BMCs can't log in, so the token in the
+	// path is what identifies and authenticates them.
+	http.HandleFunc("/events/{token}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		subscription, err := database.GetHostEventSubscriptionByToken(r.PathValue("token"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if subscription == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		host, err := database.GetHost(subscription.HostName)
+
+		if err != nil || host == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !fromBMC(r, host) {
+			lib.Log.Warning(fmt.Sprintf("Rejected event for host %s from %s", host.Name, r.RemoteAddr))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var event redfish.Event
+
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventBytes)).Decode(&event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := database.ReceiveHostEvents(subscription, &event); err != nil {
+			if err == database.ErrEventContextMismatch {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Whether a host's BMC pushes its events
+	http.HandleFunc("/api/hosts/{name}/events/subscription", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		subscription, err := database.GetHostEventSubscription(r.PathValue("name"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if subscription == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(subscription.JSON())
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/database"
+)
+
+// subscribeHost makes a host whose BMC has subscribed to send its events
+// with token
+func subscribeHost(t *testing.T, name, address, token string) {
+	t.Helper()
+
+	if _, err := database.CreateHost(name, database.HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, address, "root", "calvin", database.HostRedfishVersion_Dell_iDRAC_9); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { database.DeleteHost(name) })
+
+	if err := database.QueuedExec(database.UPSERT_HOST_EVENT_SUBSCRIPTION_STATEMENT, name, token, "/redfish/v1/EventService/Subscriptions/1", database.EventSubscriptionActive, "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Events the BMC pushes are kept with the host's event logs
+func TestReceiveEvents(t *testing.T) {
+	server := testServer(t)
+
+	// The test server is reached from loopback, like the BMC would be
+	subscribeHost(t, "events-1", "127.0.0.1", "0123456789abcdef0123456789abcd01")
+	subscribeHost(t, "events-2", "192.0.2.1", "0123456789abcdef0123456789abcd02")
+
+	url := server.URL + "/events/0123456789abcdef0123456789abcd01"
+
+	events := `{"Context": "OpnLaaS events-1", "Events": [
+		{"EventType": "Alert", "EventId": "8899", "EventTimestamp": "` + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339) + `", "MessageSeverity": "Critical", "Message": "The power input for power supply 1 is lost.", "MessageId": "PSU0003"},
+		{"EventType": "StatusChange", "Severity": "Warning", "Message": "Fan 1 RPM is less than the lower warning threshold.", "MessageId": "FAN0001"}
+	]}`
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+		want   int
+	}{
+		{"unknown token", "POST", server.URL + "/events/ffffffffffffffffffffffffffffffff", events, http.StatusNotFound},
+		{"not a post", "GET", url, "", http.StatusMethodNotAllowed},
+		{"another address", "POST", server.URL + "/events/0123456789abcdef0123456789abcd02", `{"Context": "OpnLaaS events-2", "Events": []}`, http.StatusForbidden},
+		{"another context", "POST", url, `{"Context": "OpnLaaS events-2", "Events": []}`, http.StatusBadRequest},
+		{"not json", "POST", url, "events", http.StatusBadRequest},
+		{"events", "POST", url, events, http.StatusNoContent},
+	}
+
+	for _, test := range tests {
+		if status := request(t, test.method, test.url, "", test.body); status != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, status, test.want)
+		}
+	}
+
+	entries, err := database.ListHostEventLogs("events-1", database.HostEventLogFilter{Service: database.EventLogServicePushed, Limit: 100})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+
+	// The one without a timestamp was received just now, so it is newest
+	if entries[0].MessageID != "FAN0001" || entries[0].Severity != database.HostHealthDegraded || entries[0].EntryID == "" {
+		t.Errorf("entry = %+v", entries[0])
+	}
+
+	if entries[1].EntryID != "8899" || entries[1].Severity != database.HostHealthBad || entries[1].EntryType != "Alert" {
+		t.Errorf("entry = %+v", entries[1])
+	}
+
+	if subscription, err := database.GetHostEventSubscription("events-1"); err != nil {
+		t.Fatal(err)
+	} else if subscription.LastEventTime == nil {
+		t.Error("last event time wasn't recorded")
+	}
+
+	if entries, err := database.ListHostEventLogs("events-2", database.HostEventLogFilter{Limit: 100}); err != nil || len(entries) != 0 {
+		t.Errorf("events-2 entries = %d, %v", len(entries), err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func registerFirmwareRoutes() {
+	// Minimum firmware versions per system model. PUT sets one with
+	// {"model", "category", "version"}, where category is bios, bmc, nic or
+	// raid. DELETE takes the model and category as query parameters.
+	http.HandleFunc("/api/firmware/minimums", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			minimums, err := database.ListFirmwareMinimums()
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, minimums)
+		case "PUT":
+			obj := struct {
+				Model    string `json:"model"`
+				Category string `json:"category"`
+				Version  string `json:"version"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			minimum, err := database.SetFirmwareMinimum(obj.Model, obj.Category, obj.Version, currentUser(r))
+
+			switch err {
+			case nil:
+			case database.ErrFirmwareMinimum:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "firmware.minimum", minimum.Model, minimum.Category+" "+minimum.Version); err != nil {
+				lib.Log.Error("Could not record firmware minimum: " + err.Error())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(minimum.JSON())
+		case "DELETE":
+			model, category := r.URL.Query().Get("model"), r.URL.Query().Get("category")
+
+			switch err := database.DeleteFirmwareMinimum(model, category); err {
+			case nil:
+			case database.ErrFirmwareMinimumNotFound:
+				w.WriteHeader(http.StatusNotFound)
+				return
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "firmware.minimum_delete", model, category); err != nil {
+				lib.Log.Error("Could not record firmware minimum removal: " + err.Error())
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Hosts running firmware older than the minimum for their model, with
+	// only the outdated firmware listed
+	http.HandleFunc("/api/firmware/outdated", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		hosts, err := database.ListOutdatedHosts()
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, hosts)
+	})
+
+	// POST has the BMCs of the listed hosts install a firmware image:
+	// {"image_uri", "hosts", "batch_size", "max_failures"}. Hosts are
+	// updated batch_size at a time, and the update stops once more than
+	// max_failures hosts have failed.
+	http.HandleFunc("/api/firmware/updates", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			updates, err := database.ListFirmwareUpdates()
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, updates)
+		case "POST":
+			obj := struct {
+				ImageURI    string   `json:"image_uri"`
+				Hosts       []string `json:"hosts"`
+				BatchSize   int      `json:"batch_size"`
+				MaxFailures int      `json:"max_failures"`
+			}{BatchSize: 1}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if !lib.IsImageURLValid(obj.ImageURI) || obj.BatchSize < 1 || obj.MaxFailures < 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			update, err := database.StartFirmwareUpdate(obj.ImageURI, obj.Hosts, obj.BatchSize, obj.MaxFailures, currentUser(r))
+
+			switch err {
+			case nil:
+			case database.ErrFirmwareUpdateHosts:
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			case database.ErrFirmwareUpdateBusy:
+				w.WriteHeader(http.StatusConflict)
+				return
+			default:
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "firmware.update", obj.ImageURI, fmt.Sprintf("update %d, %d host(s)", update.ID, len(obj.Hosts))); err != nil {
+				lib.Log.Error("Could not record firmware update: " + err.Error())
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(update.JSON())
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// A firmware update with the progress of each of its hosts
+	http.HandleFunc("/api/firmware/updates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		update, ok := firmwareUpdateFromPath(w, r)
+
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(update.JSON())
+	})
+
+	// Stop a firmware update from starting any more batches
+	http.HandleFunc("/api/firmware/updates/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		update, ok := firmwareUpdateFromPath(w, r)
+
+		if !ok {
+			return
+		}
+
+		if err := database.CancelFirmwareUpdate(update); err != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		if err := database.Audit(currentUser(r), "firmware.update_cancel", update.ImageURI, fmt.Sprintf("update %d", update.ID)); err != nil {
+			lib.Log.Error("Could not record firmware update cancellation: " + err.Error())
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func firmwareUpdateFromPath(w http.ResponseWriter, r *http.Request) (*database.DBFirmwareUpdate, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, false
+	}
+
+	update, err := database.GetFirmwareUpdate(id)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if update == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, false
+	}
+
+	return update, true
+}
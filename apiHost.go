@@ -0,0 +1,1360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// A missing redfish_version is detected from the BMC
+type hostIPMIRequest struct {
+	Address        string `json:"address"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	RedfishVersion *int   `json:"redfish_version"`
+}
+
+func (i *hostIPMIRequest) Valid() bool {
+	return lib.IsIPMIAddressValid(i.Address) && i.Username != "" && i.Password != "" && (i.RedfishVersion == nil || database.IsRedfishVersionValid(*i.RedfishVersion))
+}
+
+// detect fills in the Redfish version from the BMC if it wasn't given. The
+// BMC info is returned when detection happened so it can be stored.
+func (i *hostIPMIRequest) detect() (redfish.Driver, *redfish.BMCInfo, error) {
+	if i.RedfishVersion != nil {
+		return nil, nil, nil
+	}
+
+	version, driver, info, err := database.DetectBMC(i.Address, i.Username, i.Password, "")
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	i.RedfishVersion = &version
+	return driver, info, nil
+}
+
+const maxTelemetryPoints = 10000
+const maxHostImportBytes = 1 << 20
+
+// withHostAccess checks that the user may operate the host, which admins and
+// the users it is assigned to can, see database.HostUsers
+func withHostAccess(w http.ResponseWriter, r *http.Request, name string) bool {
+	if !withAuth(w, r) {
+		return false
+	}
+
+	if isAdmin(r) {
+		return true
+	}
+
+	users, err := database.HostUsers(name)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	if !slices.Contains(users, currentUser(r)) {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// lookupHost writes the appropriate status if the host can't be returned
+func lookupHost(w http.ResponseWriter, name string) *database.DBHost {
+	host, err := database.GetHost(name)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil
+	}
+
+	if host == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil
+	}
+
+	return host
+}
+
+func registerHostRoutes() {
+	// List and create hosts
+	http.HandleFunc("/api/hosts", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			search, ok := parseHostSearch(r)
+
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			// Only admins see hosts that are out of service
+			search.Available = search.Available || !isAdmin(r)
+
+			hosts, err := database.SearchHosts(search)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, hosts)
+		case "POST":
+			obj := struct {
+				database.DBHost
+				IPMI hostIPMIRequest `json:"ipmi"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if !lib.IsHostNameValid(obj.Name) || !obj.IPMI.Valid() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if database.HostExists(obj.Name) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			driver, info, err := obj.IPMI.detect()
+
+			if err != nil {
+				lib.Log.Warning(fmt.Sprintf("Could not detect BMC for host %s: %s", obj.Name, err.Error()))
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			hw := obj.Hardware
+			host, err := database.CreateHost(obj.Name, database.HostHealthUnknown, hw.CPU.Count, hw.CPU.SpeedMHz, hw.CPU.Cores, hw.Memory.SizeMiB, hw.Memory.SpeedMHz, hw.VirtualStorageSizeMiB, obj.Networking.Provider, obj.Networking.SpeedMbps, obj.IPMI.Address, obj.IPMI.Username, obj.IPMI.Password, *obj.IPMI.RedfishVersion)
+
+			if err != nil {
+				if err == database.ErrHostExists {
+					w.WriteHeader(http.StatusConflict)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(host.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("Host %s created", host.Name))
+
+			if info != nil {
+				if err := database.SetHostBMC(host.Name, driver, info); err != nil {
+					lib.Log.Error(fmt.Sprintf("Could not store BMC details for host %s: %s", host.Name, err.Error()))
+				}
+
+				if err := database.PinHostCertificate(host.Name, info.CertificateFingerprint); err != nil {
+					lib.Log.Error(fmt.Sprintf("Could not pin certificate of host %s: %s", host.Name, err.Error()))
+				}
+			}
+
+			if err := database.PollHostNow(host.Name); err != nil {
+				lib.Log.Warning(fmt.Sprintf("Could not queue first poll for host %s: %s", host.Name, err.Error()))
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Create many hosts at once from a CSV or YAML inventory file, given as
+	// the body. With dry_run, rows are only validated and their BMCs probed.
+	http.HandleFunc("/api/import/hosts", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if r.Header.Get("Content-Type") != "text/plain" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		query := r.URL.Query()
+		format := query.Get("format")
+
+		if format == "" {
+			format = database.HostImportFormatCSV
+		}
+
+		dryRun, err := strconv.ParseBool(query.Get("dry_run"))
+
+		if err != nil && query.Get("dry_run") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHostImportBytes))
+
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		rows, err := database.ParseHostImport(data, format)
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		results := database.ImportHosts(rows, dryRun)
+		created := 0
+
+		for _, result := range results {
+			if result.Status == database.HostImportCreated {
+				created++
+			}
+		}
+
+		if created > 0 {
+			if err := database.Audit(currentUser(r), "host.import", "", fmt.Sprintf("%d of %d host(s) created", created, len(results))); err != nil {
+				lib.Log.Error("Could not record host import: " + err.Error())
+			}
+
+			lib.Log.Basic(fmt.Sprintf("%d host(s) imported by %s", created, currentUser(r)))
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"dry_run": dryRun,
+			"created": created,
+			"rows":    results,
+		})
+	})
+
+	// Read, update and delete a single host
+	http.HandleFunc("/api/hosts/{name}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			labels, err := database.GetHostLabels(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			host.Labels = labels
+			host.Maintenance, err = database.GetHostMaintenance(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(host.JSON())
+		case "PATCH":
+			// Decode over the current values so that omitted fields are kept.
+			// Credentials are stored encrypted, so they are only filled in
+			// after decoding if they weren't changed.
+			obj := struct {
+				*database.DBHost
+				IPMI hostIPMIRequest `json:"ipmi"`
+			}{
+				DBHost: host,
+				IPMI: hostIPMIRequest{
+					Address:        host.IPMI.Address,
+					RedfishVersion: &host.IPMI.RedfishVersion,
+				},
+			}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.IPMI.Username == "" || obj.IPMI.Password == "" {
+				username, password, err := host.Credentials()
+
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if obj.IPMI.Username == "" {
+					obj.IPMI.Username = username
+				}
+
+				if obj.IPMI.Password == "" {
+					obj.IPMI.Password = password
+				}
+			}
+
+			if !obj.IPMI.Valid() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			driver, info, err := obj.IPMI.detect()
+
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			if info != nil {
+				if err := database.SetHostBMC(name, driver, info); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+
+			hw := host.Hardware
+
+			if err := database.UpdateHostSpecs(name, hw.CPU.Count, hw.CPU.SpeedMHz, hw.CPU.Cores, hw.Memory.SizeMiB, hw.Memory.SpeedMHz, hw.VirtualStorageSizeMiB); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.UpdateHostNetworking(name, host.Networking.Provider, host.Networking.SpeedMbps); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.UpdateHostIPMI(name, obj.IPMI.Address, obj.IPMI.Username, obj.IPMI.Password, *obj.IPMI.RedfishVersion); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			// A BMC at a new address has a certificate of its own
+			if obj.IPMI.Address != host.IPMI.Address {
+				if err := database.ResetHostCertificate(name); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if info != nil {
+					if err := database.PinHostCertificate(name, info.CertificateFingerprint); err != nil {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
+					}
+				}
+			}
+
+			if host = lookupHost(w, name); host == nil {
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(host.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("Host %s updated", name))
+		case "DELETE":
+			// The BMC may be gone for good, so this is only best effort
+			if err := host.Unsubscribe(); err != nil {
+				lib.Log.Warning(fmt.Sprintf("Could not remove event subscription of host %s: %s", name, err.Error()))
+			}
+
+			if err := database.DeleteHost(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+
+			lib.Log.Basic(fmt.Sprintf("Host %s deleted", name))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Labels of a host. PUT replaces them all, PATCH sets the ones given and
+	// removes those set to null.
+	http.HandleFunc("/api/hosts/{name}/labels", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+		case "PUT", "PATCH":
+			changes := map[string]*string{}
+
+			if !readJSON(w, r, &changes) {
+				return
+			}
+
+			for key, value := range changes {
+				if !lib.IsLabelKeyValid(key) || value != nil && !lib.IsLabelValueValid(*value) || value == nil && r.Method == "PUT" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+
+			if err := database.UpdateHostLabels(name, changes, r.Method == "PUT"); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "labels.update", name, r.Method); err != nil {
+				lib.Log.Error("Could not record label update: " + err.Error())
+			}
+
+			lib.Log.Basic(fmt.Sprintf("Labels of host %s updated by %s", name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		labels, err := database.GetHostLabels(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, labels)
+	})
+
+	// Maintenance of a host. PUT takes the host out of service, or changes why
+	// it is, and DELETE puts it back. Its users are emailed either way.
+	http.HandleFunc("/api/hosts/{name}/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		maintenance, err := database.GetHostMaintenance(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			if maintenance == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(maintenance.JSON())
+		case "PUT":
+			obj := struct {
+				Reason         string     `json:"reason"`
+				ExpectedReturn *time.Time `json:"expected_return"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.Reason == "" || len(obj.Reason) > 256 || obj.ExpectedReturn != nil && obj.ExpectedReturn.Before(time.Now()) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			updated, err := database.SetHostMaintenance(name, obj.Reason, obj.ExpectedReturn, currentUser(r))
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "maintenance.start", name, obj.Reason); err != nil {
+				lib.Log.Error("Could not record maintenance: " + err.Error())
+			}
+
+			// Users only need to hear about it once
+			if maintenance == nil {
+				go database.NotifyHostMaintenance(name, updated)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(updated.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("Host %s put in maintenance by %s", name, currentUser(r)))
+		case "DELETE":
+			if maintenance == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			if err := database.EndHostMaintenance(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "maintenance.end", name, ""); err != nil {
+				lib.Log.Error("Could not record maintenance end: " + err.Error())
+			}
+
+			go database.NotifyHostMaintenance(name, nil)
+
+			w.WriteHeader(http.StatusNoContent)
+
+			lib.Log.Basic(fmt.Sprintf("Host %s returned to service by %s", name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// The users a host is assigned to, who may operate it. Admins assign a
+	// user with POST and take the host back with DELETE.
+	http.HandleFunc("/api/hosts/{name}/users", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			users, err := database.ListHostUsers(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, users)
+		case "POST":
+			obj := struct {
+				Email string `json:"email"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			email := strings.ToLower(obj.Email)
+
+			if !database.UserExists(email) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err := database.AssignHostUser(name, email, currentUser(r)); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "host.assign", name, email); err != nil {
+				lib.Log.Error("Could not record host assignment: " + err.Error())
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			lib.Log.Basic(fmt.Sprintf("Host %s assigned to %s by %s", name, email, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/hosts/{name}/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name, email := r.PathValue("name"), strings.ToLower(r.PathValue("email"))
+		found, err := database.UnassignHostUser(name, email)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := database.Audit(currentUser(r), "host.unassign", name, email); err != nil {
+			lib.Log.Error("Could not record host unassignment: " + err.Error())
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		lib.Log.Basic(fmt.Sprintf("Host %s taken back from %s by %s", name, email, currentUser(r)))
+	})
+
+	// Health of a host and its unhealthy components
+	http.HandleFunc("/api/hosts/{name}/health", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		host := lookupHost(w, r.PathValue("name"))
+
+		if host == nil {
+			return
+		}
+
+		components, err := database.GetHostHealthComponents(host.Name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"health":     host.Health,
+			"components": components,
+		})
+	})
+
+	// Poll status of a host, and polling it right away
+	http.HandleFunc("/api/hosts/{name}/poll", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			polls, err := database.GetHostPolls(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, polls)
+		case "POST":
+			if err := database.PollHostNow(name); err != nil {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+
+			lib.Log.Basic(fmt.Sprintf("Host %s queued for polling", name))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Power state of a host, and power actions through the BMC
+	http.HandleFunc("/api/hosts/{name}/power", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			status, err := host.PowerStatus()
+
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			writeJSON(w, status)
+		case "POST":
+			obj := struct {
+				Action string `json:"action"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if _, ok := redfish.PowerActions[obj.Action]; !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			resetType, err := host.Power(obj.Action)
+
+			detail := resetType
+
+			if err != nil {
+				detail = "failed: " + err.Error()
+			}
+
+			if auditErr := database.Audit(currentUser(r), "power."+obj.Action, name, detail); auditErr != nil {
+				lib.Log.Error("Could not record power action: " + auditErr.Error())
+			}
+
+			if errors.Is(err, redfish.ErrPowerActionUnsupported) {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			writeJSON(w, map[string]string{
+				"action":     obj.Action,
+				"reset_type": resetType,
+			})
+
+			lib.Log.Basic(fmt.Sprintf("User %s powered %s host %s (%s)", currentUser(r), obj.Action, name, resetType))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Virtual CD of a host. Users mount ISOs from the catalog and can have
+	// the host boot from it once.
+	http.HandleFunc("/api/hosts/{name}/media", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			status, err := host.MediaStatus()
+
+			if !writeBMCError(w, err) {
+				return
+			}
+
+			writeJSON(w, status)
+		case "POST":
+			obj := struct {
+				ISO  string `json:"iso"`
+				Boot bool   `json:"boot"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			iso, err := database.GetISO(obj.ISO)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if iso == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			err = host.InsertISO(iso, obj.Boot)
+			detail := iso.Name
+
+			if obj.Boot {
+				detail += ", boot once"
+			}
+
+			if err != nil {
+				detail += ", failed: " + err.Error()
+			}
+
+			if auditErr := database.Audit(currentUser(r), "media.insert", name, detail); auditErr != nil {
+				lib.Log.Error("Could not record media insert: " + auditErr.Error())
+			}
+
+			if !writeBMCError(w, err) {
+				return
+			}
+
+			status, err := host.MediaStatus()
+
+			if !writeBMCError(w, err) {
+				return
+			}
+
+			writeJSON(w, status)
+
+			lib.Log.Basic(fmt.Sprintf("User %s mounted ISO %s on host %s", currentUser(r), iso.Name, name))
+		case "DELETE":
+			err := host.EjectMedia()
+			detail := ""
+
+			if err != nil {
+				detail = "failed: " + err.Error()
+			}
+
+			if auditErr := database.Audit(currentUser(r), "media.eject", name, detail); auditErr != nil {
+				lib.Log.Error("Could not record media eject: " + auditErr.Error())
+			}
+
+			if !writeBMCError(w, err) {
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			lib.Log.Basic(fmt.Sprintf("User %s ejected media from host %s", currentUser(r), name))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// What was detected about a host's BMC
+	http.HandleFunc("/api/hosts/{name}/bmc", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		bmc, err := database.GetHostBMC(r.PathValue("name"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if bmc == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(bmc.JSON())
+	})
+
+	// The certificate the host's BMC is trusted with. PATCH sets a PEM CA
+	// bundle to trust instead of the pinned certificate, and an empty one
+	// goes back to the pin.
+	http.HandleFunc("/api/hosts/{name}/certificate", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+		case "PATCH":
+			obj := struct {
+				CABundle string `json:"ca_bundle"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if err := database.SetHostCABundle(name, obj.CABundle); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			detail := "cleared"
+
+			if obj.CABundle != "" {
+				detail = "set"
+			}
+
+			if err := database.Audit(currentUser(r), "certificate.ca_bundle", name, detail); err != nil {
+				lib.Log.Error("Could not record CA bundle change: " + err.Error())
+			}
+
+			lib.Log.Basic(fmt.Sprintf("CA bundle of host %s %s by %s", name, detail, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		certificate, err := database.GetHostCertificate(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if certificate == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(certificate.JSON())
+	})
+
+	// Trust the certificate the host's BMC presented in place of the pinned
+	// one, after an admin has made sure it was replaced on purpose
+	http.HandleFunc("/api/hosts/{name}/certificate/accept", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+		certificate, err := database.GetHostCertificate(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if certificate == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch err := database.AcceptHostCertificate(name); err {
+		case nil:
+		case database.ErrNoPendingCertificate:
+			w.WriteHeader(http.StatusConflict)
+			return
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.Audit(currentUser(r), "certificate.accept", name, certificate.PendingFingerprint); err != nil {
+			lib.Log.Error("Could not record certificate acceptance: " + err.Error())
+		}
+
+		lib.Log.Basic(fmt.Sprintf("New certificate of host %s accepted by %s", name, currentUser(r)))
+
+		if err := database.PollHostNow(name); err != nil {
+			lib.Log.Warning(fmt.Sprintf("Could not queue poll for host %s: %s", name, err.Error()))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Storage controllers, drives and volumes of a host
+	http.HandleFunc("/api/hosts/{name}/storage", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		storage, err := database.GetHostStorage(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(storage.JSON())
+	})
+
+	// The host's firmware as of the last hardware poll, each with the minimum
+	// version set for the host's model
+	http.HandleFunc("/api/hosts/{name}/firmware", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		firmware, err := database.GetHostFirmware(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, firmware)
+	})
+
+	// Hardware snapshots of a host, newest first
+	http.HandleFunc("/api/hosts/{name}/inventory/history", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		limit := 100
+
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		history, err := database.GetHostInventoryHistory(name, limit)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, history)
+	})
+
+	// Sensor readings of a host between from and to (RFC 3339, the last day by
+	// default), bucketed into steps
+	http.HandleFunc("/api/hosts/{name}/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		metric := query.Get("metric")
+
+		if metric != "" && !database.IsTelemetryMetricValid(metric) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		to, from := time.Now(), time.Time{}
+		var err error
+
+		if value := query.Get("to"); value != "" {
+			if to, err = time.Parse(time.RFC3339, value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		from = to.Add(-24 * time.Hour)
+
+		if value := query.Get("from"); value != "" {
+			if from, err = time.Parse(time.RFC3339, value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if !from.Before(to) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Around 300 points per series unless asked otherwise
+		step := max((to.Sub(from) / 300).Round(time.Minute), time.Minute)
+
+		if value := query.Get("step"); value != "" {
+			if step, err = time.ParseDuration(value); err != nil || step < time.Minute {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if to.Sub(from)/step > maxTelemetryPoints {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		series, err := database.GetHostTelemetry(name, metric, from, to, step)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, series)
+	})
+
+	// BMC event log entries of a host, newest first. severity is warning or
+	// critical to leave out less severe entries, since and until are RFC 3339
+	// times and search matches the message or message ID.
+	http.HandleFunc("/api/hosts/{name}/logs", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := database.HostEventLogFilter{
+			Service: query.Get("service"),
+			Search:  query.Get("search"),
+			Limit:   200,
+		}
+
+		switch query.Get("severity") {
+		case "":
+		case "warning":
+			filter.MinSeverity = database.HostHealthDegraded
+		case "critical":
+			filter.MinSeverity = database.HostHealthBad
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var err error
+
+		if value := query.Get("since"); value != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if value := query.Get("until"); value != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		if value := query.Get("limit"); value != "" {
+			if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := database.ListHostEventLogs(name, filter)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, entries)
+	})
+}
+
+// writeBMCError responds to a failed request to a host's BMC. Hosts whose
+// BMCs can't do what was asked are a conflict rather than a BMC failure.
+func writeBMCError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, redfish.ErrNoVirtualMedia), errors.Is(err, redfish.ErrBootTargetUnsupported), errors.Is(err, redfish.ErrPowerActionUnsupported):
+		w.WriteHeader(http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	return false
+}
+
+// parseHostSearch reads a host search from the query string. label can be
+// given more than once, as key=value or just key for any value. available
+// leaves out hosts in maintenance.
+func parseHostSearch(r *http.Request) (database.HostSearch, bool) {
+	query := r.URL.Query()
+	search := database.HostSearch{Health: -1}
+
+	for _, label := range query["label"] {
+		key, value, hasValue := strings.Cut(label, "=")
+
+		if !lib.IsLabelKeyValid(key) {
+			return search, false
+		}
+
+		search.Labels = append(search.Labels, database.HostLabelSelector{Key: key, Value: value, AnyValue: !hasValue})
+	}
+
+	for param, min := range map[string]*int{
+		"min_cores":        &search.MinCores,
+		"min_memory_mib":   &search.MinMemoryMiB,
+		"min_storage_mib":  &search.MinStorageMiB,
+		"min_network_mbps": &search.MinNetworkMbps,
+	} {
+		if value := query.Get(param); value != "" {
+			n, err := strconv.Atoi(value)
+
+			if err != nil || n < 0 {
+				return search, false
+			}
+
+			*min = n
+		}
+	}
+
+	if value := query.Get("available"); value != "" {
+		available, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return search, false
+		}
+
+		search.Available = available
+	}
+
+	if value := query.Get("health"); value != "" {
+		health, ok := database.HostHealthFromName(value)
+
+		if !ok {
+			return search, false
+		}
+
+		search.Health = health
+	}
+
+	return search, true
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/database"
+)
+
+// request sends body as email, without logging in when email is empty
+func request(t *testing.T, method, url, email, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "text/plain")
+
+	if email != "" {
+		req.AddCookie(&http.Cookie{Name: "email", Value: email})
+		req.AddCookie(&http.Cookie{Name: "token", Value: TokenFor(email)})
+	}
+
+	res, err := http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// A user can operate a host once an admin has assigned it to them, and no
+// longer once it is taken back
+func TestHostAssignment(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "assign-1", "90:B1:1C:00:02:01")
+
+	createUser(t, "assignee@example.com", database.UserPrivilegeBasic)
+	createUser(t, "admin@example.com", database.UserPrivilegeAdmin)
+
+	users := server.URL + "/api/hosts/assign-1/users"
+	power := server.URL + "/api/hosts/assign-1/power"
+
+	// Past the access check, PUT isn't a power method
+	if status := request(t, "PUT", power, "assignee@example.com", ""); status != http.StatusForbidden {
+		t.Fatalf("unassigned: status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if status := request(t, "POST", users, "assignee@example.com", `{"email": "assignee@example.com"}`); status != http.StatusForbidden {
+		t.Fatalf("self-assign: status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if status := request(t, "POST", users, "admin@example.com", `{"email": "nobody@example.com"}`); status != http.StatusBadRequest {
+		t.Fatalf("unknown user: status = %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status := request(t, "POST", users, "admin@example.com", `{"email": "Assignee@example.com"}`); status != http.StatusNoContent {
+		t.Fatalf("assign: status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	if status := request(t, "PUT", power, "assignee@example.com", ""); status != http.StatusMethodNotAllowed {
+		t.Fatalf("assigned: status = %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+
+	if status := request(t, "DELETE", users+"/assignee@example.com", "admin@example.com", ""); status != http.StatusNoContent {
+		t.Fatalf("unassign: status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	if status := request(t, "PUT", power, "assignee@example.com", ""); status != http.StatusForbidden {
+		t.Fatalf("unassigned again: status = %d, want %d", status, http.StatusForbidden)
+	}
+
+	if status := request(t, "DELETE", users+"/assignee@example.com", "admin@example.com", ""); status != http.StatusNotFound {
+		t.Errorf("unassign twice: status = %d, want %d", status, http.StatusNotFound)
+	}
+}
+
+// Users mount ISOs on the hosts assigned to them, but not on others'
+func TestMediaAccess(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "media-1", "90:B1:1C:00:02:02")
+
+	createUser(t, "user@example.com", database.UserPrivilegeBasic)
+	createUser(t, "other@example.com", database.UserPrivilegeBasic)
+	createUser(t, "admin@example.com", database.UserPrivilegeAdmin)
+
+	if status := request(t, "POST", server.URL+"/api/hosts/media-1/users", "admin@example.com", `{"email": "user@example.com"}`); status != http.StatusNoContent {
+		t.Fatalf("assign: status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	url := server.URL + "/api/hosts/media-1/media"
+
+	tests := []struct {
+		email string
+		want  int
+	}{
+		{"", http.StatusUnauthorized},
+		{"other@example.com", http.StatusForbidden},
+
+		// Past the access check, unknown ISOs are refused before the BMC is
+		// asked for anything
+		{"user@example.com", http.StatusBadRequest},
+		{"admin@example.com", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		if status := request(t, "POST", url, test.email, `{"iso": "missing.iso"}`); status != test.want {
+			t.Errorf("%q: status = %d, want %d", test.email, status, test.want)
+		}
+	}
+}
+
+// Browsers only send the methods the API allows cross-origin
+func TestCorsMethods(t *testing.T) {
+	w := httptest.NewRecorder()
+	withCors(w, httptest.NewRequest("OPTIONS", "/api/hosts/h1/maintenance", nil))
+
+	allowed := strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", ")
+
+	for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+		if !slices.Contains(allowed, method) {
+			t.Errorf("%s isn't allowed: %q", method, allowed)
+		}
+	}
+}
+
+// label is key=value, or just key for any value
+func TestParseHostSearch(t *testing.T) {
+	search, ok := parseHostSearch(httptest.NewRequest("GET", "/api/hosts?label=site=durham&label=rack&label=note=a=b&available=true", nil))
+
+	want := []database.HostLabelSelector{
+		{Key: "site", Value: "durham"},
+		{Key: "rack", AnyValue: true},
+		{Key: "note", Value: "a=b"},
+	}
+
+	if !ok || !slices.Equal(search.Labels, want) || !search.Available || search.Health != -1 {
+		t.Errorf("search = %+v, %v", search, ok)
+	}
+
+	for _, query := range []string{"label=Site=durham", "label==durham", "available=maybe", "min_cores=-1"} {
+		if _, ok := parseHostSearch(httptest.NewRequest("GET", "/api/hosts?"+query, nil)); ok {
+			t.Errorf("parsed %s", query)
+		}
+	}
+}
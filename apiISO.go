@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+type isoRequest struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+func (i *isoRequest) Valid() bool {
+	return lib.IsImageNameValid(i.Name) && lib.IsImageURLValid(i.URL) && len(i.Description) <= 256
+}
+
+func registerISORoutes() {
+	// The ISO catalog. Everyone can see it, only admins can add to it.
+	http.HandleFunc("/api/isos", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		switch r.Method {
+		case "GET":
+			if !withAuth(w, r) {
+				return
+			}
+
+			isos, err := database.ListISOs()
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, isos)
+		case "POST":
+			if !withAdmin(w, r) {
+				return
+			}
+
+			var obj isoRequest
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if !obj.Valid() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			iso, err := database.CreateISO(obj.Name, obj.URL, obj.Description, currentUser(r))
+
+			if err != nil {
+				if err == database.ErrISOExists {
+					w.WriteHeader(http.StatusConflict)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(iso.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("ISO %s added by %s", iso.Name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/isos/{name}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+		iso, err := database.GetISO(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if iso == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(iso.JSON())
+		case "PATCH":
+			obj := isoRequest{Name: iso.Name, URL: iso.URL, Description: iso.Description}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.Name != iso.Name || !obj.Valid() {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err := database.UpdateISO(name, obj.URL, obj.Description); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			iso.URL, iso.Description = obj.URL, obj.Description
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(iso.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("ISO %s updated by %s", name, currentUser(r)))
+		case "DELETE":
+			if err := database.DeleteISO(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			lib.Log.Basic(fmt.Sprintf("ISO %s deleted by %s", name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func registerIssueRoutes() {
+	// List issues, optionally for a single host and including resolved ones
+	http.HandleFunc("/api/issues", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		issues, err := database.ListHostIssues(r.URL.Query().Get("host"), r.URL.Query().Get("resolved") == "true")
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, issues)
+	})
+
+	// Acknowledge an issue
+	http.HandleFunc("/api/issues/{id}/acknowledge", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !writeIssueUpdate(w, id, database.AcknowledgeHostIssue(id, currentUser(r))) {
+			return
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Issue %d acknowledged by %s", id, currentUser(r)))
+	})
+
+	// Close an issue that polling won't resolve on its own, like a hardware
+	// change that was expected
+	http.HandleFunc("/api/issues/{id}/resolve", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !writeIssueUpdate(w, id, database.ResolveHostIssue(id)) {
+			return
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Issue %d resolved by %s", id, currentUser(r)))
+	})
+
+	// Silence emails about an issue for a duration, or lift the silence with 0s
+	http.HandleFunc("/api/issues/{id}/silence", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		obj := struct {
+			Duration string `json:"duration"`
+		}{}
+
+		if !readJSON(w, r, &obj) {
+			return
+		}
+
+		duration, err := time.ParseDuration(obj.Duration)
+
+		if err != nil || duration < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var until time.Time
+
+		if duration > 0 {
+			until = time.Now().Add(duration)
+		}
+
+		if !writeIssueUpdate(w, id, database.SilenceHostIssue(id, until)) {
+			return
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Issue %d silenced for %s by %s", id, duration, currentUser(r)))
+	})
+}
+
+// writeIssueUpdate responds with the updated issue, or the error that kept it
+// from being updated
+func writeIssueUpdate(w http.ResponseWriter, id int, err error) bool {
+	if err == database.ErrIssueNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		return false
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	issue, err := database.GetHostIssue(id)
+
+	if err != nil || issue == nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(issue.JSON())
+
+	return true
+}
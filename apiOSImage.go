@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func osImageValid(image *database.DBOSImage) bool {
+	if !lib.IsImageNameValid(image.Name) || !lib.IsImageURLValid(image.KernelURL) || len(image.Description) > 256 {
+		return false
+	}
+
+	if image.InitrdURL != "" && !lib.IsImageURLValid(image.InitrdURL) {
+		return false
+	}
+
+	if !database.IsOSTemplateKindValid(image.TemplateKind) || len(image.KernelArgs) > 4096 || len(image.Template) > 64*1024 {
+		return false
+	}
+
+	return image.CheckTemplates() == nil
+}
+
+func registerOSImageRoutes() {
+	// The catalog of images hosts can be network installed with. Everyone can
+	// see it, only admins can add to it.
+	http.HandleFunc("/api/os-images", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		switch r.Method {
+		case "GET":
+			if !withAuth(w, r) {
+				return
+			}
+
+			images, err := database.ListOSImages()
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			writeJSON(w, images)
+		case "POST":
+			if !withAdmin(w, r) {
+				return
+			}
+
+			var obj database.DBOSImage
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if !osImageValid(&obj) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			image, err := database.CreateOSImage(&obj, currentUser(r))
+
+			if err != nil {
+				if err == database.ErrOSImageExists {
+					w.WriteHeader(http.StatusConflict)
+				} else {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(image.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("OS image %s added by %s", image.Name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	http.HandleFunc("/api/os-images/{name}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		name := r.PathValue("name")
+		image, err := database.GetOSImage(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if image == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(image.JSON())
+		case "PATCH":
+			obj := *image
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.Name != image.Name || !osImageValid(&obj) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			obj.CreateTime, obj.CreatedBy = image.CreateTime, image.CreatedBy
+
+			if err := database.UpdateOSImage(&obj); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(obj.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("OS image %s updated by %s", name, currentUser(r)))
+		case "DELETE":
+			if err := database.DeleteOSImage(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+			lib.Log.Basic(fmt.Sprintf("OS image %s deleted by %s", name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
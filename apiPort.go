@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func registerPortRoutes() {
+	// The physical network ports of a host and how they are cabled
+	http.HandleFunc("/api/hosts/{name}/ports", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAuth(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.PathValue("name")
+
+		if !database.HostExists(name) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		ports, err := database.GetHostPorts(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, ports)
+	})
+
+	// PATCH records which switch port a host port is cabled to and its VLAN.
+	// An empty switch_name clears it.
+	http.HandleFunc("/api/hosts/{name}/ports/{port}", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if r.Method == "GET" && !withAuth(w, r) || r.Method != "GET" && !withAdmin(w, r) {
+			return
+		}
+
+		name, id := r.PathValue("name"), r.PathValue("port")
+		port, err := database.GetHostPort(name, id)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if port == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+		case "PATCH":
+			obj := struct {
+				SwitchName string `json:"switch_name"`
+				SwitchPort string `json:"switch_port"`
+				VLAN       *int   `json:"vlan"`
+			}{port.SwitchName, port.SwitchPort, port.VLAN}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if obj.SwitchName == "" {
+				obj.SwitchPort, obj.VLAN = "", nil
+			} else if !lib.IsSwitchNameValid(obj.SwitchName) || !lib.IsSwitchNameValid(obj.SwitchPort) || obj.VLAN != nil && !lib.IsVLANValid(*obj.VLAN) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if err := database.AnnotateHostPort(name, id, obj.SwitchName, obj.SwitchPort, obj.VLAN); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			detail := id + " -> " + obj.SwitchName + " " + obj.SwitchPort
+
+			if obj.VLAN != nil {
+				detail += fmt.Sprintf(" vlan %d", *obj.VLAN)
+			}
+
+			if err := database.Audit(currentUser(r), "port.annotate", name, detail); err != nil {
+				lib.Log.Error("Could not record port annotation: " + err.Error())
+			}
+
+			port.SwitchName, port.SwitchPort, port.VLAN = obj.SwitchName, obj.SwitchPort, obj.VLAN
+
+			lib.Log.Basic(fmt.Sprintf("Port %s of host %s annotated by %s", id, name, currentUser(r)))
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(port.JSON())
+	})
+
+	// The host ports cabled to a switch, for network automation
+	http.HandleFunc("/api/switches/{switch}/ports", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		if !withAdmin(w, r) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		ports, err := database.ListSwitchPorts(r.PathValue("switch"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, ports)
+	})
+}
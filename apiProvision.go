@@ -0,0 +1,454 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+// publicURL is where hosts reach the server. Without PUBLIC_URL, the address
+// the request was made to is used.
+func publicURL(r *http.Request) string {
+	if lib.Config.PublicURL != "" {
+		return strings.TrimSuffix(lib.Config.PublicURL, "/")
+	}
+
+	scheme := "http"
+
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+func writeText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(text))
+}
+
+// provisionData fills in the MAC address for provisions that haven't booted
+// yet, so that previews look like the real thing
+func provisionData(r *http.Request, provision *database.DBHostProvision, image *database.DBOSImage) (*database.ProvisionData, error) {
+	data, err := provision.Data(image, publicURL(r))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if data.MAC == "" {
+		nics, err := database.GetHostInterfaces(provision.HostName)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, nic := range nics {
+			if nic.MACAddress != "" {
+				data.MAC = nic.MACAddress
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
+
+func registerProvisionRoutes() {
+	// Network install of a host. POST arms the host to install an image the
+	// next time it network boots and, unless boot is false, boots it. With
+	// bios_profile, the profile is applied first and the host boots once it
+	// has taken.
+	http.HandleFunc("/api/hosts/{name}/provision", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		host := lookupHost(w, name)
+
+		if host == nil {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			provision, err := database.GetHostProvision(name)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if provision == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(provision.JSON())
+		case "POST":
+			obj := struct {
+				Image       string `json:"image"`
+				User        string `json:"user"`
+				SSHKey      string `json:"ssh_key"`
+				Boot        *bool  `json:"boot"`
+				BIOSProfile string `json:"bios_profile"`
+			}{}
+
+			if !readJSON(w, r, &obj) {
+				return
+			}
+
+			if len(obj.SSHKey) > 4096 || strings.ContainsAny(obj.SSHKey, "\r\n") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			// The OS is installed for the requester unless an admin names
+			// someone else
+			user := strings.ToLower(obj.User)
+
+			if user == "" {
+				user = currentUser(r)
+			} else if user != currentUser(r) {
+				if !isAdmin(r) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+
+				if !database.UserExists(user) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+			}
+
+			image, err := database.GetOSImage(obj.Image)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if image == nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			var profile *database.DBBIOSProfile
+
+			if obj.BIOSProfile != "" {
+				if profile, err = database.GetBIOSProfile(obj.BIOSProfile); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+
+				if profile == nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+
+				if database.BIOSApplyRunning(name) {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+			}
+
+			// Hosts are recognized by MAC address, which the hardware poll
+			// finds
+			if nics, err := database.GetHostInterfaces(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			} else if len(nics) == 0 {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+
+			// With a profile, the host isn't served the installer until
+			// the profile is applied
+			provision, err := database.CreateHostProvision(name, image.Name, user, currentUser(r), obj.SSHKey, profile != nil)
+
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			detail := image.Name
+			boot := obj.Boot == nil || *obj.Boot
+
+			if user != currentUser(r) {
+				detail += ", for " + user
+			}
+
+			switch {
+			case profile != nil:
+				detail += ", bios profile " + profile.Name
+
+				if boot {
+					detail += ", network boot"
+				}
+
+				if _, err = host.ApplyBIOSProfile(profile, boot, currentUser(r)); err != nil {
+					if failErr := database.FailHostProvision(name); failErr != nil {
+						lib.Log.Error(fmt.Sprintf("Could not fail provision of host %s: %s", name, failErr.Error()))
+					}
+				}
+			case boot:
+				detail += ", network boot"
+				err = host.NetworkBoot()
+			}
+
+			if err != nil {
+				detail += ", failed: " + err.Error()
+			}
+
+			if auditErr := database.Audit(currentUser(r), "provision", name, detail); auditErr != nil {
+				lib.Log.Error("Could not record provision: " + auditErr.Error())
+			}
+
+			if !writeBMCError(w, err) {
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(provision.JSON())
+
+			lib.Log.Basic(fmt.Sprintf("User %s is installing %s on host %s for %s", currentUser(r), image.Name, name, user))
+		case "DELETE":
+			if err := database.DeleteHostProvision(name); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			if err := database.Audit(currentUser(r), "provision.cancel", name, ""); err != nil {
+				lib.Log.Error("Could not record provision cancel: " + err.Error())
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	// What the host and its installer will be served, without changing the
+	// provision's status
+	http.HandleFunc("/api/hosts/{name}/provision/preview", func(w http.ResponseWriter, r *http.Request) {
+		withCors(w, r)
+
+		name := r.PathValue("name")
+
+		if !withHostAccess(w, r, name) {
+			return
+		}
+
+		if r.Method != "GET" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		provision, err := database.GetHostProvision(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if provision == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		image, err := database.GetOSImage(provision.ImageName)
+
+		if err != nil || image == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		data, err := provisionData(r, provision, image)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		script, scriptErr := database.RenderIPXE(image, data)
+		template, templateErr := database.RenderInstallTemplate(image, data)
+		errs := []string{}
+
+		for _, err := range []error{scriptErr, templateErr} {
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		writeJSON(w, map[string]interface{}{
+			"ipxe":     script,
+			"template": template,
+			"errors":   errs,
+		})
+	})
+
+	// The rest is fetched by iPXE and installers, which can't log in
+
+	// Chained to from DHCP, so that every host can use the same boot file
+	http.HandleFunc("/pxe/boot.ipxe", func(w http.ResponseWriter, r *http.Request) {
+		writeText(w, "#!ipxe\nchain "+publicURL(r)+"/pxe/host?mac=${net0/mac}\n")
+	})
+
+	http.HandleFunc("/pxe/host", func(w http.ResponseWriter, r *http.Request) {
+		mac := database.NormalizeMAC(r.URL.Query().Get("mac"))
+		name, err := database.FindHostByMAC(mac)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if name == "" {
+			writeText(w, database.LocalBootIPXE)
+			return
+		}
+
+		provision, err := database.GetHostProvision(name)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if provision == nil || provision.Status != database.ProvisionPending {
+			writeText(w, database.LocalBootIPXE)
+			return
+		}
+
+		image, err := database.GetOSImage(provision.ImageName)
+
+		if err != nil || image == nil {
+			lib.Log.Error(fmt.Sprintf("Host %s is to install missing OS image %s", name, provision.ImageName))
+			writeText(w, database.LocalBootIPXE)
+			return
+		}
+
+		provision.MACAddress = mac
+		data, err := provisionData(r, provision, image)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		script, err := database.RenderIPXE(image, data)
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not render iPXE script for host %s: %s", name, err.Error()))
+			writeText(w, database.LocalBootIPXE)
+			return
+		}
+
+		if started, err := database.StartHostProvision(name, mac); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		} else if !started {
+			writeText(w, database.LocalBootIPXE)
+			return
+		}
+
+		writeText(w, script)
+
+		lib.Log.Basic(fmt.Sprintf("Host %s network booted from %s to install %s", name, mac, image.Name))
+	})
+
+	// Kickstart and preseed files are fetched directly, autoinstall fetches
+	// user-data and meta-data from under the URL
+	serveTemplate := func(w http.ResponseWriter, r *http.Request) {
+		provision, err := database.GetHostProvisionByToken(r.PathValue("token"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if provision == nil || provision.Status == database.ProvisionDone || provision.Status == database.ProvisionFailed {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		image, err := database.GetOSImage(provision.ImageName)
+
+		if err != nil || image == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		file := r.PathValue("file")
+
+		switch {
+		case image.TemplateKind == database.OSTemplateAutoinstall && file == "meta-data":
+			writeText(w, "instance-id: "+provision.HostName+"\nlocal-hostname: "+provision.HostName+"\n")
+			return
+		case image.TemplateKind == database.OSTemplateAutoinstall && file == "vendor-data":
+			writeText(w, "")
+			return
+		case image.TemplateKind == database.OSTemplateAutoinstall && file == "user-data":
+		case file == "":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		data, err := provisionData(r, provision, image)
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		text, err := database.RenderInstallTemplate(image, data)
+
+		if err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not render install template for host %s: %s", provision.HostName, err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := database.SetHostProvisionStatus(provision.HostName, database.ProvisionInstalling); err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not update provision of host %s: %s", provision.HostName, err.Error()))
+		}
+
+		writeText(w, text)
+	}
+
+	http.HandleFunc("/pxe/templates/{token}", serveTemplate)
+	http.HandleFunc("/pxe/templates/{token}/{file}", serveTemplate)
+
+	// Called by the installer when it finishes
+	http.HandleFunc("/pxe/done/{token}", func(w http.ResponseWriter, r *http.Request) {
+		provision, err := database.GetHostProvisionByToken(r.PathValue("token"))
+
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if provision == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := database.SetHostProvisionStatus(provision.HostName, database.ProvisionDone); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		lib.Log.Success(fmt.Sprintf("Host %s finished installing %s", provision.HostName, provision.ImageName))
+	})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+func getText(t *testing.T, url string) (int, string) {
+	t.Helper()
+
+	res, err := http.Get(url)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, string(body)
+}
+
+func provisionStatus(t *testing.T, name string) string {
+	t.Helper()
+
+	provision, err := database.GetHostProvision(name)
+
+	if err != nil || provision == nil {
+		t.Fatalf("provision of %s: %v", name, err)
+	}
+
+	return provision.Status
+}
+
+// createProvisionedHost makes a host with one interface and a pending install
+// of a preseeded image
+func createProvisionedHost(t *testing.T, name, mac string) *database.DBHost {
+	t.Helper()
+
+	host, err := database.CreateHost(name, database.HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, "192.0.2.1", "root", "calvin", 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { database.DeleteHost(name) })
+
+	if err := database.SetHostInterfaces(name, []redfish.EthernetInterface{{ID: "NIC.Integrated.1-1-1", MACAddress: mac, LinkStatus: "LinkUp"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if image, err := database.GetOSImage("debian"); err != nil {
+		t.Fatal(err)
+	} else if image == nil {
+		_, err := database.CreateOSImage(&database.DBOSImage{
+			Name:         "debian",
+			KernelURL:    "http://mirror.example.com/debian/linux",
+			InitrdURL:    "http://mirror.example.com/debian/initrd.gz",
+			KernelArgs:   "auto=true priority=critical url={{.TemplateURL}} hostname={{.Host}} BOOTIF={{.MAC}}",
+			TemplateKind: database.OSTemplatePreseed,
+			Template:     "d-i netcfg/get_hostname string {{.Host}}\nd-i preseed/late_command string in-target sh -c 'echo {{.SSHKey}} >> /root/.ssh/authorized_keys'; wget -q -O- {{.DoneURL}}\n",
+		}, "admin@example.com")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := database.CreateHostProvision(name, "debian", "user@example.com", "user@example.com", "ssh-ed25519 AAAAC3Nza user@example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	return host
+}
+
+func TestProvisionNetworkInstall(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "provision-1", "90:B1:1C:00:00:01")
+
+	// Unknown hosts go on to their next boot device
+	if _, script := getText(t, server.URL+"/pxe/host?mac=90:b1:1c:ff:ff:ff"); script != database.LocalBootIPXE {
+		t.Errorf("unknown host got %q", script)
+	}
+
+	_, chain := getText(t, server.URL+"/pxe/boot.ipxe")
+
+	if !strings.Contains(chain, server.URL+"/pxe/host?mac=${net0/mac}") {
+		t.Errorf("boot.ipxe = %q", chain)
+	}
+
+	// iPXE writes MAC addresses in lowercase
+	status, script := getText(t, server.URL+"/pxe/host?mac=90:b1:1c:00:00:01")
+
+	if status != http.StatusOK || !strings.HasPrefix(script, "#!ipxe\n") {
+		t.Fatalf("script = %d %q", status, script)
+	}
+
+	kernel := regexp.MustCompile(`(?m)^kernel http://mirror.example.com/debian/linux auto=true priority=critical url=(\S+) hostname=provision-1 BOOTIF=90:b1:1c:00:00:01$`).FindStringSubmatch(script)
+
+	if kernel == nil || !strings.Contains(script, "\ninitrd http://mirror.example.com/debian/initrd.gz\nboot\n") {
+		t.Fatalf("script = %q", script)
+	}
+
+	if status := provisionStatus(t, "provision-1"); status != database.ProvisionBooting {
+		t.Errorf("status after boot = %s, want %s", status, database.ProvisionBooting)
+	}
+
+	// Booting again, say after the install, doesn't install again
+	if _, again := getText(t, server.URL+"/pxe/host?mac=90:b1:1c:00:00:01"); again != database.LocalBootIPXE {
+		t.Errorf("second boot got %q", again)
+	}
+
+	templateURL := kernel[1]
+
+	if !strings.HasPrefix(templateURL, server.URL+"/pxe/templates/") {
+		t.Fatalf("template url = %s", templateURL)
+	}
+
+	status, preseed := getText(t, templateURL)
+
+	if status != http.StatusOK || !strings.Contains(preseed, "d-i netcfg/get_hostname string provision-1\n") || !strings.Contains(preseed, "echo ssh-ed25519 AAAAC3Nza user@example.com >>") {
+		t.Fatalf("template = %d %q", status, preseed)
+	}
+
+	if status := provisionStatus(t, "provision-1"); status != database.ProvisionInstalling {
+		t.Errorf("status after template = %s, want %s", status, database.ProvisionInstalling)
+	}
+
+	doneURL := regexp.MustCompile(`wget -q -O- (\S+)`).FindStringSubmatch(preseed)[1]
+
+	if res, err := http.Post(doneURL, "text/plain", nil); err != nil {
+		t.Fatal(err)
+	} else if res.Body.Close(); res.StatusCode != http.StatusNoContent {
+		t.Errorf("done = %d", res.StatusCode)
+	}
+
+	if status := provisionStatus(t, "provision-1"); status != database.ProvisionDone {
+		t.Errorf("status after done = %s, want %s", status, database.ProvisionDone)
+	}
+
+	// The token stops working once the install is done
+	if status, _ := getText(t, templateURL); status != http.StatusNotFound {
+		t.Errorf("template after done = %d", status)
+	}
+}
+
+func TestProvisionBadToken(t *testing.T) {
+	server := testServer(t)
+
+	if status, _ := getText(t, server.URL+"/pxe/templates/0123456789abcdef0123456789abcdef"); status != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", status)
+	}
+}
+
+// A host resetting to take a BIOS profile doesn't boot the installer
+func TestProvisionWaitingForBIOS(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "provision-2", "90:B1:1C:00:00:02")
+
+	if _, err := database.CreateHostProvision("provision-2", "debian", "user@example.com", "user@example.com", "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, script := getText(t, server.URL+"/pxe/host?mac=90:b1:1c:00:00:02"); script != database.LocalBootIPXE {
+		t.Errorf("waiting host got %q", script)
+	}
+
+	if status := provisionStatus(t, "provision-2"); status != database.ProvisionWaitingBIOS {
+		t.Errorf("status = %s, want %s", status, database.ProvisionWaitingBIOS)
+	}
+}
+
+// Admins install an OS for a user, who owns the provision. Users can only
+// install for themselves.
+func TestProvisionOwner(t *testing.T) {
+	server := testServer(t)
+	createProvisionedHost(t, "provision-3", "90:B1:1C:00:00:03")
+
+	createUser(t, "user@example.com", database.UserPrivilegeBasic)
+	createUser(t, "other@example.com", database.UserPrivilegeBasic)
+	createUser(t, "admin@example.com", database.UserPrivilegeAdmin)
+
+	url := server.URL + "/api/hosts/provision-3/provision"
+
+	if status := request(t, "POST", server.URL+"/api/hosts/provision-3/users", "admin@example.com", `{"email": "user@example.com"}`); status != http.StatusNoContent {
+		t.Fatalf("assign: status = %d, want %d", status, http.StatusNoContent)
+	}
+
+	tests := []struct {
+		email string
+		body  string
+		want  int
+		user  string
+	}{
+		{"other@example.com", `{"image": "debian", "boot": false}`, http.StatusForbidden, ""},
+		{"user@example.com", `{"image": "debian", "user": "other@example.com", "boot": false}`, http.StatusForbidden, ""},
+		{"admin@example.com", `{"image": "debian", "user": "nobody@example.com", "boot": false}`, http.StatusBadRequest, ""},
+		{"admin@example.com", `{"image": "debian", "user": "User@example.com", "boot": false}`, http.StatusOK, "user@example.com"},
+		{"user@example.com", `{"image": "debian", "boot": false}`, http.StatusOK, "user@example.com"},
+		{"admin@example.com", `{"image": "debian", "boot": false}`, http.StatusOK, "admin@example.com"},
+	}
+
+	for _, test := range tests {
+		if status := request(t, "POST", url, test.email, test.body); status != test.want {
+			t.Fatalf("%s %s: status = %d, want %d", test.email, test.body, status, test.want)
+		}
+
+		if test.want != http.StatusOK {
+			continue
+		}
+
+		provision, err := database.GetHostProvision("provision-3")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if provision.User != test.user || provision.RequestedBy != test.email {
+			t.Errorf("%s %s: user = %s, requested by %s", test.email, test.body, provision.User, provision.RequestedBy)
+		}
+	}
+}
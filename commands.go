@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+const usage = `Usage: coordinator [command]
+
+Without a command, the coordinator server is started.
+
+Commands:
+  generate-bmc-key              Print a new key for BMC_KEY or BMC_KEY_FILE
+  rotate-bmc-key <key file>     Re-encrypt all BMC credentials with the key in
+                                <key file>. Stop the server first, and point
+                                BMC_KEY_FILE at the new key afterwards.
+  import-hosts [--dry-run] <file>
+                                Create the hosts listed in a .csv or .yaml
+                                inventory file and report on each row. With
+                                --dry-run, rows are only validated and their
+                                BMCs probed.
+`
+
+func runCommand(command string, args []string) {
+	switch command {
+	case "generate-bmc-key":
+		key, err := lib.NewSecretKey()
+
+		if err != nil {
+			lib.Log.Error("Could not generate key: " + err.Error())
+			os.Exit(1)
+		}
+
+		fmt.Println(key)
+	case "rotate-bmc-key":
+		if len(args) != 1 {
+			fmt.Print(usage)
+			os.Exit(2)
+		}
+
+		newKey, err := lib.ReadSecretKeyFile(args[0])
+
+		if err != nil {
+			lib.Log.Error("Could not read new key: " + err.Error())
+			os.Exit(1)
+		}
+
+		if !initCommand() {
+			os.Exit(1)
+		}
+
+		count, err := database.RotateBMCKey(newKey)
+
+		if err != nil {
+			lib.Log.Error("Could not rotate BMC key, nothing was changed: " + err.Error())
+			os.Exit(1)
+		}
+
+		lib.Log.Success(fmt.Sprintf("Re-encrypted BMC credentials for %d host(s)", count))
+		lib.Log.Important("Set BMC_KEY_FILE=" + args[0] + " (and remove BMC_KEY) before starting the server")
+	case "import-hosts":
+		dryRun := len(args) > 0 && args[0] == "--dry-run"
+
+		if dryRun {
+			args = args[1:]
+		}
+
+		if len(args) != 1 {
+			fmt.Print(usage)
+			os.Exit(2)
+		}
+
+		format := database.HostImportFormatCSV
+
+		if ext := strings.ToLower(filepath.Ext(args[0])); ext == ".yaml" || ext == ".yml" {
+			format = database.HostImportFormatYAML
+		}
+
+		data, err := os.ReadFile(args[0])
+
+		if err != nil {
+			lib.Log.Error("Could not read inventory: " + err.Error())
+			os.Exit(1)
+		}
+
+		rows, err := database.ParseHostImport(data, format)
+
+		if err != nil {
+			lib.Log.Error("Could not parse inventory: " + err.Error())
+			os.Exit(1)
+		}
+
+		if !initCommand() {
+			os.Exit(1)
+		}
+
+		ok := true
+
+		for _, result := range database.ImportHosts(rows, dryRun) {
+			line := fmt.Sprintf("%4d  %-24s %s", result.Row, result.Name, result.Status)
+
+			if result.Error != "" {
+				line += ": " + result.Error
+			}
+
+			fmt.Println(line)
+			// Hosts that already exist are fine, so an import can be re-run
+			switch result.Status {
+			case database.HostImportCreated, database.HostImportValid, database.HostImportExists:
+			default:
+				ok = false
+			}
+		}
+
+		if !ok {
+			os.Exit(1)
+		}
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+}
+
+// initCommand sets up the environment and database for commands that need
+// them, without starting any of the server's background work
+func initCommand() bool {
+	if err := lib.InitEnv(); err != nil {
+		lib.Log.Error("Could not initialize environment: " + err.Error())
+		return false
+	}
+
+	return database.Connect()
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+// ReportHostIssues syncs the problems found by a source with the host's
+// issues and emails admins about the ones they need to hear about
+func ReportHostIssues(name, source string, found []*DBHostIssue) error {
+	open, resolved, err := SyncHostIssues(name, source, found)
+
+	if err != nil {
+		return err
+	}
+
+	alertHostIssues(name, open, resolved)
+	return nil
+}
+
+// ReportRaisedHostIssues opens issues that have to be resolved by hand and
+// emails admins about them
+func ReportRaisedHostIssues(name, source string, found []*DBHostIssue) error {
+	open, err := RaiseHostIssues(name, source, found)
+
+	if err != nil {
+		return err
+	}
+
+	alertHostIssues(name, open, nil)
+	return nil
+}
+
+// alertHostIssues only emails about issues that are new or have gotten worse
+// since admins were last told, and about the resolution of issues they were
+// told about. Silenced issues are left out entirely. Nothing is sent while
+// the host is in maintenance; its issues stay unnotified, so admins hear
+// about the ones still open once it is back in service.
+func alertHostIssues(name string, open, resolved []*DBHostIssue) {
+	if maintenance, err := GetHostMaintenance(name); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not check maintenance of host %s: %s", name, err.Error()))
+	} else if maintenance != nil {
+		return
+	}
+
+	now := time.Now()
+	alert, fixed := []*DBHostIssue{}, []*DBHostIssue{}
+
+	for _, issue := range open {
+		if issue.Escalated() && !issue.Silenced(now) {
+			alert = append(alert, issue)
+		}
+	}
+
+	for _, issue := range resolved {
+		if issue.Notified() && !issue.Silenced(now) {
+			fixed = append(fixed, issue)
+		}
+	}
+
+	if len(alert) == 0 && len(fixed) == 0 {
+		return
+	}
+
+	admins, err := ListAdminEmails()
+
+	if err != nil {
+		lib.Log.Error("Could not list admins to alert: " + err.Error())
+		return
+	}
+
+	if len(admins) == 0 {
+		return
+	}
+
+	subject := fmt.Sprintf("[%s] %s: %d new issue(s), %d resolved", lib.Config.LabName, name, len(alert), len(fixed))
+
+	if err := lib.SendEmail(admins, subject, issueEmailBody(name, alert, fixed)); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not email admins about host %s: %s", name, err.Error()))
+		return
+	}
+
+	for _, issue := range alert {
+		if err := MarkHostIssueNotified(issue); err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not mark issue %d as notified: %s", issue.ID, err.Error()))
+		}
+	}
+
+	lib.Log.Basic(fmt.Sprintf("Emailed %d admin(s) about host %s", len(admins), name))
+}
+
+func issueEmailBody(name string, alert, fixed []*DBHostIssue) string {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "<p>The following changed on host <b>%s</b>:</p>", html.EscapeString(name))
+
+	if len(alert) > 0 {
+		body.WriteString("<h3>New or worsened issues</h3><ul>")
+
+		for _, issue := range alert {
+			fmt.Fprintf(&body, "<li><b>%s</b> (%s): %s</li>", html.EscapeString(issue.Component), HostHealthName(issue.Severity), html.EscapeString(issue.Message))
+		}
+
+		body.WriteString("</ul>")
+	}
+
+	if len(fixed) > 0 {
+		body.WriteString("<h3>Resolved issues</h3><ul>")
+
+		for _, issue := range fixed {
+			fmt.Fprintf(&body, "<li><b>%s</b>: %s</li>", html.EscapeString(issue.Component), html.EscapeString(issue.Message))
+		}
+
+		body.WriteString("</ul>")
+	}
+
+	return body.String()
+}
+
+// NotifyHostMaintenance emails the users the host is assigned to that it has
+// gone out of service, or with a nil maintenance, that it is back
+func NotifyHostMaintenance(name string, maintenance *DBHostMaintenance) {
+	users, err := HostUsers(name)
+
+	if err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not list users of host %s: %s", name, err.Error()))
+		return
+	}
+
+	if len(users) == 0 {
+		return
+	}
+
+	var subject string
+	var body strings.Builder
+
+	if maintenance != nil {
+		subject = fmt.Sprintf("[%s] %s is down for maintenance", lib.Config.LabName, name)
+		fmt.Fprintf(&body, "<p>Host <b>%s</b> has been taken out of service for maintenance.</p>", html.EscapeString(name))
+		fmt.Fprintf(&body, "<p>Reason: %s</p>", html.EscapeString(maintenance.Reason))
+
+		if maintenance.ExpectedReturn != nil {
+			fmt.Fprintf(&body, "<p>It is expected back by %s.</p>", maintenance.ExpectedReturn.Format(time.RFC1123))
+		}
+	} else {
+		subject = fmt.Sprintf("[%s] %s is back in service", lib.Config.LabName, name)
+		fmt.Fprintf(&body, "<p>Maintenance on host <b>%s</b> is finished and it is back in service.</p>", html.EscapeString(name))
+	}
+
+	if err := lib.SendEmail(users, subject, body.String()); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not email users of host %s: %s", name, err.Error()))
+		return
+	}
+
+	lib.Log.Basic(fmt.Sprintf("Emailed %d user(s) about maintenance of host %s", len(users), name))
+}
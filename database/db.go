@@ -18,11 +18,54 @@ var ErrBadData = errors.New("bad data")
 
 var db *sql.DB
 
+var tables = []struct {
+	name, statement string
+}{
+	{"users", USERS_STATEMENT},
+	{"hosts", HOSTS_STATEMENT},
+	{"host_bmc", HOST_BMC_STATEMENT},
+	{"host_health_components", HOST_HEALTH_COMPONENTS_STATEMENT},
+	{"host_polls", HOST_POLLS_STATEMENT},
+	{"host_issues", HOST_ISSUES_STATEMENT},
+	{"host_inventory", HOST_INVENTORY_STATEMENT},
+	{"host_telemetry", HOST_TELEMETRY_STATEMENT},
+	{"host_telemetry_hourly", HOST_TELEMETRY_HOURLY_STATEMENT},
+	{"host_event_logs", HOST_EVENT_LOGS_STATEMENT},
+	{"isos", ISOS_STATEMENT},
+	{"host_interfaces", HOST_INTERFACES_STATEMENT},
+	{"host_ports", HOST_PORTS_STATEMENT},
+	{"host_port_annotations", HOST_PORT_ANNOTATIONS_STATEMENT},
+	{"host_storage_controllers", HOST_STORAGE_CONTROLLERS_STATEMENT},
+	{"host_drives", HOST_DRIVES_STATEMENT},
+	{"host_volumes", HOST_VOLUMES_STATEMENT},
+	{"host_firmware", HOST_FIRMWARE_STATEMENT},
+	{"firmware_minimums", FIRMWARE_MINIMUMS_STATEMENT},
+	{"firmware_reports", FIRMWARE_REPORTS_STATEMENT},
+	{"firmware_updates", FIRMWARE_UPDATES_STATEMENT},
+	{"firmware_update_hosts", FIRMWARE_UPDATE_HOSTS_STATEMENT},
+	{"bios_profiles", BIOS_PROFILES_STATEMENT},
+	{"host_bios", HOST_BIOS_STATEMENT},
+	{"host_bios_applies", HOST_BIOS_APPLIES_STATEMENT},
+	{"host_event_subscriptions", HOST_EVENT_SUBSCRIPTIONS_STATEMENT},
+	{"host_certificates", HOST_CERTIFICATES_STATEMENT},
+	{"host_ssh_keys", HOST_SSH_KEYS_STATEMENT},
+	{"console_sessions", CONSOLE_SESSIONS_STATEMENT},
+	{"os_images", OS_IMAGES_STATEMENT},
+	{"host_provisions", HOST_PROVISIONS_STATEMENT},
+	{"host_labels", HOST_LABELS_STATEMENT},
+	{"host_maintenance", HOST_MAINTENANCE_STATEMENT},
+	{"host_users", HOST_USERS_STATEMENT},
+	{"discoveries", DISCOVERIES_STATEMENT},
+	{"discovered_bmcs", DISCOVERED_BMCS_STATEMENT},
+	{"audit_log", AUDIT_LOG_STATEMENT},
+}
+
 func open() (*sql.DB, error) {
 	var err error
 
 	for i := 0; i < maxRetries; i++ {
-		db, err = sql.Open("sqlite", lib.Config.DBFile)
+		// Pollers write from several goroutines, so wait on locks instead of failing
+		db, err = sql.Open("sqlite", lib.Config.DBFile+"?_pragma=busy_timeout(5000)")
 		if err == nil {
 			break
 		}
@@ -47,8 +90,15 @@ func Connect() bool {
 
 	lib.Log.Basic("Checking tables...")
 
-	if _, err = db.Exec(USERS_STATEMENT); err != nil {
-		lib.Log.Error("Could not create users table: " + err.Error())
+	for _, table := range tables {
+		if _, err = db.Exec(table.statement); err != nil {
+			lib.Log.Error("Could not create " + table.name + " table: " + err.Error())
+			return false
+		}
+	}
+
+	if err = encryptPlaintextCredentials(); err != nil {
+		lib.Log.Error("Could not encrypt BMC credentials: " + err.Error())
 		return false
 	}
 
@@ -56,3 +106,11 @@ func Connect() bool {
 
 	return true
 }
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+
+	return &t.Time
+}
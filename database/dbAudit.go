@@ -0,0 +1,64 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const AUDIT_LOG_STATEMENT = `CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TIMESTAMP NOT NULL,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_log_target ON audit_log (target, time);`
+
+const INSERT_AUDIT_STATEMENT = `INSERT INTO audit_log (time, actor, action, target, detail) VALUES (?, ?, ?, ?, ?);`
+const SELECT_AUDIT_STATEMENT = `SELECT id, time, actor, action, target, detail FROM audit_log WHERE (? = '' OR target = ?) ORDER BY time DESC, id DESC LIMIT ?;`
+
+type DBAuditEntry struct {
+	ID     int       `json:"id"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	Target string    `json:"target"`
+	Detail string    `json:"detail"`
+}
+
+func (a *DBAuditEntry) JSON() []byte {
+	json, _ := json.Marshal(a)
+	return json
+}
+
+// Audit records that actor did action to target. Failures to record are
+// returned, but shouldn't stop the action itself.
+func Audit(actor, action, target, detail string) error {
+	return QueuedExec(INSERT_AUDIT_STATEMENT, time.Now(), actor, action, target, detail)
+}
+
+// ListAudit returns the latest entries, for one target if target is set
+func ListAudit(target string, limit int) ([]*DBAuditEntry, error) {
+	rows, err := QueuedQuery(SELECT_AUDIT_STATEMENT, target, target, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*DBAuditEntry{}
+
+	for rows.Next() {
+		var entry DBAuditEntry
+
+		if err := rows.Scan(&entry.ID, &entry.Time, &entry.Actor, &entry.Action, &entry.Target, &entry.Detail); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrBIOSProfileAttributes = errors.New("bios profile needs attributes with string, number or boolean values")
+
+// Named sets of BIOS attributes, such as virtualization extensions or SR-IOV
+// turned on. attributes is a JSON object of attribute names to values, as
+// the BMC's Bios resource has them.
+const BIOS_PROFILES_STATEMENT = `CREATE TABLE IF NOT EXISTS bios_profiles (
+	name TEXT PRIMARY KEY NOT NULL,
+	description TEXT NOT NULL,
+	attributes TEXT NOT NULL,
+	set_by TEXT NOT NULL,
+	update_time TIMESTAMP NOT NULL
+);`
+
+const BIOS_PROFILE_COLUMNS = `name, description, attributes, set_by, update_time`
+
+const UPSERT_BIOS_PROFILE_STATEMENT = `INSERT INTO bios_profiles (` + BIOS_PROFILE_COLUMNS + `) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET description = excluded.description, attributes = excluded.attributes, set_by = excluded.set_by, update_time = excluded.update_time;`
+const SELECT_BIOS_PROFILE_STATEMENT = `SELECT ` + BIOS_PROFILE_COLUMNS + ` FROM bios_profiles WHERE name = ?;`
+const SELECT_ALL_BIOS_PROFILES_STATEMENT = `SELECT ` + BIOS_PROFILE_COLUMNS + ` FROM bios_profiles ORDER BY name;`
+const DELETE_BIOS_PROFILE_STATEMENT = `DELETE FROM bios_profiles WHERE name = ?;`
+
+type DBBIOSProfile struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Attributes  map[string]interface{} `json:"attributes"`
+	SetBy       string                 `json:"set_by"`
+	UpdateTime  time.Time              `json:"update_time"`
+}
+
+func (p *DBBIOSProfile) JSON() []byte {
+	json, _ := json.Marshal(p)
+	return json
+}
+
+// BIOSDrift is an attribute of a host that isn't what a profile wants.
+// Actual is nil when the host's BIOS doesn't have the attribute at all.
+type BIOSDrift struct {
+	Attribute string      `json:"attribute"`
+	Expected  interface{} `json:"expected"`
+	Actual    interface{} `json:"actual"`
+}
+
+// Drift compares the host's attributes with the profile's, in attribute order
+func (p *DBBIOSProfile) Drift(attributes map[string]interface{}) []*BIOSDrift {
+	drift := []*BIOSDrift{}
+
+	for name, expected := range p.Attributes {
+		actual, ok := attributes[name]
+
+		// Numbers come back from JSON as floats either way, so comparing
+		// how they print is enough
+		if !ok || fmt.Sprint(actual) != fmt.Sprint(expected) {
+			drift = append(drift, &BIOSDrift{name, expected, actual})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Attribute < drift[j].Attribute
+	})
+
+	return drift
+}
+
+func SetBIOSProfile(name, description string, attributes map[string]interface{}, setBy string) (*DBBIOSProfile, error) {
+	if len(attributes) == 0 {
+		return nil, ErrBIOSProfileAttributes
+	}
+
+	for attribute, value := range attributes {
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return nil, ErrBIOSProfileAttributes
+		}
+
+		if attribute == "" {
+			return nil, ErrBIOSProfileAttributes
+		}
+	}
+
+	data, err := json.Marshal(attributes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &DBBIOSProfile{name, description, attributes, setBy, time.Now()}
+
+	if err := QueuedExec(UPSERT_BIOS_PROFILE_STATEMENT, profile.Name, profile.Description, string(data), profile.SetBy, profile.UpdateTime); err != nil {
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+func GetBIOSProfile(name string) (*DBBIOSProfile, error) {
+	profiles, err := queryBIOSProfiles(SELECT_BIOS_PROFILE_STATEMENT, name)
+
+	if err != nil || len(profiles) == 0 {
+		return nil, err
+	}
+
+	return profiles[0], nil
+}
+
+func ListBIOSProfiles() ([]*DBBIOSProfile, error) {
+	return queryBIOSProfiles(SELECT_ALL_BIOS_PROFILES_STATEMENT)
+}
+
+func DeleteBIOSProfile(name string) error {
+	return QueuedExec(DELETE_BIOS_PROFILE_STATEMENT, name)
+}
+
+func queryBIOSProfiles(query string, args ...interface{}) ([]*DBBIOSProfile, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	profiles := []*DBBIOSProfile{}
+
+	for rows.Next() {
+		var p DBBIOSProfile
+		var attributes string
+
+		if err := rows.Scan(&p.Name, &p.Description, &attributes, &p.SetBy, &p.UpdateTime); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(attributes), &p.Attributes); err != nil {
+			return nil, err
+		}
+
+		profiles = append(profiles, &p)
+	}
+
+	return profiles, rows.Err()
+}
@@ -0,0 +1,380 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+var (
+	ErrDiscoveryCIDR     = errors.New("cidr must be an IPv4 network")
+	ErrDiscoveryTooLarge = errors.New("cidr has too many addresses to scan")
+)
+
+// A discovery is running until every address has been probed. Discoveries
+// that were running when the server stopped are interrupted, since nothing
+// will finish them.
+const (
+	DiscoveryRunning     = "running"
+	DiscoveryDone        = "done"
+	DiscoveryInterrupted = "interrupted"
+)
+
+// How many addresses a discovery probes before recording its progress
+const discoveryProgressStep = 64
+
+const DISCOVERIES_STATEMENT = `CREATE TABLE IF NOT EXISTS discoveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	cidr TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	requested_by TEXT NOT NULL,
+	addresses INTEGER NOT NULL,
+	scanned INTEGER NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP
+);`
+
+// The BMCs each discovery found, with the fingerprint of the certificate
+// each presented. Adopting a BMC only sends it credentials if it still
+// presents that certificate.
+const DISCOVERED_BMCS_STATEMENT = `CREATE TABLE IF NOT EXISTS discovered_bmcs (
+	discovery_id INTEGER NOT NULL,
+	address TEXT NOT NULL,
+	driver TEXT NOT NULL,
+	vendor TEXT NOT NULL,
+	product TEXT NOT NULL,
+	redfish_version TEXT NOT NULL,
+	uuid TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	PRIMARY KEY (discovery_id, address)
+);`
+
+const DISCOVERY_COLUMNS = `id, cidr, port, status, requested_by, addresses, scanned, start_time, end_time`
+
+const INSERT_DISCOVERY_STATEMENT = `INSERT INTO discoveries (cidr, port, status, requested_by, addresses, scanned, start_time) VALUES (?, ?, ?, ?, ?, 0, ?);`
+const SELECT_DISCOVERY_STATEMENT = `SELECT ` + DISCOVERY_COLUMNS + ` FROM discoveries WHERE id = ?;`
+const SELECT_ALL_DISCOVERIES_STATEMENT = `SELECT ` + DISCOVERY_COLUMNS + ` FROM discoveries ORDER BY id DESC;`
+const UPDATE_DISCOVERY_SCANNED_STATEMENT = `UPDATE discoveries SET scanned = ? WHERE id = ?;`
+const UPDATE_DISCOVERY_DONE_STATEMENT = `UPDATE discoveries SET status = ?, scanned = ?, end_time = ? WHERE id = ?;`
+const UPDATE_INTERRUPTED_DISCOVERIES_STATEMENT = `UPDATE discoveries SET status = ?, end_time = ? WHERE status = ?;`
+const INSERT_DISCOVERED_BMC_STATEMENT = `INSERT OR REPLACE INTO discovered_bmcs (discovery_id, address, driver, vendor, product, redfish_version, uuid, fingerprint) VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+
+// A BMC is registered when a host has its address. Addresses without a port
+// are on 443. The model and serial number come from the registered host's
+// BMC, which was logged in to.
+const SELECT_DISCOVERED_BMCS_STATEMENT = `SELECT d.address, d.driver, d.vendor, d.product, COALESCE(b.system_model, ''), COALESCE(b.serial_number, ''), d.redfish_version, d.uuid, d.fingerprint, COALESCE(h.name, '')
+	FROM discovered_bmcs d
+	LEFT JOIN hosts h ON h.name = (SELECT name FROM hosts WHERE ipmi_address = d.address OR ipmi_address = d.address || ':443' LIMIT 1)
+	LEFT JOIN host_bmc b ON b.host_name = h.name
+	WHERE d.discovery_id = ? ORDER BY d.address;`
+
+type DBDiscovery struct {
+	ID          int                `json:"id"`
+	CIDR        string             `json:"cidr"`
+	Port        int                `json:"port"`
+	Status      string             `json:"status"`
+	RequestedBy string             `json:"requested_by"`
+	Addresses   int                `json:"addresses"`
+	Scanned     int                `json:"scanned"`
+	StartTime   time.Time          `json:"start_time"`
+	EndTime     *time.Time         `json:"end_time"`
+	BMCs        []*DBDiscoveredBMC `json:"bmcs,omitempty"`
+}
+
+func (d *DBDiscovery) JSON() []byte {
+	json, _ := json.Marshal(d)
+	return json
+}
+
+// DBDiscoveredBMC is a BMC a discovery found, as far as its service root
+// tells without logging in. The service root doesn't have the model and
+// serial number, so they are only known once the BMC is registered to a host
+// and has been logged in to, such as by adopting it.
+type DBDiscoveredBMC struct {
+	Address        string `json:"address"`
+	Driver         string `json:"driver"`
+	Vendor         string `json:"vendor"`
+	Product        string `json:"product"`
+	Model          string `json:"model"`
+	SerialNumber   string `json:"serial_number"`
+	RedfishVersion string `json:"redfish_version"`
+	UUID           string `json:"uuid"`
+	Fingerprint    string `json:"fingerprint"`
+	HostName       string `json:"host_name"`
+}
+
+// discoveryAddresses lists the addresses of an IPv4 network, leaving out the
+// network and broadcast addresses of anything larger than a /31
+func discoveryAddresses(cidr string) ([]net.IP, error) {
+	_, network, err := net.ParseCIDR(cidr)
+
+	if err != nil || network.IP.To4() == nil {
+		return nil, ErrDiscoveryCIDR
+	}
+
+	ones, bits := network.Mask.Size()
+
+	if bits-ones > 30 || 1<<(bits-ones) > lib.Config.DiscoveryMaxAddresses {
+		return nil, ErrDiscoveryTooLarge
+	}
+
+	first := ipToInt(network.IP.To4())
+	count := uint32(1) << (bits - ones)
+	addresses := []net.IP{}
+
+	for i := uint32(0); i < count; i++ {
+		if count > 2 && (i == 0 || i == count-1) {
+			continue
+		}
+
+		n := first + i
+		addresses = append(addresses, net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)))
+	}
+
+	return addresses, nil
+}
+
+func ipToInt(ip net.IP) uint32 {
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+// bmcAddress is how a host's BMC address is written, without the port when
+// it is the usual one
+func bmcAddress(ip net.IP, port int) string {
+	if port == 443 {
+		return ip.String()
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+// StartDiscovery scans cidr for Redfish service roots on port in the
+// background. No credentials are sent while scanning, since anything in the
+// range could be listening.
+func StartDiscovery(cidr string, port int, requestedBy string) (*DBDiscovery, error) {
+	addresses, err := discoveryAddresses(cidr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := QueuedExecResult(INSERT_DISCOVERY_STATEMENT, cidr, port, DiscoveryRunning, requestedBy, len(addresses), time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	go runDiscovery(int(id), addresses, port)
+	return GetDiscovery(int(id))
+}
+
+func runDiscovery(id int, addresses []net.IP, port int) {
+	lib.Log.Basic(fmt.Sprintf("Discovery %d scanning %d address(es)", id, len(addresses)))
+
+	queue := make(chan net.IP)
+	found := 0
+	scanned := 0
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	for i := 0; i < lib.Config.DiscoveryWorkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ip := range queue {
+				ok := probeDiscoveryAddress(id, bmcAddress(ip, port))
+
+				mu.Lock()
+				scanned++
+
+				if ok {
+					found++
+				}
+
+				if scanned%discoveryProgressStep == 0 {
+					if err := QueuedExec(UPDATE_DISCOVERY_SCANNED_STATEMENT, scanned, id); err != nil {
+						lib.Log.Error(fmt.Sprintf("Could not record progress of discovery %d: %s", id, err.Error()))
+					}
+				}
+
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, ip := range addresses {
+		queue <- ip
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if err := QueuedExec(UPDATE_DISCOVERY_DONE_STATEMENT, DiscoveryDone, scanned, time.Now(), id); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record end of discovery %d: %s", id, err.Error()))
+	}
+
+	lib.Log.Success(fmt.Sprintf("Discovery %d found %d BMC(s)", id, found))
+}
+
+// probeDiscoveryAddress records the BMC at address, if there is one
+func probeDiscoveryAddress(id int, address string) bool {
+	root, fingerprint, err := redfish.Probe(address, lib.Config.DiscoveryTimeout)
+
+	if err != nil {
+		return false
+	}
+
+	driver := redfish.MatchDriver(root)
+	bmc := &DBDiscoveredBMC{
+		Address:        address,
+		Driver:         driver.Name(),
+		Vendor:         root.Vendor,
+		Product:        root.Product,
+		RedfishVersion: root.RedfishVersion,
+		UUID:           root.UUID,
+		Fingerprint:    fingerprint,
+	}
+
+	if err := QueuedExec(INSERT_DISCOVERED_BMC_STATEMENT, id, bmc.Address, bmc.Driver, bmc.Vendor, bmc.Product, bmc.RedfishVersion, bmc.UUID, bmc.Fingerprint); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record BMC %s found by discovery %d: %s", address, id, err.Error()))
+	}
+
+	return true
+}
+
+// EndInterruptedDiscoveries marks the discoveries that were running when the
+// server last stopped
+func EndInterruptedDiscoveries() error {
+	return QueuedExec(UPDATE_INTERRUPTED_DISCOVERIES_STATEMENT, DiscoveryInterrupted, time.Now(), DiscoveryRunning)
+}
+
+func scanDiscovery(rows *sql.Rows) (*DBDiscovery, error) {
+	var d DBDiscovery
+	var end sql.NullTime
+
+	if err := rows.Scan(&d.ID, &d.CIDR, &d.Port, &d.Status, &d.RequestedBy, &d.Addresses, &d.Scanned, &d.StartTime, &end); err != nil {
+		return nil, err
+	}
+
+	d.EndTime = nullTime(end)
+	return &d, nil
+}
+
+// GetDiscovery returns a discovery with the BMCs it has found so far
+func GetDiscovery(id int) (*DBDiscovery, error) {
+	rows, err := QueuedQuery(SELECT_DISCOVERY_STATEMENT, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !rows.Next() {
+		rows.Close()
+		return nil, rows.Err()
+	}
+
+	discovery, err := scanDiscovery(rows)
+	rows.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	discovery.BMCs = []*DBDiscoveredBMC{}
+
+	err = queryEach(SELECT_DISCOVERED_BMCS_STATEMENT, id, func(rows *sql.Rows) error {
+		var b DBDiscoveredBMC
+
+		if err := rows.Scan(&b.Address, &b.Driver, &b.Vendor, &b.Product, &b.Model, &b.SerialNumber, &b.RedfishVersion, &b.UUID, &b.Fingerprint, &b.HostName); err != nil {
+			return err
+		}
+
+		discovery.BMCs = append(discovery.BMCs, &b)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return discovery, nil
+}
+
+func ListDiscoveries() ([]*DBDiscovery, error) {
+	rows, err := QueuedQuery(SELECT_ALL_DISCOVERIES_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	discoveries := []*DBDiscovery{}
+
+	for rows.Next() {
+		discovery, err := scanDiscovery(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		discoveries = append(discoveries, discovery)
+	}
+
+	return discoveries, rows.Err()
+}
+
+// AdoptDiscoveredBMCs creates hosts for BMCs the discovery found, with the
+// credentials given for each. Rows are reported on like an import, and rows
+// for addresses the discovery didn't find are invalid. Credentials are only
+// sent to a BMC that presents the certificate it had during the scan, which
+// is then pinned.
+func AdoptDiscoveredBMCs(discovery *DBDiscovery, rows []*HostImportRow) []*HostImportResult {
+	found := map[string]string{}
+
+	for _, bmc := range discovery.BMCs {
+		found[bmc.Address] = bmc.Fingerprint
+	}
+
+	results := make([]*HostImportResult, len(rows))
+	adopt := []*HostImportRow{}
+	index := []int{}
+
+	for i, row := range rows {
+		fingerprint, ok := found[row.Address]
+
+		if !ok {
+			results[i] = &HostImportResult{Row: i + 1, Name: row.Name, Status: HostImportInvalid, Error: "address was not found by this discovery"}
+			continue
+		}
+
+		row.fingerprint = fingerprint
+		adopt = append(adopt, row)
+		index = append(index, i)
+	}
+
+	for i, result := range ImportHosts(adopt, false) {
+		result.Row = index[i] + 1
+		results[index[i]] = result
+	}
+
+	return results
+}
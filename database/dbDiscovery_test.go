@@ -0,0 +1,113 @@
+package database
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+func waitForDiscovery(t *testing.T, id int) *DBDiscovery {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		discovery, err := GetDiscovery(id)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if discovery.Status != DiscoveryRunning {
+			return discovery
+		}
+	}
+
+	t.Fatalf("discovery %d didn't finish", id)
+	return nil
+}
+
+func TestDiscovery(t *testing.T) {
+	lib.Config.DiscoveryWorkers = 4
+	lib.Config.DiscoveryTimeout = time.Second
+	lib.Config.DiscoveryMaxAddresses = 256
+
+	bmc := newFakeBMC(t)
+	_, portText, _ := net.SplitHostPort(bmc.Address())
+	port, _ := strconv.Atoi(portText)
+
+	// Nothing else listens on that port in the rest of 127.0.0.0/30
+	started, err := StartDiscovery("127.0.0.0/30", port, "admin@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discovery := waitForDiscovery(t, started.ID)
+
+	if discovery.Status != DiscoveryDone || discovery.Scanned != 2 {
+		t.Errorf("discovery = %s after %d address(es), want %s after 2", discovery.Status, discovery.Scanned, DiscoveryDone)
+	}
+
+	if len(discovery.BMCs) != 1 {
+		t.Fatalf("found %d BMC(s), want 1", len(discovery.BMCs))
+	}
+
+	found := discovery.BMCs[0]
+
+	if found.Address != bmc.Address() || found.Driver != redfish.DellIDRAC.Name() || found.Fingerprint != bmc.Fingerprint() || found.HostName != "" || found.Model != "" {
+		t.Errorf("found %+v", found)
+	}
+
+	if n := bmc.credentialed.Load(); n != 0 {
+		t.Fatalf("scan sent credentials %d time(s)", n)
+	}
+
+	// A BMC with a different certificate at the address never gets the
+	// credentials
+	swapped := *discovery
+	swapped.BMCs = []*DBDiscoveredBMC{{Address: found.Address, Fingerprint: "00:11:22"}}
+
+	results := AdoptDiscoveredBMCs(&swapped, []*HostImportRow{{Name: "discovered-1", Address: found.Address, Username: "root", Password: "calvin"}})
+
+	if results[0].Status != HostImportUnreachable || HostExists("discovered-1") {
+		t.Errorf("adopt with another certificate = %+v", results[0])
+	}
+
+	if n := bmc.credentialed.Load(); n != 0 {
+		t.Fatalf("adopt sent credentials to the wrong certificate %d time(s)", n)
+	}
+
+	results = AdoptDiscoveredBMCs(discovery, []*HostImportRow{
+		{Name: "discovered-1", Address: found.Address, Username: "root", Password: "calvin"},
+		{Name: "discovered-2", Address: "127.0.0.2:" + portText, Username: "root", Password: "calvin"},
+	})
+
+	t.Cleanup(func() { DeleteHost("discovered-1") })
+
+	if results[0].Status != HostImportCreated || results[1].Status != HostImportInvalid {
+		t.Fatalf("adopt = %+v, %+v", results[0], results[1])
+	}
+
+	if bmc.credentialed.Load() == 0 {
+		t.Error("adopt didn't log in")
+	}
+
+	cert, err := GetHostCertificate("discovered-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert == nil || cert.Fingerprint != bmc.Fingerprint() {
+		t.Errorf("pinned %+v, want %s", cert, bmc.Fingerprint())
+	}
+
+	if discovery, err := GetDiscovery(started.ID); err != nil {
+		t.Fatal(err)
+	} else if adopted := discovery.BMCs[0]; adopted.HostName != "discovered-1" || adopted.Model != "PowerEdge R640" || adopted.SerialNumber != "CN0000000000001" {
+		t.Errorf("adopted BMC = %+v", adopted)
+	}
+}
@@ -0,0 +1,494 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+var (
+	ErrFirmwareUpdateHosts    = errors.New("firmware update needs hosts that exist")
+	ErrFirmwareUpdateBusy     = errors.New("host is already being updated")
+	ErrFirmwareUpdateFinished = errors.New("firmware update has already finished")
+)
+
+// A firmware update runs its hosts in batches, one after the other. It fails
+// once more hosts have failed than it allows, and the hosts it didn't get to
+// are skipped. Updates that were running when the server stopped are
+// interrupted, since nothing will finish them.
+const (
+	FirmwareUpdateRunning     = "running"
+	FirmwareUpdateDone        = "done"
+	FirmwareUpdateFailed      = "failed"
+	FirmwareUpdateCancelled   = "cancelled"
+	FirmwareUpdateInterrupted = "interrupted"
+)
+
+const (
+	FirmwareUpdateHostPending     = "pending"
+	FirmwareUpdateHostUpdating    = "updating"
+	FirmwareUpdateHostDone        = "done"
+	FirmwareUpdateHostFailed      = "failed"
+	FirmwareUpdateHostSkipped     = "skipped"
+	FirmwareUpdateHostInterrupted = "interrupted"
+)
+
+// How often the BMC's task is checked while it updates
+const firmwareTaskTick = 30 * time.Second
+
+const FIRMWARE_UPDATES_STATEMENT = `CREATE TABLE IF NOT EXISTS firmware_updates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	image_uri TEXT NOT NULL,
+	batch_size INTEGER NOT NULL,
+	max_failures INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	requested_by TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP
+);`
+
+// Each host of an update, with the BMC task that installs the image and
+// what it last said
+const FIRMWARE_UPDATE_HOSTS_STATEMENT = `CREATE TABLE IF NOT EXISTS firmware_update_hosts (
+	update_id INTEGER NOT NULL,
+	host_name TEXT NOT NULL,
+	batch INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	task TEXT NOT NULL DEFAULT '',
+	percent_complete INTEGER,
+	message TEXT NOT NULL DEFAULT '',
+	start_time TIMESTAMP,
+	end_time TIMESTAMP,
+	PRIMARY KEY (update_id, host_name)
+);`
+
+const FIRMWARE_UPDATE_COLUMNS = `id, image_uri, batch_size, max_failures, status, requested_by, start_time, end_time`
+const FIRMWARE_UPDATE_HOST_COLUMNS = `host_name, batch, status, task, percent_complete, message, start_time, end_time`
+
+const INSERT_FIRMWARE_UPDATE_STATEMENT = `INSERT INTO firmware_updates (image_uri, batch_size, max_failures, status, requested_by, start_time) VALUES (?, ?, ?, ?, ?, ?);`
+const INSERT_FIRMWARE_UPDATE_HOST_STATEMENT = `INSERT INTO firmware_update_hosts (update_id, host_name, batch, status) VALUES (?, ?, ?, ?);`
+const SELECT_FIRMWARE_UPDATE_STATEMENT = `SELECT ` + FIRMWARE_UPDATE_COLUMNS + ` FROM firmware_updates WHERE id = ?;`
+const SELECT_ALL_FIRMWARE_UPDATES_STATEMENT = `SELECT ` + FIRMWARE_UPDATE_COLUMNS + ` FROM firmware_updates ORDER BY id DESC;`
+const SELECT_FIRMWARE_UPDATE_HOSTS_STATEMENT = `SELECT ` + FIRMWARE_UPDATE_HOST_COLUMNS + ` FROM firmware_update_hosts WHERE update_id = ? ORDER BY batch, host_name;`
+const SELECT_FIRMWARE_UPDATE_COUNTS_STATEMENT = `SELECT update_id, status, COUNT(*) FROM firmware_update_hosts GROUP BY update_id, status;`
+const UPDATE_FIRMWARE_UPDATE_END_STATEMENT = `UPDATE firmware_updates SET status = ?, end_time = ? WHERE id = ?;`
+const UPDATE_FIRMWARE_UPDATE_HOST_START_STATEMENT = `UPDATE firmware_update_hosts SET status = ?, start_time = ? WHERE update_id = ? AND host_name = ?;`
+const UPDATE_FIRMWARE_UPDATE_HOST_TASK_STATEMENT = `UPDATE firmware_update_hosts SET task = ?, percent_complete = ?, message = ? WHERE update_id = ? AND host_name = ?;`
+const UPDATE_FIRMWARE_UPDATE_HOST_END_STATEMENT = `UPDATE firmware_update_hosts SET status = ?, message = COALESCE(NULLIF(?, ''), message), end_time = ? WHERE update_id = ? AND host_name = ?;`
+const UPDATE_SKIPPED_FIRMWARE_UPDATE_HOSTS_STATEMENT = `UPDATE firmware_update_hosts SET status = ? WHERE update_id = ? AND status = ?;`
+const UPDATE_INTERRUPTED_FIRMWARE_UPDATES_STATEMENT = `UPDATE firmware_updates SET status = ?, end_time = ? WHERE status = ?;`
+const UPDATE_INTERRUPTED_FIRMWARE_UPDATE_HOSTS_STATEMENT = `UPDATE firmware_update_hosts SET status = CASE status WHEN ? THEN ? ELSE ? END, end_time = ?
+	WHERE status IN (?, ?);`
+
+// Hosts in an update that is running, and updates that have been asked to
+// stop
+var firmwareUpdates = struct {
+	sync.Mutex
+	hosts     map[string]int
+	cancelled map[int]bool
+}{hosts: map[string]int{}, cancelled: map[int]bool{}}
+
+type DBFirmwareUpdate struct {
+	ID          int                     `json:"id"`
+	ImageURI    string                  `json:"image_uri"`
+	BatchSize   int                     `json:"batch_size"`
+	MaxFailures int                     `json:"max_failures"`
+	Status      string                  `json:"status"`
+	RequestedBy string                  `json:"requested_by"`
+	StartTime   time.Time               `json:"start_time"`
+	EndTime     *time.Time              `json:"end_time"`
+	Counts      map[string]int          `json:"counts"`
+	Hosts       []*DBFirmwareUpdateHost `json:"hosts,omitempty"`
+}
+
+func (u *DBFirmwareUpdate) JSON() []byte {
+	json, _ := json.Marshal(u)
+	return json
+}
+
+type DBFirmwareUpdateHost struct {
+	HostName        string     `json:"host_name"`
+	Batch           int        `json:"batch"`
+	Status          string     `json:"status"`
+	Task            string     `json:"task"`
+	PercentComplete *int       `json:"percent_complete"`
+	Message         string     `json:"message"`
+	StartTime       *time.Time `json:"start_time"`
+	EndTime         *time.Time `json:"end_time"`
+}
+
+// StartFirmwareUpdate has the BMCs of hosts install the firmware image at
+// imageURI in the background, batchSize hosts at a time. Each host is put in
+// maintenance while it updates, unless it already was.
+func StartFirmwareUpdate(imageURI string, hosts []string, batchSize, maxFailures int, requestedBy string) (*DBFirmwareUpdate, error) {
+	if len(hosts) == 0 {
+		return nil, ErrFirmwareUpdateHosts
+	}
+
+	for i, name := range hosts {
+		if !HostExists(name) || slices.Contains(hosts[:i], name) {
+			return nil, ErrFirmwareUpdateHosts
+		}
+	}
+
+	firmwareUpdates.Lock()
+	defer firmwareUpdates.Unlock()
+
+	for _, name := range hosts {
+		if _, ok := firmwareUpdates.hosts[name]; ok {
+			return nil, ErrFirmwareUpdateBusy
+		}
+	}
+
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	result, err := tx.Exec(INSERT_FIRMWARE_UPDATE_STATEMENT, imageURI, batchSize, maxFailures, FirmwareUpdateRunning, requestedBy, time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	id64, err := result.LastInsertId()
+
+	if err != nil {
+		return nil, err
+	}
+
+	id := int(id64)
+	batches := [][]string{}
+
+	for start := 0; start < len(hosts); start += batchSize {
+		batch := hosts[start:min(start+batchSize, len(hosts))]
+
+		for _, name := range batch {
+			if _, err := tx.Exec(INSERT_FIRMWARE_UPDATE_HOST_STATEMENT, id, name, len(batches), FirmwareUpdateHostPending); err != nil {
+				return nil, err
+			}
+		}
+
+		batches = append(batches, batch)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range hosts {
+		firmwareUpdates.hosts[name] = id
+	}
+
+	go runFirmwareUpdate(id, imageURI, batches, maxFailures, requestedBy)
+	return GetFirmwareUpdate(id)
+}
+
+// CancelFirmwareUpdate keeps an update from starting any more batches. Hosts
+// that are already updating are left to finish, since stopping a BMC in the
+// middle of flashing is worse.
+func CancelFirmwareUpdate(update *DBFirmwareUpdate) error {
+	if update.Status != FirmwareUpdateRunning {
+		return ErrFirmwareUpdateFinished
+	}
+
+	firmwareUpdates.Lock()
+	firmwareUpdates.cancelled[update.ID] = true
+	firmwareUpdates.Unlock()
+
+	return nil
+}
+
+func runFirmwareUpdate(id int, imageURI string, batches [][]string, maxFailures int, requestedBy string) {
+	lib.Log.Basic(fmt.Sprintf("Firmware update %d started in %d batch(es)", id, len(batches)))
+
+	status := FirmwareUpdateDone
+	failures := 0
+
+	for _, batch := range batches {
+		firmwareUpdates.Lock()
+		cancelled := firmwareUpdates.cancelled[id]
+		firmwareUpdates.Unlock()
+
+		if cancelled {
+			status = FirmwareUpdateCancelled
+			break
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+
+		for _, name := range batch {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if !updateHostFirmware(id, name, imageURI, requestedBy) {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if failures > maxFailures {
+			status = FirmwareUpdateFailed
+			break
+		}
+	}
+
+	if err := QueuedExec(UPDATE_SKIPPED_FIRMWARE_UPDATE_HOSTS_STATEMENT, FirmwareUpdateHostSkipped, id, FirmwareUpdateHostPending); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record skipped hosts of firmware update %d: %s", id, err.Error()))
+	}
+
+	if err := QueuedExec(UPDATE_FIRMWARE_UPDATE_END_STATEMENT, status, time.Now(), id); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record end of firmware update %d: %s", id, err.Error()))
+	}
+
+	firmwareUpdates.Lock()
+	delete(firmwareUpdates.cancelled, id)
+
+	for _, batch := range batches {
+		for _, name := range batch {
+			delete(firmwareUpdates.hosts, name)
+		}
+	}
+
+	firmwareUpdates.Unlock()
+
+	lib.Log.Success(fmt.Sprintf("Firmware update %d %s with %d failure(s)", id, status, failures))
+}
+
+// updateHostFirmware installs the image on one host and waits for its BMC to
+// finish. A host that fails is left in maintenance for an admin to look at.
+func updateHostFirmware(id int, name, imageURI, requestedBy string) bool {
+	if err := QueuedExec(UPDATE_FIRMWARE_UPDATE_HOST_START_STATEMENT, FirmwareUpdateHostUpdating, time.Now(), id, name); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record start of firmware update %d for host %s: %s", id, name, err.Error()))
+	}
+
+	maintenance, err := GetHostMaintenance(name)
+
+	if err != nil {
+		return endHostFirmwareUpdate(id, name, err)
+	}
+
+	if maintenance == nil {
+		updated, err := SetHostMaintenance(name, fmt.Sprintf("Firmware update %d", id), nil, requestedBy)
+
+		if err != nil {
+			return endHostFirmwareUpdate(id, name, err)
+		}
+
+		go NotifyHostMaintenance(name, updated)
+	}
+
+	err = waitHostFirmwareTask(id, name, imageURI)
+
+	if err == nil {
+		pollHostKindNow(name, PollKindHardware)
+
+		if maintenance == nil {
+			if err := EndHostMaintenance(name); err != nil {
+				lib.Log.Error(fmt.Sprintf("Could not return host %s to service: %s", name, err.Error()))
+			} else {
+				go NotifyHostMaintenance(name, nil)
+			}
+		}
+	}
+
+	return endHostFirmwareUpdate(id, name, err)
+}
+
+func waitHostFirmwareTask(id int, name, imageURI string) error {
+	host, err := GetHost(name)
+
+	if err != nil {
+		return err
+	}
+
+	if host == nil {
+		return ErrFirmwareUpdateHosts
+	}
+
+	client, err := host.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	path, err := client.SimpleUpdate(imageURI)
+
+	if err != nil || path == "" {
+		return err
+	}
+
+	deadline := time.Now().Add(lib.Config.FirmwareUpdateTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(firmwareTaskTick)
+
+		// BMCs restart to finish updating their own firmware, so not
+		// hearing back for a while is expected
+		task, err := client.Task(path)
+
+		if err != nil {
+			lib.Log.Warning(fmt.Sprintf("Could not check firmware update task of host %s: %s", name, err.Error()))
+			continue
+		}
+
+		if err := QueuedExec(UPDATE_FIRMWARE_UPDATE_HOST_TASK_STATEMENT, path, task.PercentComplete, task.Message(), id, name); err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not record firmware update task of host %s: %s", name, err.Error()))
+		}
+
+		if !task.Done() {
+			continue
+		}
+
+		if task.Failed() {
+			return errors.New(task.Message())
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("gave up after %s", lib.Config.FirmwareUpdateTimeout)
+}
+
+func endHostFirmwareUpdate(id int, name string, updateErr error) bool {
+	status, message := FirmwareUpdateHostDone, ""
+
+	if updateErr != nil {
+		status, message = FirmwareUpdateHostFailed, updateErr.Error()
+		lib.Log.Warning(fmt.Sprintf("Firmware update %d failed for host %s: %s", id, name, message))
+	}
+
+	if err := QueuedExec(UPDATE_FIRMWARE_UPDATE_HOST_END_STATEMENT, status, message, time.Now(), id, name); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record end of firmware update %d for host %s: %s", id, name, err.Error()))
+	}
+
+	return updateErr == nil
+}
+
+// EndInterruptedFirmwareUpdates marks the updates that were running when the
+// server last stopped. Their hosts stay in maintenance, since whether their
+// firmware was updated isn't known.
+func EndInterruptedFirmwareUpdates() error {
+	now := time.Now()
+
+	if err := QueuedExec(UPDATE_INTERRUPTED_FIRMWARE_UPDATE_HOSTS_STATEMENT, FirmwareUpdateHostUpdating, FirmwareUpdateHostInterrupted, FirmwareUpdateHostSkipped, now, FirmwareUpdateHostUpdating, FirmwareUpdateHostPending); err != nil {
+		return err
+	}
+
+	return QueuedExec(UPDATE_INTERRUPTED_FIRMWARE_UPDATES_STATEMENT, FirmwareUpdateInterrupted, now, FirmwareUpdateRunning)
+}
+
+// GetFirmwareUpdate returns an update with each of its hosts
+func GetFirmwareUpdate(id int) (*DBFirmwareUpdate, error) {
+	updates, err := queryFirmwareUpdates(SELECT_FIRMWARE_UPDATE_STATEMENT, id)
+
+	if err != nil || len(updates) == 0 {
+		return nil, err
+	}
+
+	update := updates[0]
+	update.Hosts = []*DBFirmwareUpdateHost{}
+
+	err = queryEach(SELECT_FIRMWARE_UPDATE_HOSTS_STATEMENT, id, func(rows *sql.Rows) error {
+		var h DBFirmwareUpdateHost
+		var percent sql.NullInt64
+		var start, end sql.NullTime
+
+		if err := rows.Scan(&h.HostName, &h.Batch, &h.Status, &h.Task, &percent, &h.Message, &start, &end); err != nil {
+			return err
+		}
+
+		if percent.Valid {
+			p := int(percent.Int64)
+			h.PercentComplete = &p
+		}
+
+		h.StartTime = nullTime(start)
+		h.EndTime = nullTime(end)
+		update.Hosts = append(update.Hosts, &h)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return update, nil
+}
+
+// ListFirmwareUpdates lists every update with how many of its hosts are in
+// each status, without the hosts themselves
+func ListFirmwareUpdates() ([]*DBFirmwareUpdate, error) {
+	return queryFirmwareUpdates(SELECT_ALL_FIRMWARE_UPDATES_STATEMENT)
+}
+
+func queryFirmwareUpdates(query string, args ...interface{}) ([]*DBFirmwareUpdate, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	updates := []*DBFirmwareUpdate{}
+	byID := map[int]*DBFirmwareUpdate{}
+
+	for rows.Next() {
+		var u DBFirmwareUpdate
+		var end sql.NullTime
+
+		if err := rows.Scan(&u.ID, &u.ImageURI, &u.BatchSize, &u.MaxFailures, &u.Status, &u.RequestedBy, &u.StartTime, &end); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		u.EndTime = nullTime(end)
+		u.Counts = map[string]int{}
+		updates = append(updates, &u)
+		byID[u.ID] = &u
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = QueuedQuery(SELECT_FIRMWARE_UPDATE_COUNTS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var status string
+
+		if err := rows.Scan(&id, &status, &count); err != nil {
+			return nil, err
+		}
+
+		if update, ok := byID[id]; ok {
+			update.Counts[status] = count
+		}
+	}
+
+	return updates, rows.Err()
+}
@@ -1,8 +1,14 @@
 package database
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
 )
 
 var ErrHostExists = errors.New("host already exists")
@@ -22,10 +28,14 @@ const HOSTS_STATEMENT = `CREATE TABLE IF NOT EXISTS hosts (
 	ipmi_username TEXT NOT NULL,
 	ipmi_password TEXT NOT NULL,
 	ipmi_redfish_version INTEGER NOT NULL
-);`
+);
+CREATE INDEX IF NOT EXISTS hosts_health ON hosts (health);
+CREATE INDEX IF NOT EXISTS hosts_cpu_cores ON hosts (cpu_cores);
+CREATE INDEX IF NOT EXISTS hosts_memory_total_mib ON hosts (memory_total_mib);`
 
 const INSERT_HOST_STATEMENT = `INSERT INTO hosts (name, health, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps, ipmi_address, ipmi_username, ipmi_password, ipmi_redfish_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
 const SELECT_HOST_STATEMENT = `SELECT name, health, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps, ipmi_address, ipmi_username, ipmi_password, ipmi_redfish_version FROM hosts WHERE name = ?;`
+const SELECT_ALL_HOSTS_STATEMENT = `SELECT name, health, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps, ipmi_address, ipmi_username, ipmi_password, ipmi_redfish_version FROM hosts ORDER BY name;`
 const DELETE_HOST_STATEMENT = `DELETE FROM hosts WHERE name = ?;`
 const UPDATE_HOST_HEALTH_STATEMENT = `UPDATE hosts SET health = ? WHERE name = ?;`
 const UPDATE_HOST_SPECS_STATEMENT = `UPDATE hosts SET cpu_count = ?, cpu_speed_mhz = ?, cpu_cores = ?, memory_total_mib = ?, memory_speed_mhz = ?, virtual_storage_size_mib = ? WHERE name = ?;`
@@ -37,14 +47,84 @@ const (
 	HostHealthDegraded
 	HostHealthBad
 	HostHealthUnknown
+	HostHealthUnreachable
 )
 
+func HostHealthName(health int) string {
+	switch health {
+	case HostHealthGood:
+		return "Good"
+	case HostHealthDegraded:
+		return "Degraded"
+	case HostHealthBad:
+		return "Bad"
+	case HostHealthUnreachable:
+		return "Unreachable"
+	default:
+		return "Unknown"
+	}
+}
+
+// HostHealthFromName is the reverse of HostHealthName, ignoring case
+func HostHealthFromName(name string) (int, bool) {
+	for _, health := range []int{HostHealthGood, HostHealthDegraded, HostHealthBad, HostHealthUnknown, HostHealthUnreachable} {
+		if strings.EqualFold(HostHealthName(health), name) {
+			return health, true
+		}
+	}
+
+	return 0, false
+}
+
 const (
 	HostRedfishVersion_Dell_iDRAC_7 = iota
 	HostRedfishVersion_Dell_iDRAC_8
 	HostRedfishVersion_Dell_iDRAC_9
+	HostRedfishVersion_HPE_iLO
+	HostRedfishVersion_Supermicro
+	HostRedfishVersion_Lenovo_XCC
+	HostRedfishVersion_Generic
 )
 
+var hostRedfishDrivers = map[int]redfish.Driver{
+	HostRedfishVersion_Dell_iDRAC_7: redfish.DellIDRAC,
+	HostRedfishVersion_Dell_iDRAC_8: redfish.DellIDRAC,
+	HostRedfishVersion_Dell_iDRAC_9: redfish.DellIDRAC,
+	HostRedfishVersion_HPE_iLO:      redfish.HPEiLO,
+	HostRedfishVersion_Supermicro:   redfish.Supermicro,
+	HostRedfishVersion_Lenovo_XCC:   redfish.LenovoXCC,
+	HostRedfishVersion_Generic:      redfish.Generic,
+}
+
+func IsRedfishVersionValid(version int) bool {
+	_, ok := hostRedfishDrivers[version]
+	return ok
+}
+
+// hostRedfishVersionFor turns a detected driver back into the value stored
+// in ipmi_redfish_version
+func hostRedfishVersionFor(driver redfish.Driver, info *redfish.BMCInfo) int {
+	switch driver {
+	case redfish.DellIDRAC:
+		switch redfish.DellGeneration(info) {
+		case 7:
+			return HostRedfishVersion_Dell_iDRAC_7
+		case 8:
+			return HostRedfishVersion_Dell_iDRAC_8
+		default:
+			return HostRedfishVersion_Dell_iDRAC_9
+		}
+	case redfish.HPEiLO:
+		return HostRedfishVersion_HPE_iLO
+	case redfish.Supermicro:
+		return HostRedfishVersion_Supermicro
+	case redfish.LenovoXCC:
+		return HostRedfishVersion_Lenovo_XCC
+	default:
+		return HostRedfishVersion_Generic
+	}
+}
+
 type DBHost struct {
 	Name     string `json:"name"`
 	Health   int    `json:"health"`
@@ -70,6 +150,8 @@ type DBHost struct {
 		Password       string `json:"-"`
 		RedfishVersion int    `json:"-"`
 	} `json:"-"`
+	Labels      map[string]string  `json:"labels,omitempty"`
+	Maintenance *DBHostMaintenance `json:"maintenance,omitempty"`
 }
 
 func (h *DBHost) JSON() []byte {
@@ -93,6 +175,12 @@ func CreateHost(name string, health int, cpuCount, cpuSpeedMHz, cpuCores, memory
 		return nil, ErrHostExists
 	}
 
+	ipmiUsername, ipmiPassword, err := encryptCredentials(lib.BMCKey, name, ipmiUsername, ipmiPassword)
+
+	if err != nil {
+		return nil, err
+	}
+
 	if err := QueuedExec(INSERT_HOST_STATEMENT, name, health, cpuCount, cpuSpeedMHz, cpuCores, memoryTotalMiB, memorySpeedMHz, virtualStorageSizeMiB, networkingProvider, networkingSpeedMbps, ipmiAddress, ipmiUsername, ipmiPassword, ipmiRedfishVersion); err != nil {
 		return nil, err
 	}
@@ -113,8 +201,36 @@ func GetHost(name string) (*DBHost, error) {
 		return nil, nil
 	}
 
+	return scanHost(rows)
+}
+
+func ListHosts() ([]*DBHost, error) {
+	rows, err := QueuedQuery(SELECT_ALL_HOSTS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hosts := []*DBHost{}
+
+	for rows.Next() {
+		host, err := scanHost(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	return hosts, rows.Err()
+}
+
+func scanHost(rows *sql.Rows) (*DBHost, error) {
 	var host DBHost
-	err = rows.Scan(&host.Name, &host.Health, &host.Hardware.CPU.Count, &host.Hardware.CPU.SpeedMHz, &host.Hardware.CPU.Cores, &host.Hardware.Memory.SizeMiB, &host.Hardware.Memory.SpeedMHz, &host.Hardware.VirtualStorageSizeMiB, &host.Networking.Provider, &host.Networking.SpeedMbps, &host.IPMI.Address, &host.IPMI.Username, &host.IPMI.Password, &host.IPMI.RedfishVersion)
+	err := rows.Scan(&host.Name, &host.Health, &host.Hardware.CPU.Count, &host.Hardware.CPU.SpeedMHz, &host.Hardware.CPU.Cores, &host.Hardware.Memory.SizeMiB, &host.Hardware.Memory.SpeedMHz, &host.Hardware.VirtualStorageSizeMiB, &host.Networking.Provider, &host.Networking.SpeedMbps, &host.IPMI.Address, &host.IPMI.Username, &host.IPMI.Password, &host.IPMI.RedfishVersion)
 
 	if err != nil {
 		return nil, err
@@ -124,7 +240,21 @@ func GetHost(name string) (*DBHost, error) {
 }
 
 func DeleteHost(name string) error {
-	return QueuedExec(DELETE_HOST_STATEMENT, name)
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, statement := range []string{DELETE_HOST_HEALTH_COMPONENTS_STATEMENT, DELETE_HOST_POLLS_STATEMENT, DELETE_HOST_ISSUES_STATEMENT, DELETE_HOST_BMC_STATEMENT, DELETE_HOST_INVENTORY_STATEMENT, DELETE_HOST_TELEMETRY_STATEMENT, DELETE_HOST_TELEMETRY_HOURLY_STATEMENT, DELETE_HOST_EVENT_LOGS_STATEMENT, DELETE_HOST_INTERFACES_STATEMENT, DELETE_HOST_PORTS_STATEMENT, DELETE_HOST_PORT_ANNOTATIONS_STATEMENT, DELETE_HOST_STORAGE_CONTROLLERS_STATEMENT, DELETE_HOST_DRIVES_STATEMENT, DELETE_HOST_VOLUMES_STATEMENT, DELETE_HOST_FIRMWARE_STATEMENT, DELETE_HOST_BIOS_STATEMENT, DELETE_HOST_BIOS_APPLY_STATEMENT, DELETE_HOST_EVENT_SUBSCRIPTION_STATEMENT, DELETE_HOST_CERTIFICATE_STATEMENT, DELETE_HOST_SSH_KEY_STATEMENT, DELETE_HOST_PROVISION_STATEMENT, DELETE_HOST_LABELS_STATEMENT, DELETE_HOST_MAINTENANCE_STATEMENT, DELETE_HOST_USERS_STATEMENT, DELETE_HOST_STATEMENT} {
+		if _, err := tx.Exec(statement, name); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 func UpdateHostHealth(name string, health int) error {
@@ -140,13 +270,140 @@ func UpdateHostNetworking(name, provider string, speedMbps int) error {
 }
 
 func UpdateHostIPMI(name, address, username, password string, redfishVersion int) error {
+	username, password, err := encryptCredentials(lib.BMCKey, name, username, password)
+
+	if err != nil {
+		return err
+	}
+
 	return QueuedExec(UPDATE_HOST_IPMI_STATEMENT, address, username, password, redfishVersion, name)
 }
 
-func (h *DBHost) PollHealth() {
+func (h *DBHost) redfishClient() (*redfish.Client, error) {
+	username, password, err := h.Credentials()
 
+	if err != nil {
+		return nil, err
+	}
+
+	client := redfish.NewClient(h.IPMI.Address, username, password)
+
+	if driver, ok := hostRedfishDrivers[h.IPMI.RedfishVersion]; ok {
+		client.Driver = driver
+	}
+
+	// Whatever the client is used for, admins hear about a refused
+	// certificate
+	client.OnCertificateError = func(certErr *redfish.CertificateError) {
+		if err := h.reportCertificateError(certErr); err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not report certificate of host %s: %s", h.Name, err.Error()))
+		}
+	}
+
+	if err := h.trustHostCertificate(client); err != nil {
+		return nil, err
+	}
+
+	return client, nil
 }
 
-func (h *DBHost) PollHardware() {
+// PollHardware queries the BMC for the host's specs and stores them
+func (h *DBHost) PollHardware() error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	inv, err := client.Inventory()
+
+	if err != nil {
+		return err
+	}
+
+	if err := h.recordInventory(inv); err != nil {
+		return err
+	}
+
+	if err := SetHostInterfaces(h.Name, inv.Interfaces); err != nil {
+		return err
+	}
+
+	// Parts of the BMC that can't be read are reported, without holding up
+	// the rest of the poll
+	found := []*DBHostIssue{}
+
+	// Ports stay as last read rather than losing those of the adapters that
+	// failed
+	if len(inv.PortErrors) > 0 {
+		messages := []string{}
+
+		for _, err := range inv.PortErrors {
+			messages = append(messages, err.Error())
+		}
+
+		message := strings.Join(messages, "; ")
+
+		lib.Log.Warning(fmt.Sprintf("Could not read network adapters of host %s: %s", h.Name, message))
+		found = append(found, &DBHostIssue{
+			Component: "Network adapters",
+			Severity:  HostHealthUnknown,
+			Message:   "Could not read network adapters: " + message,
+		})
+	} else if err := SetHostPorts(h.Name, inv.Ports); err != nil {
+		return err
+	}
+
+	if err := SetHostStorage(h.Name, inv); err != nil {
+		return err
+	}
+
+	if err := h.reportDriveIssues(inv.Drives); err != nil {
+		return err
+	}
+
+	if firmware, err := client.FirmwareInventory(); err != nil {
+		lib.Log.Warning(fmt.Sprintf("Could not read firmware of host %s: %s", h.Name, err.Error()))
+		found = append(found, &DBHostIssue{
+			Component: "Firmware inventory",
+			Severity:  HostHealthUnknown,
+			Message:   "Could not read firmware inventory: " + err.Error(),
+		})
+	} else if err := SetHostFirmware(h.Name, firmware); err != nil {
+		return err
+	}
+
+	if err := ReportHostIssues(h.Name, IssueSourceHardware, found); err != nil {
+		return err
+	}
+
+	if err := h.pollBIOS(client); err != nil {
+		return err
+	}
+
+	// Firmware changes with BMC updates, so keep what was detected current
+	if _, info, err := client.Detect(); err == nil {
+		if err := SetHostBMC(h.Name, client.Driver, info); err != nil {
+			return err
+		}
+	}
+
+	if err := UpdateHostSpecs(h.Name, inv.CPUCount, inv.CPUSpeedMHz, inv.CPUCores, inv.MemoryTotalMiB, inv.MemorySpeedMHz, inv.VirtualStorageSizeMiB); err != nil {
+		return err
+	}
+
+	if err := UpdateHostNetworking(h.Name, inv.NetworkingProvider, inv.NetworkingSpeedMbps); err != nil {
+		return err
+	}
+
+	h.Hardware.CPU.Count = inv.CPUCount
+	h.Hardware.CPU.SpeedMHz = inv.CPUSpeedMHz
+	h.Hardware.CPU.Cores = inv.CPUCores
+	h.Hardware.Memory.SizeMiB = inv.MemoryTotalMiB
+	h.Hardware.Memory.SpeedMHz = inv.MemorySpeedMHz
+	h.Hardware.VirtualStorageSizeMiB = inv.VirtualStorageSizeMiB
+	h.Networking.Provider = inv.NetworkingProvider
+	h.Networking.SpeedMbps = inv.NetworkingSpeedMbps
 
+	return nil
 }
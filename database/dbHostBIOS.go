@@ -0,0 +1,343 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+var ErrBIOSApplyBusy = errors.New("a bios profile is already being applied to the host")
+
+// Applying a profile takes a reset and one or more reboots while the BIOS
+// takes the settings in. Applies that were running when the server stopped
+// are interrupted, since nothing will finish them.
+const (
+	BIOSApplyApplying    = "applying"
+	BIOSApplyApplied     = "applied"
+	BIOSApplyFailed      = "failed"
+	BIOSApplyInterrupted = "interrupted"
+)
+
+// How often the BIOS is read while a profile is applied
+var biosApplyTick = 30 * time.Second
+
+// Each host's BIOS attributes as of the last hardware poll, as a JSON object
+const HOST_BIOS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_bios (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	attributes TEXT NOT NULL,
+	read_time TIMESTAMP NOT NULL
+);`
+
+// The last profile applied to each host. network_boot is set when the host
+// is being provisioned, and boots the installer once the profile is applied.
+const HOST_BIOS_APPLIES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_bios_applies (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	profile TEXT NOT NULL,
+	status TEXT NOT NULL,
+	message TEXT NOT NULL,
+	network_boot INTEGER NOT NULL,
+	requested_by TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP
+);`
+
+const HOST_BIOS_APPLY_COLUMNS = `host_name, profile, status, message, network_boot, requested_by, start_time, end_time`
+
+const UPSERT_HOST_BIOS_STATEMENT = `INSERT INTO host_bios (host_name, attributes, read_time) VALUES (?, ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET attributes = excluded.attributes, read_time = excluded.read_time;`
+const SELECT_HOST_BIOS_STATEMENT = `SELECT host_name, attributes, read_time FROM host_bios WHERE host_name = ?;`
+const SELECT_ALL_HOST_BIOS_STATEMENT = `SELECT host_name, attributes, read_time FROM host_bios ORDER BY host_name;`
+const DELETE_HOST_BIOS_STATEMENT = `DELETE FROM host_bios WHERE host_name = ?;`
+
+const INSERT_HOST_BIOS_APPLY_STATEMENT = `INSERT OR REPLACE INTO host_bios_applies (` + HOST_BIOS_APPLY_COLUMNS + `) VALUES (?, ?, ?, '', ?, ?, ?, NULL);`
+const SELECT_HOST_BIOS_APPLY_STATEMENT = `SELECT ` + HOST_BIOS_APPLY_COLUMNS + ` FROM host_bios_applies WHERE host_name = ?;`
+const UPDATE_HOST_BIOS_APPLY_MESSAGE_STATEMENT = `UPDATE host_bios_applies SET message = ? WHERE host_name = ?;`
+const UPDATE_HOST_BIOS_APPLY_END_STATEMENT = `UPDATE host_bios_applies SET status = ?, message = ?, end_time = ? WHERE host_name = ?;`
+const UPDATE_INTERRUPTED_BIOS_APPLIES_STATEMENT = `UPDATE host_bios_applies SET status = ?, end_time = ? WHERE status = ?;`
+const DELETE_HOST_BIOS_APPLY_STATEMENT = `DELETE FROM host_bios_applies WHERE host_name = ?;`
+
+// Hosts a profile is being applied to
+var biosApplies = struct {
+	sync.Mutex
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+type DBHostBIOS struct {
+	HostName   string                 `json:"-"`
+	Attributes map[string]interface{} `json:"attributes"`
+	ReadTime   time.Time              `json:"read_time"`
+}
+
+type DBHostBIOSApply struct {
+	HostName    string     `json:"-"`
+	Profile     string     `json:"profile"`
+	Status      string     `json:"status"`
+	Message     string     `json:"message"`
+	NetworkBoot bool       `json:"network_boot"`
+	RequestedBy string     `json:"requested_by"`
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+}
+
+func (a *DBHostBIOSApply) JSON() []byte {
+	json, _ := json.Marshal(a)
+	return json
+}
+
+func SetHostBIOS(name string, attributes map[string]interface{}) error {
+	data, err := json.Marshal(attributes)
+
+	if err != nil {
+		return err
+	}
+
+	return QueuedExec(UPSERT_HOST_BIOS_STATEMENT, name, string(data), time.Now())
+}
+
+// GetHostBIOS is nil for hosts whose BIOS hasn't been read
+func GetHostBIOS(name string) (*DBHostBIOS, error) {
+	bios, err := queryHostBIOS(SELECT_HOST_BIOS_STATEMENT, name)
+
+	if err != nil || len(bios) == 0 {
+		return nil, err
+	}
+
+	return bios[0], nil
+}
+
+func ListHostBIOS() ([]*DBHostBIOS, error) {
+	return queryHostBIOS(SELECT_ALL_HOST_BIOS_STATEMENT)
+}
+
+func queryHostBIOS(query string, args ...interface{}) ([]*DBHostBIOS, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	bios := []*DBHostBIOS{}
+
+	for rows.Next() {
+		var b DBHostBIOS
+		var attributes string
+
+		if err := rows.Scan(&b.HostName, &attributes, &b.ReadTime); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(attributes), &b.Attributes); err != nil {
+			return nil, err
+		}
+
+		bios = append(bios, &b)
+	}
+
+	return bios, rows.Err()
+}
+
+// pollBIOS reads the host's BIOS attributes with the hardware poll. BMCs
+// that don't expose them are left out.
+func (h *DBHost) pollBIOS(client *redfish.Client) error {
+	bios, err := client.Bios()
+
+	if errors.Is(err, redfish.ErrBIOSUnsupported) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return SetHostBIOS(h.Name, bios.Attributes)
+}
+
+func GetHostBIOSApply(name string) (*DBHostBIOSApply, error) {
+	rows, err := QueuedQuery(SELECT_HOST_BIOS_APPLY_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var a DBHostBIOSApply
+	var end sql.NullTime
+
+	if err := rows.Scan(&a.HostName, &a.Profile, &a.Status, &a.Message, &a.NetworkBoot, &a.RequestedBy, &a.StartTime, &end); err != nil {
+		return nil, err
+	}
+
+	a.EndTime = nullTime(end)
+	return &a, nil
+}
+
+// ApplyBIOSProfile changes the host's BIOS attributes that differ from the
+// profile in the background, resetting the host for them to take. A
+// provision waiting for the profile is armed once it is applied, and with
+// networkBoot the host then network boots into the installer. The provision
+// fails if the profile can't be applied.
+func (h *DBHost) ApplyBIOSProfile(profile *DBBIOSProfile, networkBoot bool, requestedBy string) (*DBHostBIOSApply, error) {
+	biosApplies.Lock()
+
+	if biosApplies.hosts[h.Name] {
+		biosApplies.Unlock()
+		return nil, ErrBIOSApplyBusy
+	}
+
+	biosApplies.hosts[h.Name] = true
+	biosApplies.Unlock()
+
+	if err := QueuedExec(INSERT_HOST_BIOS_APPLY_STATEMENT, h.Name, profile.Name, BIOSApplyApplying, networkBoot, requestedBy, time.Now()); err != nil {
+		releaseBIOSApply(h.Name)
+		return nil, err
+	}
+
+	go h.runBIOSApply(profile, networkBoot)
+	return GetHostBIOSApply(h.Name)
+}
+
+// BIOSApplyRunning reports whether a profile is being applied to the host
+func BIOSApplyRunning(name string) bool {
+	biosApplies.Lock()
+	defer biosApplies.Unlock()
+
+	return biosApplies.hosts[name]
+}
+
+func releaseBIOSApply(name string) {
+	biosApplies.Lock()
+	delete(biosApplies.hosts, name)
+	biosApplies.Unlock()
+}
+
+func (h *DBHost) runBIOSApply(profile *DBBIOSProfile, networkBoot bool) {
+	defer releaseBIOSApply(h.Name)
+
+	lib.Log.Basic(fmt.Sprintf("Applying BIOS profile %s to host %s", profile.Name, h.Name))
+
+	status, message := BIOSApplyApplied, ""
+	err := h.applyBIOSProfile(profile)
+
+	if err != nil {
+		if failErr := FailHostProvision(h.Name); failErr != nil {
+			lib.Log.Error(fmt.Sprintf("Could not fail provision of host %s: %s", h.Name, failErr.Error()))
+		}
+	} else if err = armHostProvision(h.Name); err == nil && networkBoot {
+		if err = h.NetworkBoot(); err != nil {
+			err = fmt.Errorf("profile applied, but network boot failed: %w", err)
+		}
+	}
+
+	if err != nil {
+		status, message = BIOSApplyFailed, err.Error()
+		lib.Log.Warning(fmt.Sprintf("Could not apply BIOS profile %s to host %s: %s", profile.Name, h.Name, message))
+	} else {
+		lib.Log.Success(fmt.Sprintf("Applied BIOS profile %s to host %s", profile.Name, h.Name))
+	}
+
+	if err := QueuedExec(UPDATE_HOST_BIOS_APPLY_END_STATEMENT, status, message, time.Now(), h.Name); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record BIOS profile of host %s: %s", h.Name, err.Error()))
+	}
+}
+
+func (h *DBHost) applyBIOSProfile(profile *DBBIOSProfile) error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	bios, err := client.Bios()
+
+	if err != nil {
+		return err
+	}
+
+	drift := profile.Drift(bios.Attributes)
+
+	if len(drift) == 0 {
+		return SetHostBIOS(h.Name, bios.Attributes)
+	}
+
+	changes := map[string]interface{}{}
+
+	for _, d := range drift {
+		changes[d.Attribute] = d.Expected
+	}
+
+	if err := client.SetBiosAttributes(changes); err != nil {
+		return err
+	}
+
+	status, err := client.PowerStatus()
+
+	if err != nil {
+		return err
+	}
+
+	action := "on"
+
+	if status.PowerState == "On" {
+		action = "reset"
+	}
+
+	if _, err := client.Power(action); err != nil {
+		return err
+	}
+
+	h.setBIOSApplyMessage(fmt.Sprintf("Waiting for %d attribute(s) to change", len(drift)))
+
+	deadline := time.Now().Add(lib.Config.BIOSApplyTimeout)
+
+	for time.Now().Before(deadline) {
+		time.Sleep(biosApplyTick)
+
+		// The BMC may not answer while the host reboots
+		bios, err := client.Bios()
+
+		if err != nil {
+			continue
+		}
+
+		if err := SetHostBIOS(h.Name, bios.Attributes); err != nil {
+			return err
+		}
+
+		if drift = profile.Drift(bios.Attributes); len(drift) == 0 {
+			return nil
+		}
+
+		h.setBIOSApplyMessage(fmt.Sprintf("Waiting for %d attribute(s) to change", len(drift)))
+	}
+
+	return fmt.Errorf("%d attribute(s) still differ after %s", len(drift), lib.Config.BIOSApplyTimeout)
+}
+
+func (h *DBHost) setBIOSApplyMessage(message string) {
+	if err := QueuedExec(UPDATE_HOST_BIOS_APPLY_MESSAGE_STATEMENT, message, h.Name); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record BIOS profile progress of host %s: %s", h.Name, err.Error()))
+	}
+}
+
+// EndInterruptedBIOSApplies marks the profiles that were being applied when
+// the server last stopped, and fails the provisions waiting for them
+func EndInterruptedBIOSApplies() error {
+	if err := QueuedExec(UPDATE_INTERRUPTED_BIOS_APPLIES_STATEMENT, BIOSApplyInterrupted, time.Now(), BIOSApplyApplying); err != nil {
+		return err
+	}
+
+	return QueuedExec(UPDATE_WAITING_HOST_PROVISIONS_STATEMENT, ProvisionFailed, time.Now(), ProvisionWaitingBIOS)
+}
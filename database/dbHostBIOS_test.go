@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+const (
+	testSystemPath = "/redfish/v1/Systems/System.Embedded.1"
+	testBiosPath   = testSystemPath + "/Bios"
+	testResetPath  = testSystemPath + "/Actions/ComputerSystem.Reset"
+)
+
+// biosBMC is an iDRAC whose BIOS settings take when the system resets. It
+// notes each change made to the host along with the status of the host's
+// provision at the time.
+type biosBMC struct {
+	*fakeBMC
+
+	mu     sync.Mutex
+	events [][2]string
+}
+
+func newBIOSBMC(t *testing.T, name string) *biosBMC {
+	t.Helper()
+
+	bmc := &biosBMC{fakeBMC: newFakeBMC(t)}
+
+	var system map[string]interface{}
+
+	if err := json.Unmarshal(bmc.resources[testSystemPath], &system); err != nil {
+		t.Fatal(err)
+	}
+
+	system["Bios"] = map[string]string{"@odata.id": testBiosPath}
+	system["Actions"] = map[string]interface{}{
+		"#ComputerSystem.Reset": map[string]interface{}{
+			"target":                            testResetPath,
+			"ResetType@Redfish.AllowableValues": []string{"On", "ForceOff", "ForceRestart", "GracefulShutdown"},
+		},
+	}
+
+	bmc.Set(testSystemPath, system)
+
+	attributes := map[string]interface{}{"ProcVirtualization": "Disabled", "BootMode": "Uefi"}
+	staged := map[string]interface{}{}
+
+	setBios := func() {
+		bmc.Set(testBiosPath, map[string]interface{}{
+			"@odata.id":  testBiosPath,
+			"Attributes": attributes,
+			"@Redfish.Settings": map[string]interface{}{
+				"SettingsObject": map[string]string{"@odata.id": testBiosPath + "/Settings"},
+			},
+		})
+	}
+
+	setBios()
+
+	bmc.Handle("PATCH", testBiosPath+"/Settings", func(body map[string]interface{}) int {
+		bmc.note(t, name, "stage bios")
+
+		for attribute, value := range body["Attributes"].(map[string]interface{}) {
+			staged[attribute] = value
+		}
+
+		return http.StatusOK
+	})
+
+	bmc.Handle("POST", "/redfish/v1/Managers/iDRAC.Embedded.1/Jobs", func(body map[string]interface{}) int {
+		return http.StatusOK
+	})
+
+	bmc.Handle("POST", testResetPath, func(body map[string]interface{}) int {
+		bmc.note(t, name, "reset")
+
+		for attribute, value := range staged {
+			attributes[attribute] = value
+		}
+
+		clear(staged)
+		setBios()
+		return http.StatusNoContent
+	})
+
+	bmc.Handle("PATCH", testSystemPath, func(body map[string]interface{}) int {
+		bmc.note(t, name, "boot once")
+		return http.StatusOK
+	})
+
+	return bmc
+}
+
+func (b *biosBMC) note(t *testing.T, name, event string) {
+	status := ""
+
+	if provision, err := GetHostProvision(name); err != nil {
+		t.Error(err)
+	} else if provision != nil {
+		status = provision.Status
+	}
+
+	b.mu.Lock()
+	b.events = append(b.events, [2]string{event, status})
+	b.mu.Unlock()
+}
+
+func waitForBIOSApply(t *testing.T, name string) *DBHostBIOSApply {
+	t.Helper()
+
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		apply, err := GetHostBIOSApply(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if apply != nil && apply.Status != BIOSApplyApplying && !BIOSApplyRunning(name) {
+			return apply
+		}
+	}
+
+	t.Fatalf("bios profile of %s wasn't applied", name)
+	return nil
+}
+
+func createBIOSHost(t *testing.T, name string, bmc *biosBMC) *DBHost {
+	t.Helper()
+
+	host, err := CreateHost(name, HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost(name) })
+
+	if _, err := CreateHostProvision(name, "debian", "user@example.com", "user@example.com", "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	return host
+}
+
+var testBIOSProfile = &DBBIOSProfile{Name: "kvm", Attributes: map[string]interface{}{"ProcVirtualization": "Enabled"}}
+
+// The installer is only armed once the profile has taken, so the reset that
+// applies it can't boot into it
+func TestProvisionWaitsForBIOS(t *testing.T) {
+	defer func(tick time.Duration) { biosApplyTick = tick }(biosApplyTick)
+	biosApplyTick = 10 * time.Millisecond
+	lib.Config.BIOSApplyTimeout = 10 * time.Second
+
+	bmc := newBIOSBMC(t, "bios-1")
+	host := createBIOSHost(t, "bios-1", bmc)
+
+	if _, err := host.ApplyBIOSProfile(testBIOSProfile, true, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if apply := waitForBIOSApply(t, "bios-1"); apply.Status != BIOSApplyApplied {
+		t.Fatalf("apply = %+v", apply)
+	}
+
+	want := [][2]string{
+		{"stage bios", ProvisionWaitingBIOS},
+		{"reset", ProvisionWaitingBIOS},
+		{"boot once", ProvisionPending},
+		{"reset", ProvisionPending},
+	}
+
+	bmc.mu.Lock()
+	events := bmc.events
+	bmc.mu.Unlock()
+
+	if len(events) != len(want) {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, events[i], want[i])
+		}
+	}
+
+	if bios, err := GetHostBIOS("bios-1"); err != nil {
+		t.Fatal(err)
+	} else if bios.Attributes["ProcVirtualization"] != "Enabled" {
+		t.Errorf("bios = %+v", bios.Attributes)
+	}
+}
+
+func TestProvisionFailsWithBIOS(t *testing.T) {
+	bmc := newBIOSBMC(t, "bios-2")
+	host := createBIOSHost(t, "bios-2", bmc)
+
+	bmc.Handle("PATCH", testBiosPath+"/Settings", func(body map[string]interface{}) int {
+		return http.StatusBadRequest
+	})
+
+	if _, err := host.ApplyBIOSProfile(testBIOSProfile, true, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if apply := waitForBIOSApply(t, "bios-2"); apply.Status != BIOSApplyFailed {
+		t.Errorf("apply = %+v", apply)
+	}
+
+	if provision, err := GetHostProvision("bios-2"); err != nil {
+		t.Fatal(err)
+	} else if provision.Status != ProvisionFailed {
+		t.Errorf("provision = %s, want %s", provision.Status, ProvisionFailed)
+	}
+
+	bmc.mu.Lock()
+	defer bmc.mu.Unlock()
+
+	if len(bmc.events) != 0 {
+		t.Errorf("events = %q", bmc.events)
+	}
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+const HOST_BMC_STATEMENT = `CREATE TABLE IF NOT EXISTS host_bmc (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	driver TEXT NOT NULL,
+	vendor TEXT NOT NULL,
+	product TEXT NOT NULL,
+	model TEXT NOT NULL,
+	firmware_version TEXT NOT NULL,
+	redfish_version TEXT NOT NULL,
+	system_model TEXT NOT NULL,
+	serial_number TEXT NOT NULL,
+	detect_time TIMESTAMP NOT NULL
+);`
+
+const UPSERT_HOST_BMC_STATEMENT = `INSERT INTO host_bmc (host_name, driver, vendor, product, model, firmware_version, redfish_version, system_model, serial_number, detect_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET driver = excluded.driver, vendor = excluded.vendor, product = excluded.product, model = excluded.model, firmware_version = excluded.firmware_version, redfish_version = excluded.redfish_version, system_model = excluded.system_model, serial_number = excluded.serial_number, detect_time = excluded.detect_time;`
+const SELECT_HOST_BMC_STATEMENT = `SELECT host_name, driver, vendor, product, model, firmware_version, redfish_version, system_model, serial_number, detect_time FROM host_bmc WHERE host_name = ?;`
+const DELETE_HOST_BMC_STATEMENT = `DELETE FROM host_bmc WHERE host_name = ?;`
+
+type DBHostBMC struct {
+	HostName        string    `json:"-"`
+	Driver          string    `json:"driver"`
+	Vendor          string    `json:"vendor"`
+	Product         string    `json:"product"`
+	Model           string    `json:"model"`
+	FirmwareVersion string    `json:"firmware_version"`
+	RedfishVersion  string    `json:"redfish_version"`
+	SystemModel     string    `json:"system_model"`
+	SerialNumber    string    `json:"serial_number"`
+	DetectTime      time.Time `json:"detect_time"`
+}
+
+func (b *DBHostBMC) JSON() []byte {
+	json, _ := json.Marshal(b)
+	return json
+}
+
+// DetectBMC probes a BMC that isn't stored yet and returns the value for
+// ipmi_redfish_version along with what was learned about it. With a
+// fingerprint, the credentials are only sent to a BMC with that certificate.
+func DetectBMC(address, username, password, fingerprint string) (int, redfish.Driver, *redfish.BMCInfo, error) {
+	client := redfish.NewClient(address, username, password)
+	client.PinnedFingerprint = fingerprint
+
+	driver, info, err := client.Detect()
+
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return hostRedfishVersionFor(driver, info), driver, info, nil
+}
+
+func SetHostBMC(name string, driver redfish.Driver, info *redfish.BMCInfo) error {
+	return QueuedExec(UPSERT_HOST_BMC_STATEMENT, name, driver.Name(), info.Vendor, driver.Product(info), info.Model, info.FirmwareVersion, info.RedfishVersion, info.SystemModel, info.SerialNumber, time.Now())
+}
+
+func GetHostBMC(name string) (*DBHostBMC, error) {
+	rows, err := QueuedQuery(SELECT_HOST_BMC_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	var bmc DBHostBMC
+
+	if err := rows.Scan(&bmc.HostName, &bmc.Driver, &bmc.Vendor, &bmc.Product, &bmc.Model, &bmc.FirmwareVersion, &bmc.RedfishVersion, &bmc.SystemModel, &bmc.SerialNumber, &bmc.DetectTime); err != nil {
+		return nil, err
+	}
+
+	return &bmc, nil
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+var ErrNoPendingCertificate = errors.New("bmc has not presented a new certificate")
+
+const IssueSourceCertificate = "certificate"
+
+// The certificate each host's BMC is trusted with. The fingerprint is pinned
+// the first time the BMC is reached, and a different certificate is refused
+// until an admin accepts it. pending_fingerprint is the certificate that was
+// refused. Hosts with a CA bundle trust whatever it signed instead.
+const HOST_CERTIFICATES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_certificates (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	fingerprint TEXT NOT NULL,
+	pending_fingerprint TEXT NOT NULL DEFAULT '',
+	ca_bundle TEXT NOT NULL DEFAULT '',
+	pin_time TIMESTAMP NOT NULL,
+	change_time TIMESTAMP
+);`
+
+const UPSERT_HOST_CERTIFICATE_PIN_STATEMENT = `INSERT INTO host_certificates (host_name, fingerprint, pin_time) VALUES (?, ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET fingerprint = excluded.fingerprint, pin_time = excluded.pin_time WHERE fingerprint = '';`
+const SELECT_HOST_CERTIFICATE_STATEMENT = `SELECT host_name, fingerprint, pending_fingerprint, ca_bundle, pin_time, change_time FROM host_certificates WHERE host_name = ?;`
+const UPDATE_HOST_CERTIFICATE_PENDING_STATEMENT = `UPDATE host_certificates SET pending_fingerprint = ?, change_time = ? WHERE host_name = ? AND pending_fingerprint != ?;`
+const UPDATE_HOST_CERTIFICATE_ACCEPT_STATEMENT = `UPDATE host_certificates SET fingerprint = pending_fingerprint, pending_fingerprint = '', ca_bundle = '', pin_time = ? WHERE host_name = ? AND pending_fingerprint != '';`
+const UPSERT_HOST_CERTIFICATE_CA_BUNDLE_STATEMENT = `INSERT INTO host_certificates (host_name, fingerprint, ca_bundle, pin_time) VALUES (?, '', ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET ca_bundle = excluded.ca_bundle, pending_fingerprint = '';`
+const DELETE_HOST_CERTIFICATE_STATEMENT = `DELETE FROM host_certificates WHERE host_name = ?;`
+
+type DBHostCertificate struct {
+	HostName           string     `json:"host_name"`
+	Fingerprint        string     `json:"fingerprint"`
+	PendingFingerprint string     `json:"pending_fingerprint"`
+	CABundle           string     `json:"ca_bundle"`
+	PinTime            time.Time  `json:"pin_time"`
+	ChangeTime         *time.Time `json:"change_time"`
+}
+
+func (c *DBHostCertificate) JSON() []byte {
+	json, _ := json.Marshal(c)
+	return json
+}
+
+func GetHostCertificate(name string) (*DBHostCertificate, error) {
+	rows, err := QueuedQuery(SELECT_HOST_CERTIFICATE_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var c DBHostCertificate
+	var change sql.NullTime
+
+	if err := rows.Scan(&c.HostName, &c.Fingerprint, &c.PendingFingerprint, &c.CABundle, &c.PinTime, &change); err != nil {
+		return nil, err
+	}
+
+	c.ChangeTime = nullTime(change)
+	return &c, nil
+}
+
+// PinHostCertificate trusts the certificate with this fingerprint from now
+// on, unless one is pinned already. Changing it takes an admin accepting the
+// new certificate.
+func PinHostCertificate(name, fingerprint string) error {
+	if fingerprint == "" {
+		return nil
+	}
+
+	return QueuedExec(UPSERT_HOST_CERTIFICATE_PIN_STATEMENT, name, fingerprint, time.Now())
+}
+
+// ResetHostCertificate forgets the host's pinned certificate, CA bundle and
+// SSH host key, for when its BMC moves to a different address
+func ResetHostCertificate(name string) error {
+	if err := QueuedExec(DELETE_HOST_CERTIFICATE_STATEMENT, name); err != nil {
+		return err
+	}
+
+	if err := ResetHostSSHKey(name); err != nil {
+		return err
+	}
+
+	return ReportHostIssues(name, IssueSourceCertificate, nil)
+}
+
+// AcceptHostCertificate pins the certificate that was refused, for when the
+// BMC's certificate was replaced on purpose. Any CA bundle is dropped, since
+// it is what refused the certificate.
+func AcceptHostCertificate(name string) error {
+	result, err := QueuedExecResult(UPDATE_HOST_CERTIFICATE_ACCEPT_STATEMENT, time.Now(), name)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNoPendingCertificate
+	}
+
+	return ReportHostIssues(name, IssueSourceCertificate, nil)
+}
+
+// SetHostCABundle has the host's BMC trusted by the CAs in bundle instead of
+// by its pinned certificate. An empty bundle goes back to the pin.
+func SetHostCABundle(name, bundle string) error {
+	if bundle != "" {
+		if _, err := redfish.ParseCABundle(bundle); err != nil {
+			return err
+		}
+	}
+
+	if err := QueuedExec(UPSERT_HOST_CERTIFICATE_CA_BUNDLE_STATEMENT, name, bundle, time.Now()); err != nil {
+		return err
+	}
+
+	return ReportHostIssues(name, IssueSourceCertificate, nil)
+}
+
+// trustHostCertificate sets up the client to check the BMC's certificate.
+// A host with nothing pinned yet has it pinned on the spot, from a probe
+// without credentials, since the BMC isn't verified until then.
+func (h *DBHost) trustHostCertificate(client *redfish.Client) error {
+	certificate, err := GetHostCertificate(h.Name)
+
+	if err != nil {
+		return err
+	}
+
+	if certificate == nil || certificate.Fingerprint == "" && certificate.CABundle == "" {
+		probe := redfish.NewClient(client.Address, "", "")
+
+		if _, err := probe.ServiceRoot(); err != nil {
+			return err
+		}
+
+		fingerprint := probe.CertificateFingerprint()
+
+		if err := PinHostCertificate(h.Name, fingerprint); err != nil {
+			return err
+		}
+
+		lib.Log.Basic(fmt.Sprintf("Pinned certificate of host %s", h.Name))
+		client.PinnedFingerprint = fingerprint
+		return nil
+	}
+
+	if certificate.CABundle != "" {
+		pool, err := redfish.ParseCABundle(certificate.CABundle)
+
+		if err != nil {
+			return err
+		}
+
+		client.TrustedCAs = pool
+		return nil
+	}
+
+	client.PinnedFingerprint = certificate.Fingerprint
+	return nil
+}
+
+// reportCertificateError opens an issue when the BMC's certificate was
+// refused, and keeps the certificate so it can be accepted
+func (h *DBHost) reportCertificateError(certErr *redfish.CertificateError) error {
+	if err := QueuedExec(UPDATE_HOST_CERTIFICATE_PENDING_STATEMENT, certErr.Fingerprint, time.Now(), h.Name, certErr.Fingerprint); err != nil {
+		return err
+	}
+
+	message := "BMC presented a different certificate (" + certErr.Fingerprint + "). Accept it if the certificate was replaced on purpose."
+
+	if errors.Is(certErr, redfish.ErrCertificateUntrusted) {
+		message = "BMC presented a certificate not signed by the host's CA bundle (" + certErr.Fingerprint + ")"
+	}
+
+	return ReportHostIssues(h.Name, IssueSourceCertificate, []*DBHostIssue{{
+		Component: "BMC certificate",
+		Severity:  HostHealthBad,
+		Message:   message,
+	}})
+}
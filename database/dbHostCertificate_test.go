@@ -0,0 +1,88 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// A host created without a certificate has it pinned the first time it is
+// reached, before the BMC is sent any credentials, and is held to it from then
+// on
+func TestCertificateFirstUse(t *testing.T) {
+	bmc := newFakeBMC(t)
+	host, err := CreateHost("certificate-2", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("certificate-2") })
+
+	client, err := host.redfishClient()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := bmc.credentialed.Load(); n != 0 {
+		t.Errorf("sent credentials before pinning %d time(s)", n)
+	}
+
+	if client.PinnedFingerprint != bmc.Fingerprint() {
+		t.Errorf("client pinned %q, want %q", client.PinnedFingerprint, bmc.Fingerprint())
+	}
+
+	if cert, err := GetHostCertificate("certificate-2"); err != nil {
+		t.Fatal(err)
+	} else if cert == nil || cert.Fingerprint != bmc.Fingerprint() {
+		t.Errorf("pinned %+v, want %s", cert, bmc.Fingerprint())
+	}
+}
+
+// Any action refused by the pin opens the certificate issue, not just polls
+func TestCertificateErrorFromAction(t *testing.T) {
+	bmc := newFakeBMC(t)
+	host, err := CreateHost("certificate-1", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("certificate-1") })
+
+	if err := PinHostCertificate("certificate-1", "00:11:22"); err != nil {
+		t.Fatal(err)
+	}
+
+	var certErr *redfish.CertificateError
+
+	if _, err := host.PowerStatus(); !errors.As(err, &certErr) {
+		t.Fatalf("err = %v, want a certificate error", err)
+	}
+
+	if n := bmc.credentialed.Load(); n != 0 {
+		t.Errorf("sent credentials to the wrong certificate %d time(s)", n)
+	}
+
+	issues, err := ListHostIssues("certificate-1", false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 1 || issues[0].Source != IssueSourceCertificate {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	cert, err := GetHostCertificate("certificate-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.PendingFingerprint != bmc.Fingerprint() {
+		t.Errorf("pending = %q, want %q", cert.PendingFingerprint, bmc.Fingerprint())
+	}
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrConsoleBusy           = errors.New("host console is already in use")
+	ErrConsoleHostKeyChanged = errors.New("bmc ssh host key does not match the pinned one")
+)
+
+// The SSH host key of each host's BMC, pinned the first time its console is
+// opened, like its certificate
+const HOST_SSH_KEYS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_ssh_keys (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	fingerprint TEXT NOT NULL,
+	pin_time TIMESTAMP NOT NULL
+);`
+
+// Every console session is recorded to a file in CONSOLE_RECORDING_DIR
+const CONSOLE_SESSIONS_STATEMENT = `CREATE TABLE IF NOT EXISTS console_sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_name TEXT NOT NULL,
+	user TEXT NOT NULL,
+	recording TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL,
+	end_time TIMESTAMP
+);`
+
+const INSERT_HOST_SSH_KEY_STATEMENT = `INSERT OR IGNORE INTO host_ssh_keys (host_name, fingerprint, pin_time) VALUES (?, ?, ?);`
+const SELECT_HOST_SSH_KEY_STATEMENT = `SELECT fingerprint FROM host_ssh_keys WHERE host_name = ?;`
+const DELETE_HOST_SSH_KEY_STATEMENT = `DELETE FROM host_ssh_keys WHERE host_name = ?;`
+
+const CONSOLE_SESSION_COLUMNS = `id, host_name, user, recording, start_time, end_time`
+
+const INSERT_CONSOLE_SESSION_STATEMENT = `INSERT INTO console_sessions (host_name, user, recording, start_time) VALUES (?, ?, '', ?);`
+const UPDATE_CONSOLE_SESSION_RECORDING_STATEMENT = `UPDATE console_sessions SET recording = ? WHERE id = ?;`
+const UPDATE_CONSOLE_SESSION_END_STATEMENT = `UPDATE console_sessions SET end_time = ? WHERE id = ?;`
+const SELECT_CONSOLE_SESSION_STATEMENT = `SELECT ` + CONSOLE_SESSION_COLUMNS + ` FROM console_sessions WHERE id = ?;`
+const SELECT_HOST_CONSOLE_SESSIONS_STATEMENT = `SELECT ` + CONSOLE_SESSION_COLUMNS + ` FROM console_sessions WHERE host_name = ? ORDER BY id DESC;`
+
+// BMCs only allow one serial console session at a time
+var openConsoles = struct {
+	sync.Mutex
+	hosts map[string]bool
+}{hosts: map[string]bool{}}
+
+type DBConsoleSession struct {
+	ID        int        `json:"id"`
+	HostName  string     `json:"host_name"`
+	User      string     `json:"user"`
+	Recording string     `json:"-"`
+	StartTime time.Time  `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+}
+
+func (s *DBConsoleSession) JSON() []byte {
+	json, _ := json.Marshal(s)
+	return json
+}
+
+// HostConsole is a console session being recorded. The recording is an
+// asciicast v2 file, so it can be played back with asciinema.
+type HostConsole struct {
+	ID int
+
+	console   *redfish.Console
+	host      string
+	start     time.Time
+	recording *os.File
+	mu        sync.Mutex
+}
+
+// OpenConsole attaches user to the host's serial console through its BMC
+func (h *DBHost) OpenConsole(user string) (*HostConsole, error) {
+	openConsoles.Lock()
+
+	if openConsoles.hosts[h.Name] {
+		openConsoles.Unlock()
+		return nil, ErrConsoleBusy
+	}
+
+	openConsoles.hosts[h.Name] = true
+	openConsoles.Unlock()
+
+	c, err := h.openConsole(user)
+
+	if err != nil {
+		releaseConsole(h.Name)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func releaseConsole(name string) {
+	openConsoles.Lock()
+	delete(openConsoles.hosts, name)
+	openConsoles.Unlock()
+}
+
+func (h *DBHost) openConsole(user string) (*HostConsole, error) {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	console, err := client.OpenConsole(h.checkSSHHostKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &HostConsole{console: console, host: h.Name, start: time.Now()}
+
+	if err := c.startRecording(user); err != nil {
+		console.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// checkSSHHostKey pins the BMC's SSH host key the first time, and refuses
+// any other key afterwards
+func (h *DBHost) checkSSHHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	fingerprint := ssh.FingerprintSHA256(key)
+	rows, err := QueuedQuery(SELECT_HOST_SSH_KEY_STATEMENT, h.Name)
+
+	if err != nil {
+		return err
+	}
+
+	pinned := ""
+
+	if rows.Next() {
+		err = rows.Scan(&pinned)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if pinned == "" {
+		lib.Log.Basic(fmt.Sprintf("Pinned SSH host key of host %s", h.Name))
+		return QueuedExec(INSERT_HOST_SSH_KEY_STATEMENT, h.Name, fingerprint, time.Now())
+	}
+
+	if pinned != fingerprint {
+		lib.Log.Warning(fmt.Sprintf("BMC of host %s presented SSH host key %s instead of %s", h.Name, fingerprint, pinned))
+		return ErrConsoleHostKeyChanged
+	}
+
+	return nil
+}
+
+// ResetHostSSHKey forgets the SSH host key pinned for the host's BMC, for
+// when the BMC was replaced or reset
+func ResetHostSSHKey(name string) error {
+	return QueuedExec(DELETE_HOST_SSH_KEY_STATEMENT, name)
+}
+
+func (c *HostConsole) startRecording(user string) error {
+	result, err := QueuedExecResult(INSERT_CONSOLE_SESSION_STATEMENT, c.host, user, c.start)
+
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+
+	if err != nil {
+		return err
+	}
+
+	c.ID = int(id)
+
+	dir := filepath.Join(lib.Config.ConsoleRecordingDir, c.host)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d.cast", c.ID))
+
+	if c.recording, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600); err != nil {
+		return err
+	}
+
+	header, _ := json.Marshal(map[string]interface{}{
+		"version":   2,
+		"width":     80,
+		"height":    24,
+		"timestamp": c.start.Unix(),
+		"title":     fmt.Sprintf("%s console, %s", c.host, user),
+	})
+
+	if _, err := c.recording.Write(append(header, '\n')); err != nil {
+		c.recording.Close()
+		return err
+	}
+
+	return QueuedExec(UPDATE_CONSOLE_SESSION_RECORDING_STATEMENT, path, c.ID)
+}
+
+// record appends an event to the recording, "o" for output and "i" for
+// input. A recording that can't be written ends the session, since
+// sessions aren't allowed unrecorded.
+func (c *HostConsole) record(kind string, data []byte) error {
+	event, _ := json.Marshal([]interface{}{time.Since(c.start).Seconds(), kind, string(bytes.ToValidUTF8(data, []byte("?")))})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.recording.Write(append(event, '\n'))
+	return err
+}
+
+func (c *HostConsole) Read(p []byte) (int, error) {
+	n, err := c.console.Read(p)
+
+	if n > 0 {
+		if recordErr := c.record("o", p[:n]); recordErr != nil {
+			return n, recordErr
+		}
+	}
+
+	return n, err
+}
+
+func (c *HostConsole) Write(p []byte) (int, error) {
+	if err := c.record("i", p); err != nil {
+		return 0, err
+	}
+
+	return c.console.Write(p)
+}
+
+// Close ends the session and frees the console for the next user
+func (c *HostConsole) Close() error {
+	err := c.console.Close()
+
+	c.mu.Lock()
+	c.recording.Close()
+	c.mu.Unlock()
+
+	if recordErr := QueuedExec(UPDATE_CONSOLE_SESSION_END_STATEMENT, time.Now(), c.ID); recordErr != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record end of console session %d: %s", c.ID, recordErr.Error()))
+	}
+
+	releaseConsole(c.host)
+	return err
+}
+
+func GetConsoleSession(id int) (*DBConsoleSession, error) {
+	sessions, err := queryConsoleSessions(SELECT_CONSOLE_SESSION_STATEMENT, id)
+
+	if err != nil || len(sessions) == 0 {
+		return nil, err
+	}
+
+	return sessions[0], nil
+}
+
+func ListConsoleSessions(name string) ([]*DBConsoleSession, error) {
+	return queryConsoleSessions(SELECT_HOST_CONSOLE_SESSIONS_STATEMENT, name)
+}
+
+func queryConsoleSessions(query string, arg interface{}) ([]*DBConsoleSession, error) {
+	sessions := []*DBConsoleSession{}
+
+	err := queryEach(query, arg, func(rows *sql.Rows) error {
+		var s DBConsoleSession
+		var end sql.NullTime
+
+		if err := rows.Scan(&s.ID, &s.HostName, &s.User, &s.Recording, &s.StartTime, &end); err != nil {
+			return err
+		}
+
+		s.EndTime = nullTime(end)
+		sessions = append(sessions, &s)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,316 @@
+package database
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeConsole is a BMC's SSH server. It prints a login prompt once the
+// console command is run, then echoes what is typed, like a serial console
+// would.
+type fakeConsole struct {
+	hostKey  ssh.Signer
+	listener net.Listener
+	commands chan string
+}
+
+func newFakeConsole(t *testing.T) *fakeConsole {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	console := &fakeConsole{commands: make(chan string, 8)}
+
+	if console.hostKey, err = ssh.NewSignerFromKey(key); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() != "root" || string(password) != "calvin" {
+				return nil, errors.New("wrong password")
+			}
+
+			return nil, nil
+		},
+	}
+
+	config.AddHostKey(console.hostKey)
+
+	if console.listener, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { console.listener.Close() })
+
+	go func() {
+		for {
+			conn, err := console.listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go console.serve(conn, config)
+		}
+	}()
+
+	return console
+}
+
+func (c *fakeConsole) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for request := range requests {
+				switch request.Type {
+				case "pty-req":
+					request.Reply(true, nil)
+				case "exec":
+					var exec struct{ Command string }
+
+					ssh.Unmarshal(request.Payload, &exec)
+					request.Reply(true, nil)
+					c.commands <- exec.Command
+
+					channel.Write([]byte("login: "))
+					go func() {
+						io.Copy(channel, channel)
+						channel.Close()
+					}()
+				default:
+					request.Reply(false, nil)
+				}
+			}
+		}()
+	}
+}
+
+func (c *fakeConsole) Port() int {
+	return c.listener.Addr().(*net.TCPAddr).Port
+}
+
+// listen points the BMC's NetworkProtocol at the console
+func (c *fakeConsole) listen(bmc *fakeBMC) {
+	bmc.Set("/redfish/v1/Managers/iDRAC.Embedded.1/NetworkProtocol", map[string]interface{}{
+		"SSH": map[string]interface{}{"Port": c.Port(), "ProtocolEnabled": true},
+	})
+}
+
+func readConsole(t *testing.T, console *HostConsole, want string) {
+	t.Helper()
+
+	got := make([]byte, len(want))
+
+	if _, err := io.ReadFull(console, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != want {
+		t.Fatalf("console printed %q, want %q", got, want)
+	}
+}
+
+func TestConsole(t *testing.T) {
+	lib.Config.ConsoleRecordingDir = t.TempDir()
+
+	bmc := newFakeBMC(t)
+	first := newFakeConsole(t)
+	first.listen(bmc)
+
+	host, err := CreateHost("console-1", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("console-1") })
+
+	console, err := host.OpenConsole("user@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if command := <-first.commands; command != "console com2" {
+		t.Errorf("ran %q on the BMC", command)
+	}
+
+	if _, err := host.OpenConsole("admin@example.com"); err != ErrConsoleBusy {
+		t.Errorf("second session: err = %v, want %v", err, ErrConsoleBusy)
+	}
+
+	readConsole(t, console, "login: ")
+
+	if _, err := console.Write([]byte("root\r")); err != nil {
+		t.Fatal(err)
+	}
+
+	readConsole(t, console, "root\r")
+
+	if err := console.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The host key is pinned on first use
+	rows, err := QueuedQuery(SELECT_HOST_SSH_KEY_STATEMENT, "console-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := ""
+
+	for rows.Next() {
+		rows.Scan(&pinned)
+	}
+
+	rows.Close()
+
+	if want := ssh.FingerprintSHA256(first.hostKey.PublicKey()); pinned != want {
+		t.Errorf("pinned %q, want %q", pinned, want)
+	}
+
+	// The session is recorded as asciicast v2, a header and then one event
+	// per line
+	sessions, err := ListConsoleSessions("console-1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 1 || sessions[0].User != "user@example.com" || sessions[0].EndTime == nil {
+		t.Fatalf("sessions = %+v", sessions)
+	}
+
+	recording, err := os.Open(sessions[0].Recording)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer recording.Close()
+	lines := bufio.NewScanner(recording)
+
+	var header struct {
+		Version int `json:"version"`
+		Width   int `json:"width"`
+		Height  int `json:"height"`
+	}
+
+	if !lines.Scan() || json.Unmarshal(lines.Bytes(), &header) != nil || header.Version != 2 || header.Width != 80 || header.Height != 24 {
+		t.Fatalf("header = %q", lines.Text())
+	}
+
+	var events [][2]string
+
+	for lines.Scan() {
+		var event []interface{}
+
+		if err := json.Unmarshal(lines.Bytes(), &event); err != nil || len(event) != 3 {
+			t.Fatalf("event = %q", lines.Text())
+		}
+
+		if _, ok := event[0].(float64); !ok {
+			t.Errorf("event time = %v", event[0])
+		}
+
+		events = append(events, [2]string{event[1].(string), event[2].(string)})
+	}
+
+	want := [][2]string{{"o", "login: "}, {"i", "root\r"}, {"o", "root\r"}}
+
+	if len(events) != len(want) {
+		t.Fatalf("events = %q, want %q", events, want)
+	}
+
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, events[i], want[i])
+		}
+	}
+
+	// A BMC with another host key isn't logged in to, until an admin
+	// forgets the pinned one
+	second := newFakeConsole(t)
+	second.listen(bmc)
+
+	if _, err := host.OpenConsole("user@example.com"); !errors.Is(err, ErrConsoleHostKeyChanged) {
+		t.Fatalf("changed host key: err = %v, want %v", err, ErrConsoleHostKeyChanged)
+	}
+
+	if len(second.commands) != 0 {
+		t.Error("ran a command on a BMC with another host key")
+	}
+
+	if err := ResetHostSSHKey("console-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	console, err = host.OpenConsole("user@example.com")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readConsole(t, console, "login: ")
+	console.Close()
+}
+
+// Without a console command for the BMC, the user would be left at the BMC's
+// own shell, so no session is opened at all
+func TestConsoleUnsupported(t *testing.T) {
+	bmc := newFakeBMC(t)
+	listening := newFakeConsole(t)
+	listening.listen(bmc)
+
+	host, err := CreateHost("console-2", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Generic)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("console-2") })
+
+	if _, err := host.OpenConsole("user@example.com"); !errors.Is(err, redfish.ErrConsoleUnsupported) {
+		t.Fatalf("err = %v, want %v", err, redfish.ErrConsoleUnsupported)
+	}
+
+	if len(listening.commands) != 0 {
+		t.Error("opened a session on the BMC")
+	}
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+// BMC usernames and passwords are only ever stored encrypted with
+// lib.BMCKey. DBHost.IPMI holds the ciphertexts; they are decrypted when a
+// Redfish client is made for the host.
+
+const SELECT_HOST_CREDENTIALS_STATEMENT = `SELECT name, ipmi_username, ipmi_password FROM hosts;`
+const UPDATE_HOST_CREDENTIALS_STATEMENT = `UPDATE hosts SET ipmi_username = ?, ipmi_password = ? WHERE name = ?;`
+
+type hostCredentials struct {
+	name, username, password string
+}
+
+func credentialContext(name, column string) string {
+	return "hosts/" + name + "/" + column
+}
+
+func encryptCredentials(key *lib.SecretKey, name, username, password string) (string, string, error) {
+	username, err := key.Encrypt(username, credentialContext(name, "ipmi_username"))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = key.Encrypt(password, credentialContext(name, "ipmi_password"))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+func decryptCredentials(key *lib.SecretKey, name, username, password string) (string, string, error) {
+	username, err := key.Decrypt(username, credentialContext(name, "ipmi_username"))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err = key.Decrypt(password, credentialContext(name, "ipmi_password"))
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// Credentials decrypts the host's BMC username and password
+func (h *DBHost) Credentials() (string, string, error) {
+	return decryptCredentials(lib.BMCKey, h.Name, h.IPMI.Username, h.IPMI.Password)
+}
+
+// encryptedCredential reports whether a stored credential is already
+// encrypted. Only a ciphertext that decrypts with the key counts, so a
+// plaintext password that merely looks like one is still encrypted. A
+// ciphertext under another key is an error rather than plaintext, since it
+// most likely means the server was started with the wrong key.
+func encryptedCredential(key *lib.SecretKey, name, column, value string) (bool, error) {
+	if !lib.IsEncryptedSecret(value) {
+		return false, nil
+	}
+
+	_, err := key.Decrypt(value, credentialContext(name, column))
+
+	if errors.Is(err, lib.ErrSecretKeyMismatch) {
+		return false, fmt.Errorf("host %s: %w", name, err)
+	}
+
+	return err == nil, nil
+}
+
+// encryptPlaintextCredentials encrypts rows written before credentials were
+// encrypted
+func encryptPlaintextCredentials() error {
+	rows, err := db.Query(SELECT_HOST_CREDENTIALS_STATEMENT)
+
+	if err != nil {
+		return err
+	}
+
+	all := []hostCredentials{}
+
+	for rows.Next() {
+		var creds hostCredentials
+
+		if err := rows.Scan(&creds.name, &creds.username, &creds.password); err != nil {
+			rows.Close()
+			return err
+		}
+
+		all = append(all, creds)
+	}
+
+	rows.Close()
+	encrypted := 0
+
+	// Only the columns that are still plaintext are encrypted, since
+	// encrypting a ciphertext again would lose the credential
+	for _, creds := range all {
+		username, password := creds.username, creds.password
+
+		usernameDone, err := encryptedCredential(lib.BMCKey, creds.name, "ipmi_username", username)
+
+		if err != nil {
+			return err
+		}
+
+		passwordDone, err := encryptedCredential(lib.BMCKey, creds.name, "ipmi_password", password)
+
+		if err != nil {
+			return err
+		}
+
+		if usernameDone && passwordDone {
+			continue
+		}
+
+		if !usernameDone {
+			if username, err = lib.BMCKey.Encrypt(username, credentialContext(creds.name, "ipmi_username")); err != nil {
+				return err
+			}
+		}
+
+		if !passwordDone {
+			if password, err = lib.BMCKey.Encrypt(password, credentialContext(creds.name, "ipmi_password")); err != nil {
+				return err
+			}
+		}
+
+		if _, err := db.Exec(UPDATE_HOST_CREDENTIALS_STATEMENT, username, password, creds.name); err != nil {
+			return err
+		}
+
+		encrypted++
+	}
+
+	if encrypted > 0 {
+		lib.Log.Important(fmt.Sprintf("Encrypted BMC credentials for %d host(s)", encrypted))
+	}
+
+	return nil
+}
+
+// RotateBMCKey re-encrypts every host's credentials from lib.BMCKey to
+// newKey in a single transaction, so a failure leaves everything on the old
+// key. The server should not be running while this happens.
+func RotateBMCKey(newKey *lib.SecretKey) (int, error) {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	rows, err := tx.Query(SELECT_HOST_CREDENTIALS_STATEMENT)
+
+	if err != nil {
+		return 0, err
+	}
+
+	all := []hostCredentials{}
+
+	for rows.Next() {
+		var creds hostCredentials
+
+		if err := rows.Scan(&creds.name, &creds.username, &creds.password); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		all = append(all, creds)
+	}
+
+	rows.Close()
+
+	for _, creds := range all {
+		username, password, err := decryptCredentials(lib.BMCKey, creds.name, creds.username, creds.password)
+
+		if err != nil {
+			return 0, fmt.Errorf("host %s: %w", creds.name, err)
+		}
+
+		if username, password, err = encryptCredentials(newKey, creds.name, username, password); err != nil {
+			return 0, err
+		}
+
+		if _, err := tx.Exec(UPDATE_HOST_CREDENTIALS_STATEMENT, username, password, creds.name); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(all), tx.Commit()
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+func newTestKey(t *testing.T) *lib.SecretKey {
+	t.Helper()
+
+	encoded, err := lib.NewSecretKey()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := lib.ParseSecretKey(encoded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func createCredentialHost(t *testing.T, name string) *DBHost {
+	t.Helper()
+
+	host, err := CreateHost(name, HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, "192.0.2.1", "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost(name) })
+	return host
+}
+
+// setStoredCredentials writes the columns as they are, like rows from before
+// credentials were encrypted
+func setStoredCredentials(t *testing.T, name, username, password string) {
+	t.Helper()
+
+	if _, err := db.Exec(UPDATE_HOST_CREDENTIALS_STATEMENT, username, password, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsRoundTrip(t *testing.T) {
+	host := createCredentialHost(t, "credentials-1")
+
+	if host.IPMI.Username == "root" || host.IPMI.Password == "calvin" || !lib.IsEncryptedSecret(host.IPMI.Password) {
+		t.Fatalf("stored %q, %q", host.IPMI.Username, host.IPMI.Password)
+	}
+
+	if username, password, err := host.Credentials(); err != nil || username != "root" || password != "calvin" {
+		t.Errorf("credentials = %q, %q, %v", username, password, err)
+	}
+
+	// Ciphertexts are tied to their host and column
+	if _, _, err := decryptCredentials(lib.BMCKey, "credentials-2", host.IPMI.Username, host.IPMI.Password); !errors.Is(err, lib.ErrBadSecret) {
+		t.Errorf("other host: err = %v, want %v", err, lib.ErrBadSecret)
+	}
+
+	if _, _, err := decryptCredentials(lib.BMCKey, host.Name, host.IPMI.Password, host.IPMI.Username); !errors.Is(err, lib.ErrBadSecret) {
+		t.Errorf("swapped columns: err = %v, want %v", err, lib.ErrBadSecret)
+	}
+}
+
+func TestCredentialsWrongKey(t *testing.T) {
+	host := createCredentialHost(t, "credentials-2")
+
+	if _, _, err := decryptCredentials(newTestKey(t), host.Name, host.IPMI.Username, host.IPMI.Password); !errors.Is(err, lib.ErrSecretKeyMismatch) {
+		t.Errorf("err = %v, want %v", err, lib.ErrSecretKeyMismatch)
+	}
+}
+
+func TestRotateBMCKey(t *testing.T) {
+	createCredentialHost(t, "credentials-3")
+	createCredentialHost(t, "credentials-4")
+
+	// Nothing is rotated while any host can't be decrypted
+	setStoredCredentials(t, "credentials-4", "root", "calvin")
+
+	if _, err := RotateBMCKey(newTestKey(t)); !errors.Is(err, lib.ErrBadSecret) {
+		t.Fatalf("err = %v, want %v", err, lib.ErrBadSecret)
+	}
+
+	if host, err := GetHost("credentials-3"); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := host.Credentials(); err != nil {
+		t.Fatalf("after failed rotation: %v", err)
+	}
+
+	DeleteHost("credentials-4")
+
+	newKey := newTestKey(t)
+	count, err := RotateBMCKey(newKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like the server would be after restarting with the new key
+	lib.BMCKey = newKey
+
+	if count < 1 {
+		t.Errorf("rotated %d host(s)", count)
+	}
+
+	host, err := GetHost("credentials-3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if username, password, err := host.Credentials(); err != nil || username != "root" || password != "calvin" {
+		t.Errorf("credentials = %q, %q, %v", username, password, err)
+	}
+}
+
+func TestEncryptPlaintextCredentials(t *testing.T) {
+	createCredentialHost(t, "credentials-5")
+	createCredentialHost(t, "credentials-6")
+
+	// A password can look like a ciphertext without being one, such as a
+	// ciphertext of another row
+	lookalike, err := lib.BMCKey.Encrypt("calvin", credentialContext("credentials-6", "ipmi_password"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStoredCredentials(t, "credentials-5", "root", lookalike)
+
+	before, err := GetHost("credentials-6")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := encryptPlaintextCredentials(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if host, err := GetHost("credentials-5"); err != nil {
+		t.Fatal(err)
+	} else if username, password, err := host.Credentials(); err != nil || username != "root" || password != lookalike {
+		t.Errorf("credentials = %q, %q, %v", username, password, err)
+	}
+
+	// Rows that were already encrypted are left alone
+	if after, err := GetHost("credentials-6"); err != nil {
+		t.Fatal(err)
+	} else if after.IPMI.Username != before.IPMI.Username || after.IPMI.Password != before.IPMI.Password {
+		t.Error("encrypted an encrypted row again")
+	}
+
+	// Ciphertexts of another key aren't taken for plaintext
+	other, _, err := encryptCredentials(newTestKey(t), "credentials-6", "root", "calvin")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setStoredCredentials(t, "credentials-6", other, before.IPMI.Password)
+
+	if err := encryptPlaintextCredentials(); !errors.Is(err, lib.ErrSecretKeyMismatch) {
+		t.Errorf("err = %v, want %v", err, lib.ErrSecretKeyMismatch)
+	}
+}
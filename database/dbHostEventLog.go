@@ -0,0 +1,173 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+// Entries are identified by their log, ID and creation time. IDs alone
+// aren't enough since BMCs start numbering over when a log is cleared.
+const HOST_EVENT_LOGS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_event_logs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_name TEXT NOT NULL,
+	service TEXT NOT NULL,
+	entry_id TEXT NOT NULL,
+	created TIMESTAMP NOT NULL,
+	severity INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	entry_type TEXT NOT NULL,
+	sensor_type TEXT NOT NULL,
+	ingest_time TIMESTAMP NOT NULL,
+	UNIQUE (host_name, service, entry_id, created)
+);
+CREATE INDEX IF NOT EXISTS host_event_logs_host ON host_event_logs (host_name, created);`
+
+const HOST_EVENT_LOG_COLUMNS = `id, host_name, service, entry_id, created, severity, message, message_id, entry_type, sensor_type, ingest_time`
+
+const INSERT_HOST_EVENT_LOG_STATEMENT = `INSERT OR IGNORE INTO host_event_logs (host_name, service, entry_id, created, severity, message, message_id, entry_type, sensor_type, ingest_time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const PRUNE_HOST_EVENT_LOGS_STATEMENT = `DELETE FROM host_event_logs WHERE host_name = ? AND created < ?;`
+const SELECT_HOST_EVENT_LOGS_STATEMENT = `SELECT ` + HOST_EVENT_LOG_COLUMNS + ` FROM host_event_logs
+	WHERE host_name = ? AND (? = '' OR service = ?) AND severity BETWEEN ? AND ? AND created >= ? AND created < ? AND (? = '' OR message LIKE '%' || ? || '%' OR message_id LIKE '%' || ? || '%')
+	ORDER BY created DESC, id DESC LIMIT ?;`
+const DELETE_HOST_EVENT_LOGS_STATEMENT = `DELETE FROM host_event_logs WHERE host_name = ?;`
+
+type DBHostEventLog struct {
+	ID         int       `json:"id"`
+	HostName   string    `json:"host_name"`
+	Service    string    `json:"service"`
+	EntryID    string    `json:"entry_id"`
+	Created    time.Time `json:"created"`
+	Severity   int       `json:"severity"`
+	Message    string    `json:"message"`
+	MessageID  string    `json:"message_id"`
+	EntryType  string    `json:"entry_type"`
+	SensorType string    `json:"sensor_type"`
+	IngestTime time.Time `json:"ingest_time"`
+}
+
+func (e *DBHostEventLog) JSON() []byte {
+	json, _ := json.Marshal(e)
+	return json
+}
+
+// HostEventLogFilter narrows down a host's event log. Zero values match
+// everything.
+type HostEventLogFilter struct {
+	Service string
+
+	// HostHealthDegraded for warnings and up, HostHealthBad for critical
+	// entries only
+	MinSeverity int
+
+	Since, Until time.Time
+	Search       string
+	Limit        int
+}
+
+// PollEventLogs stores new entries from the host's event logs. Entries
+// without a creation time, or older than EVENT_LOG_RETENTION, are skipped
+// so that pruned entries aren't stored again.
+func (h *DBHost) PollEventLogs() error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	services, err := client.EventLogs()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	cutoff := now.Add(-lib.Config.EventLogRetention)
+	added := int64(0)
+
+	for _, service := range services {
+		entries, err := client.LogEntries(service)
+
+		if err != nil {
+			return err
+		}
+
+		tx, err := QueuedBegin()
+
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			created, err := time.Parse(time.RFC3339, entry.Created)
+
+			if err != nil || created.Before(cutoff) {
+				continue
+			}
+
+			result, err := tx.Exec(INSERT_HOST_EVENT_LOG_STATEMENT, h.Name, service.ID, entry.ID, created.UTC(), HostHealthFromRedfish(entry.Severity), entry.Message, entry.MessageID, entry.EntryType, entry.SensorType, now)
+
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if n, err := result.RowsAffected(); err == nil {
+				added += n
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if err := QueuedExec(PRUNE_HOST_EVENT_LOGS_STATEMENT, h.Name, cutoff); err != nil {
+		return err
+	}
+
+	if added > 0 {
+		lib.Log.Basic(fmt.Sprintf("Stored %d new event log entries for host %s", added, h.Name))
+	}
+
+	return nil
+}
+
+func ListHostEventLogs(name string, filter HostEventLogFilter) ([]*DBHostEventLog, error) {
+	until := filter.Until
+
+	if until.IsZero() {
+		until = time.Now().Add(24 * time.Hour)
+	}
+
+	maxSeverity := HostHealthUnknown
+
+	if filter.MinSeverity != HostHealthGood {
+		maxSeverity = HostHealthBad
+	}
+
+	rows, err := QueuedQuery(SELECT_HOST_EVENT_LOGS_STATEMENT, name, filter.Service, filter.Service, filter.MinSeverity, maxSeverity, filter.Since.UTC(), until.UTC(), filter.Search, filter.Search, filter.Search, filter.Limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	entries := []*DBHostEventLog{}
+
+	for rows.Next() {
+		var e DBHostEventLog
+
+		if err := rows.Scan(&e.ID, &e.HostName, &e.Service, &e.EntryID, &e.Created, &e.Severity, &e.Message, &e.MessageID, &e.EntryType, &e.SensorType, &e.IngestTime); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &e)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+const (
+	testManagerPath = "/redfish/v1/Managers/iDRAC.Embedded.1"
+	testSelPath     = testManagerPath + "/LogServices/Sel"
+)
+
+// Only the logs the driver takes for hardware events are read, across pages,
+// and entries are stored once
+func TestPollEventLogs(t *testing.T) {
+	lib.Config.EventLogRetention = 24 * time.Hour
+
+	bmc := newFakeBMC(t)
+	created := func(ago time.Duration) string {
+		return time.Now().Add(-ago).UTC().Format(time.RFC3339)
+	}
+
+	bmc.Link(t, testManagerPath, "LogServices", testManagerPath+"/LogServices")
+	bmc.Set(testManagerPath+"/LogServices", map[string]interface{}{"Members": []map[string]string{
+		{"@odata.id": testSelPath},
+		{"@odata.id": testManagerPath + "/LogServices/FaultList"},
+	}})
+	bmc.Set(testSelPath, map[string]interface{}{"Id": "Sel", "Name": "IPMI SEL", "Entries": map[string]string{"@odata.id": testSelPath + "/Entries"}})
+
+	// The fault list isn't an event log, so its entries are never asked for
+	bmc.Set(testManagerPath+"/LogServices/FaultList", map[string]interface{}{"Id": "FaultList", "Entries": map[string]string{"@odata.id": testManagerPath + "/LogServices/FaultList/Entries"}})
+
+	bmc.Set(testSelPath+"/Entries", map[string]interface{}{
+		"Members": []map[string]string{
+			{"Id": "1", "Created": created(time.Hour), "Severity": "Critical", "Message": "CPU 1 has an internal error (IERR).", "MessageId": "CPU0000", "EntryType": "SEL", "SensorType": "Processor"},
+			{"Id": "2", "Created": created(48 * time.Hour), "Severity": "OK", "Message": "Log cleared.", "MessageId": "SEL0001", "EntryType": "SEL"},
+			{"Id": "4", "Severity": "OK", "Message": "No creation time.", "EntryType": "SEL"},
+		},
+		"Members@odata.nextLink": testSelPath + "/Entries/Page2",
+	})
+
+	// Some BMCs only link to each entry
+	bmc.Set(testSelPath+"/Entries/Page2", map[string]interface{}{"Members": []map[string]string{{"@odata.id": testSelPath + "/Entries/3"}}})
+	bmc.Set(testSelPath+"/Entries/3", map[string]string{"Id": "3", "Created": created(30 * time.Minute), "Severity": "Warning", "Message": "Fan 1 RPM is less than the lower warning threshold.", "MessageId": "FAN0001", "EntryType": "SEL", "SensorType": "Fan"})
+
+	bmc.Link(t, testSystemPath, "LogServices", testSystemPath+"/LogServices")
+	bmc.Set(testSystemPath+"/LogServices", map[string]interface{}{"Members": []map[string]string{{"@odata.id": testSystemPath + "/LogServices/Lclog"}}})
+	bmc.Set(testSystemPath+"/LogServices/Lclog", map[string]interface{}{"Id": "Lclog", "Entries": map[string]string{"@odata.id": testSystemPath + "/LogServices/Lclog/Entries"}})
+	bmc.Set(testSystemPath+"/LogServices/Lclog/Entries", map[string]interface{}{"Members": []map[string]string{
+		{"Id": "100", "Created": created(10 * time.Minute), "Severity": "OK", "Message": "The system inventory was updated.", "MessageId": "SYS1003", "EntryType": "Oem"},
+	}})
+
+	host, err := CreateHost("event-log-1", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("event-log-1") })
+
+	for range 2 {
+		if err := host.PollEventLogs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := ListHostEventLogs("event-log-1", HostEventLogFilter{Limit: 100})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Newest first
+	want := [][3]string{{"Lclog", "100", "SYS1003"}, {"Sel", "3", "FAN0001"}, {"Sel", "1", "CPU0000"}}
+
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+
+	for i, entry := range entries {
+		if got := [3]string{entry.Service, entry.EntryID, entry.MessageID}; got != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, got, want[i])
+		}
+	}
+
+	if entries[2].Severity != HostHealthBad || entries[2].SensorType != "Processor" || entries[1].Severity != HostHealthDegraded {
+		t.Errorf("entries = %+v, %+v", entries[2], entries[1])
+	}
+
+	tests := []struct {
+		filter HostEventLogFilter
+		want   int
+	}{
+		{HostEventLogFilter{Service: "Lclog"}, 1},
+		{HostEventLogFilter{MinSeverity: HostHealthDegraded}, 2},
+		{HostEventLogFilter{MinSeverity: HostHealthBad}, 1},
+		{HostEventLogFilter{Search: "ierr"}, 1},
+		{HostEventLogFilter{Search: "FAN0001"}, 1},
+		{HostEventLogFilter{Since: time.Now().Add(-45 * time.Minute)}, 2},
+		{HostEventLogFilter{Until: time.Now().Add(-45 * time.Minute)}, 1},
+		{HostEventLogFilter{Limit: 1}, 1},
+	}
+
+	for _, test := range tests {
+		if test.filter.Limit == 0 {
+			test.filter.Limit = 100
+		}
+
+		if entries, err := ListHostEventLogs("event-log-1", test.filter); err != nil {
+			t.Fatal(err)
+		} else if len(entries) != test.want {
+			t.Errorf("%+v: %d entries, want %d", test.filter, len(entries), test.want)
+		}
+	}
+}
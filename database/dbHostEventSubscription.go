@@ -0,0 +1,240 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+var ErrEventContextMismatch = errors.New("event context does not match the subscription")
+
+const (
+	EventSubscriptionActive      = "active"
+	EventSubscriptionUnsupported = "unsupported"
+	EventSubscriptionFailed      = "failed"
+)
+
+// The Redfish event subscription on each host's BMC. Events are POSTed to
+// PUBLIC_URL/events/{token}, so the token is what authenticates them.
+const HOST_EVENT_SUBSCRIPTIONS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_event_subscriptions (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	token TEXT NOT NULL UNIQUE,
+	subscription_uri TEXT NOT NULL,
+	status TEXT NOT NULL,
+	error TEXT NOT NULL,
+	update_time TIMESTAMP NOT NULL,
+	last_event_time TIMESTAMP
+);`
+
+const HOST_EVENT_SUBSCRIPTION_COLUMNS = `host_name, token, subscription_uri, status, error, update_time, last_event_time`
+
+const UPSERT_HOST_EVENT_SUBSCRIPTION_STATEMENT = `INSERT INTO host_event_subscriptions (host_name, token, subscription_uri, status, error, update_time) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET token = excluded.token, subscription_uri = excluded.subscription_uri, status = excluded.status, error = excluded.error, update_time = excluded.update_time;`
+const SELECT_HOST_EVENT_SUBSCRIPTION_STATEMENT = `SELECT ` + HOST_EVENT_SUBSCRIPTION_COLUMNS + ` FROM host_event_subscriptions WHERE host_name = ?;`
+const SELECT_HOST_EVENT_SUBSCRIPTION_BY_TOKEN_STATEMENT = `SELECT ` + HOST_EVENT_SUBSCRIPTION_COLUMNS + ` FROM host_event_subscriptions WHERE token = ?;`
+const UPDATE_HOST_EVENT_SUBSCRIPTION_EVENT_STATEMENT = `UPDATE host_event_subscriptions SET last_event_time = ? WHERE host_name = ?;`
+const DELETE_HOST_EVENT_SUBSCRIPTION_STATEMENT = `DELETE FROM host_event_subscriptions WHERE host_name = ?;`
+
+// Events received are kept with the host's event logs under this service
+const EventLogServicePushed = "Events"
+
+type DBHostEventSubscription struct {
+	HostName        string     `json:"host_name"`
+	Token           string     `json:"-"`
+	SubscriptionURI string     `json:"subscription_uri"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error"`
+	UpdateTime      time.Time  `json:"update_time"`
+	LastEventTime   *time.Time `json:"last_event_time"`
+}
+
+func (s *DBHostEventSubscription) JSON() []byte {
+	json, _ := json.Marshal(s)
+	return json
+}
+
+func GetHostEventSubscription(name string) (*DBHostEventSubscription, error) {
+	return queryHostEventSubscription(SELECT_HOST_EVENT_SUBSCRIPTION_STATEMENT, name)
+}
+
+func GetHostEventSubscriptionByToken(token string) (*DBHostEventSubscription, error) {
+	return queryHostEventSubscription(SELECT_HOST_EVENT_SUBSCRIPTION_BY_TOKEN_STATEMENT, token)
+}
+
+func queryHostEventSubscription(statement string, args ...interface{}) (*DBHostEventSubscription, error) {
+	rows, err := QueuedQuery(statement, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var s DBHostEventSubscription
+	var lastEvent sql.NullTime
+
+	if err := rows.Scan(&s.HostName, &s.Token, &s.SubscriptionURI, &s.Status, &s.Error, &s.UpdateTime, &lastEvent); err != nil {
+		return nil, err
+	}
+
+	s.LastEventTime = nullTime(lastEvent)
+	return &s, nil
+}
+
+func setHostEventSubscription(name, token, uri, status, message string) error {
+	return QueuedExec(UPSERT_HOST_EVENT_SUBSCRIPTION_STATEMENT, name, token, uri, status, message, time.Now())
+}
+
+// HostEventsPushed is true when the host's BMC sends its events, so that its
+// health doesn't need to be polled as often
+func HostEventsPushed(name string) bool {
+	subscription, err := GetHostEventSubscription(name)
+	return err == nil && subscription != nil && subscription.Status == EventSubscriptionActive
+}
+
+func healthPollInterval(h *DBHost) time.Duration {
+	if HostEventsPushed(h.Name) {
+		return lib.Config.PushedHealthPollInterval
+	}
+
+	return lib.Config.HealthPollInterval
+}
+
+// PollEventSubscription makes sure the host's BMC has a subscription for its
+// events, creating one if it doesn't. It does nothing without PUBLIC_URL,
+// since BMCs need it to reach the server.
+func (h *DBHost) PollEventSubscription() error {
+	if lib.Config.PublicURL == "" {
+		return nil
+	}
+
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	current, err := GetHostEventSubscription(h.Name)
+
+	if err != nil {
+		return err
+	}
+
+	if current != nil && current.Status == EventSubscriptionActive {
+		if exists, err := client.SubscriptionExists(current.SubscriptionURI); err != nil {
+			return err
+		} else if exists {
+			return nil
+		}
+
+		lib.Log.Warning(fmt.Sprintf("BMC of host %s dropped its event subscription", h.Name))
+	}
+
+	token := ""
+
+	if current != nil {
+		token = current.Token
+	} else if token, err = newToken(); err != nil {
+		return err
+	}
+
+	destination := strings.TrimSuffix(lib.Config.PublicURL, "/") + "/events/" + token
+	uri, err := client.Subscribe(destination, eventContext(h.Name))
+
+	switch {
+	case errors.Is(err, redfish.ErrEventServiceUnsupported):
+		return setHostEventSubscription(h.Name, token, "", EventSubscriptionUnsupported, err.Error())
+	case err != nil:
+		if recordErr := setHostEventSubscription(h.Name, token, "", EventSubscriptionFailed, err.Error()); recordErr != nil {
+			return recordErr
+		}
+
+		return err
+	}
+
+	lib.Log.Basic(fmt.Sprintf("Subscribed to events from host %s", h.Name))
+	return setHostEventSubscription(h.Name, token, uri, EventSubscriptionActive, "")
+}
+
+// eventContext is what identifies the subscription on the BMC, and is sent
+// back with every event
+func eventContext(name string) string {
+	return "OpnLaaS " + name
+}
+
+// Unsubscribe removes the host's event subscription from its BMC, for when
+// the host is being deleted
+func (h *DBHost) Unsubscribe() error {
+	current, err := GetHostEventSubscription(h.Name)
+
+	if err != nil || current == nil || current.SubscriptionURI == "" {
+		return err
+	}
+
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	return client.Unsubscribe(current.SubscriptionURI)
+}
+
+// ReceiveHostEvents stores the events a host's BMC sent with its event logs
+// and has its health polled right away, which opens or resolves its issues
+func ReceiveHostEvents(subscription *DBHostEventSubscription, event *redfish.Event) error {
+	if event.Context != "" && event.Context != eventContext(subscription.HostName) {
+		return ErrEventContextMismatch
+	}
+
+	now := time.Now().UTC()
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for i, record := range event.Events {
+		created, err := time.Parse(time.RFC3339, record.EventTimestamp)
+
+		if err != nil {
+			created = now
+		}
+
+		id := record.EventID
+
+		if id == "" {
+			id = fmt.Sprintf("%d-%d", now.UnixNano(), i)
+		}
+
+		if _, err := tx.Exec(INSERT_HOST_EVENT_LOG_STATEMENT, subscription.HostName, EventLogServicePushed, id, created.UTC(), HostHealthFromRedfish(record.Health()), record.Message, record.MessageID, record.EventType, "", now); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(UPDATE_HOST_EVENT_SUBSCRIPTION_EVENT_STATEMENT, now, subscription.HostName); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if !pollHostKindNow(subscription.HostName, PollKindHealth) {
+		lib.Log.Warning(fmt.Sprintf("Could not queue health poll for host %s after an event", subscription.HostName))
+	}
+
+	return nil
+}
@@ -0,0 +1,382 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+var (
+	ErrFirmwareMinimum         = errors.New("minimum needs a model, a firmware category and a version")
+	ErrFirmwareMinimumNotFound = errors.New("no minimum set for that model and category")
+)
+
+const firmwareReportTick = time.Hour
+
+// The firmware installed on each host as of the last hardware poll
+const HOST_FIRMWARE_STATEMENT = `CREATE TABLE IF NOT EXISTS host_firmware (
+	host_name TEXT NOT NULL,
+	firmware_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	category TEXT NOT NULL,
+	version TEXT NOT NULL,
+	updateable INTEGER NOT NULL,
+	PRIMARY KEY (host_name, firmware_id)
+);`
+
+// The oldest firmware admins accept for each kind of firmware, per system
+// model as the BMC reports it, e.g. "PowerEdge R640"
+const FIRMWARE_MINIMUMS_STATEMENT = `CREATE TABLE IF NOT EXISTS firmware_minimums (
+	model TEXT NOT NULL,
+	category TEXT NOT NULL,
+	version TEXT NOT NULL,
+	set_by TEXT NOT NULL,
+	update_time TIMESTAMP NOT NULL,
+	PRIMARY KEY (model, category)
+);`
+
+// When the outdated firmware report went out, so restarts don't reset its
+// schedule
+const FIRMWARE_REPORTS_STATEMENT = `CREATE TABLE IF NOT EXISTS firmware_reports (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	send_time TIMESTAMP NOT NULL,
+	outdated_hosts INTEGER NOT NULL
+);`
+
+const INSERT_HOST_FIRMWARE_STATEMENT = `INSERT OR REPLACE INTO host_firmware (host_name, firmware_id, name, category, version, updateable) VALUES (?, ?, ?, ?, ?, ?);`
+const DELETE_HOST_FIRMWARE_STATEMENT = `DELETE FROM host_firmware WHERE host_name = ?;`
+
+// Firmware along with the minimum set for its host's model, if any
+const HOST_FIRMWARE_MINIMUM_COLUMNS = `f.host_name, COALESCE(b.system_model, ''), f.firmware_id, f.name, f.category, f.version, f.updateable, COALESCE(m.version, '')`
+const SELECT_HOST_FIRMWARE_STATEMENT = `SELECT ` + HOST_FIRMWARE_MINIMUM_COLUMNS + ` FROM host_firmware f
+	LEFT JOIN host_bmc b ON b.host_name = f.host_name
+	LEFT JOIN firmware_minimums m ON m.model = b.system_model AND m.category = f.category
+	WHERE f.host_name = ? ORDER BY f.category, f.firmware_id;`
+const SELECT_FIRMWARE_WITH_MINIMUMS_STATEMENT = `SELECT ` + HOST_FIRMWARE_MINIMUM_COLUMNS + ` FROM host_firmware f
+	JOIN host_bmc b ON b.host_name = f.host_name
+	JOIN firmware_minimums m ON m.model = b.system_model AND m.category = f.category
+	ORDER BY f.host_name, f.category, f.firmware_id;`
+
+const UPSERT_FIRMWARE_MINIMUM_STATEMENT = `INSERT INTO firmware_minimums (model, category, version, set_by, update_time) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (model, category) DO UPDATE SET version = excluded.version, set_by = excluded.set_by, update_time = excluded.update_time;`
+const SELECT_FIRMWARE_MINIMUMS_STATEMENT = `SELECT model, category, version, set_by, update_time FROM firmware_minimums ORDER BY model, category;`
+const DELETE_FIRMWARE_MINIMUM_STATEMENT = `DELETE FROM firmware_minimums WHERE model = ? AND category = ?;`
+
+const INSERT_FIRMWARE_REPORT_STATEMENT = `INSERT INTO firmware_reports (send_time, outdated_hosts) VALUES (?, ?);`
+const SELECT_LAST_FIRMWARE_REPORT_STATEMENT = `SELECT send_time FROM firmware_reports ORDER BY id DESC LIMIT 1;`
+
+type DBHostFirmware struct {
+	HostName       string `json:"-"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Category       string `json:"category"`
+	Version        string `json:"version"`
+	Updateable     bool   `json:"updateable"`
+	MinimumVersion string `json:"minimum_version"`
+	Outdated       bool   `json:"outdated"`
+}
+
+type DBFirmwareMinimum struct {
+	Model      string    `json:"model"`
+	Category   string    `json:"category"`
+	Version    string    `json:"version"`
+	SetBy      string    `json:"set_by"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+func (m *DBFirmwareMinimum) JSON() []byte {
+	json, _ := json.Marshal(m)
+	return json
+}
+
+// DBOutdatedHost is a host with firmware older than the minimum for its model
+type DBOutdatedHost struct {
+	HostName string            `json:"host_name"`
+	Model    string            `json:"model"`
+	Firmware []*DBHostFirmware `json:"firmware"`
+}
+
+func SetHostFirmware(name string, firmware []redfish.Firmware) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DELETE_HOST_FIRMWARE_STATEMENT, name); err != nil {
+		return err
+	}
+
+	for _, item := range firmware {
+		if _, err := tx.Exec(INSERT_HOST_FIRMWARE_STATEMENT, name, item.ID, item.Name, item.Category, item.Version, item.Updateable); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetHostFirmware lists the host's firmware, each with the minimum version
+// for the host's model
+func GetHostFirmware(name string) ([]*DBHostFirmware, error) {
+	firmware := []*DBHostFirmware{}
+
+	err := queryEach(SELECT_HOST_FIRMWARE_STATEMENT, name, func(rows *sql.Rows) error {
+		f, _, err := scanHostFirmware(rows)
+
+		if err != nil {
+			return err
+		}
+
+		firmware = append(firmware, f)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return firmware, nil
+}
+
+// ListOutdatedHosts lists the hosts with firmware older than the minimum set
+// for their model, along with only that firmware
+func ListOutdatedHosts() ([]*DBOutdatedHost, error) {
+	rows, err := QueuedQuery(SELECT_FIRMWARE_WITH_MINIMUMS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	hosts := []*DBOutdatedHost{}
+
+	for rows.Next() {
+		f, model, err := scanHostFirmware(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !f.Outdated {
+			continue
+		}
+
+		if len(hosts) == 0 || hosts[len(hosts)-1].HostName != f.HostName {
+			hosts = append(hosts, &DBOutdatedHost{HostName: f.HostName, Model: model})
+		}
+
+		host := hosts[len(hosts)-1]
+		host.Firmware = append(host.Firmware, f)
+	}
+
+	return hosts, rows.Err()
+}
+
+func scanHostFirmware(rows *sql.Rows) (*DBHostFirmware, string, error) {
+	var f DBHostFirmware
+	var model string
+
+	if err := rows.Scan(&f.HostName, &model, &f.ID, &f.Name, &f.Category, &f.Version, &f.Updateable, &f.MinimumVersion); err != nil {
+		return nil, "", err
+	}
+
+	f.Outdated = f.MinimumVersion != "" && compareFirmwareVersions(f.Version, f.MinimumVersion) < 0
+	return &f, model, nil
+}
+
+var firmwareVersionNumbers = regexp.MustCompile(`\d+`)
+
+// compareFirmwareVersions compares the numbers in two versions in order, so
+// "2.10.0" is newer than "2.9.3". Vendors format versions every which way,
+// which is why minimums should be written the way the BMC reports them.
+// Versions without numbers are never older than anything.
+func compareFirmwareVersions(a, b string) int {
+	aNumbers := firmwareVersionNumbers.FindAllString(a, -1)
+	bNumbers := firmwareVersionNumbers.FindAllString(b, -1)
+
+	if len(aNumbers) == 0 || len(bNumbers) == 0 {
+		return 0
+	}
+
+	for i := 0; i < max(len(aNumbers), len(bNumbers)); i++ {
+		var x, y int
+
+		if i < len(aNumbers) {
+			x, _ = strconv.Atoi(aNumbers[i])
+		}
+
+		if i < len(bNumbers) {
+			y, _ = strconv.Atoi(bNumbers[i])
+		}
+
+		if x != y {
+			return x - y
+		}
+	}
+
+	return 0
+}
+
+func SetFirmwareMinimum(model, category, version, setBy string) (*DBFirmwareMinimum, error) {
+	model, version = strings.TrimSpace(model), strings.TrimSpace(version)
+
+	if model == "" || !slices.Contains(redfish.FirmwareCategories, category) || !firmwareVersionNumbers.MatchString(version) {
+		return nil, ErrFirmwareMinimum
+	}
+
+	minimum := &DBFirmwareMinimum{model, category, version, setBy, time.Now()}
+
+	if err := QueuedExec(UPSERT_FIRMWARE_MINIMUM_STATEMENT, minimum.Model, minimum.Category, minimum.Version, minimum.SetBy, minimum.UpdateTime); err != nil {
+		return nil, err
+	}
+
+	return minimum, nil
+}
+
+func ListFirmwareMinimums() ([]*DBFirmwareMinimum, error) {
+	rows, err := QueuedQuery(SELECT_FIRMWARE_MINIMUMS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	minimums := []*DBFirmwareMinimum{}
+
+	for rows.Next() {
+		var m DBFirmwareMinimum
+
+		if err := rows.Scan(&m.Model, &m.Category, &m.Version, &m.SetBy, &m.UpdateTime); err != nil {
+			return nil, err
+		}
+
+		minimums = append(minimums, &m)
+	}
+
+	return minimums, rows.Err()
+}
+
+func DeleteFirmwareMinimum(model, category string) error {
+	result, err := QueuedExecResult(DELETE_FIRMWARE_MINIMUM_STATEMENT, model, category)
+
+	if err != nil {
+		return err
+	}
+
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrFirmwareMinimumNotFound
+	}
+
+	return nil
+}
+
+// StartFirmwareReports emails admins the hosts with outdated firmware every
+// FIRMWARE_REPORT_INTERVAL
+func StartFirmwareReports() {
+	if lib.Config.FirmwareReportInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(firmwareReportTick)
+		defer ticker.Stop()
+
+		for {
+			if err := sendFirmwareReportIfDue(); err != nil {
+				lib.Log.Error("Could not send firmware report: " + err.Error())
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+func sendFirmwareReportIfDue() error {
+	rows, err := QueuedQuery(SELECT_LAST_FIRMWARE_REPORT_STATEMENT)
+
+	if err != nil {
+		return err
+	}
+
+	var last sql.NullTime
+
+	if rows.Next() {
+		err = rows.Scan(&last)
+	}
+
+	rows.Close()
+
+	if err != nil {
+		return err
+	}
+
+	if last.Valid && time.Since(last.Time) < lib.Config.FirmwareReportInterval {
+		return nil
+	}
+
+	hosts, err := ListOutdatedHosts()
+
+	if err != nil {
+		return err
+	}
+
+	// Recorded first, so a mail server that is down doesn't get the report
+	// retried every tick
+	if err := QueuedExec(INSERT_FIRMWARE_REPORT_STATEMENT, time.Now(), len(hosts)); err != nil {
+		return err
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	admins, err := ListAdminEmails()
+
+	if err != nil || len(admins) == 0 {
+		return err
+	}
+
+	subject := fmt.Sprintf("[%s] Firmware report: %d host(s) outdated", lib.Config.LabName, len(hosts))
+
+	if err := lib.SendEmail(admins, subject, firmwareReportBody(hosts)); err != nil {
+		return err
+	}
+
+	lib.Log.Basic(fmt.Sprintf("Emailed %d admin(s) the firmware report", len(admins)))
+	return nil
+}
+
+func firmwareReportBody(hosts []*DBOutdatedHost) string {
+	var body strings.Builder
+
+	body.WriteString("<p>The following hosts run firmware older than the minimum set for their model:</p>")
+
+	for _, host := range hosts {
+		fmt.Fprintf(&body, "<h3>%s (%s)</h3><ul>", html.EscapeString(host.HostName), html.EscapeString(host.Model))
+
+		for _, f := range host.Firmware {
+			fmt.Fprintf(&body, "<li><b>%s</b> (%s): %s, minimum %s</li>", html.EscapeString(f.Name), f.Category, html.EscapeString(f.Version), html.EscapeString(f.MinimumVersion))
+		}
+
+		body.WriteString("</ul>")
+	}
+
+	return body.String()
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+const HOST_HEALTH_COMPONENTS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_health_components (
+	host_name TEXT NOT NULL,
+	component TEXT NOT NULL,
+	health INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	update_time TIMESTAMP NOT NULL,
+	PRIMARY KEY (host_name, component)
+);`
+
+const INSERT_HOST_HEALTH_COMPONENT_STATEMENT = `INSERT INTO host_health_components (host_name, component, health, message, update_time) VALUES (?, ?, ?, ?, ?);`
+const SELECT_HOST_HEALTH_COMPONENTS_STATEMENT = `SELECT host_name, component, health, message, update_time FROM host_health_components WHERE host_name = ? ORDER BY health DESC, component;`
+const DELETE_HOST_HEALTH_COMPONENTS_STATEMENT = `DELETE FROM host_health_components WHERE host_name = ?;`
+
+// The BMC itself is reported as a component when it cannot be queried
+const HostComponentBMC = "BMC"
+
+type DBHostHealthComponent struct {
+	HostName   string    `json:"-"`
+	Component  string    `json:"component"`
+	Health     int       `json:"health"`
+	Message    string    `json:"message"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+func (c *DBHostHealthComponent) JSON() []byte {
+	json, _ := json.Marshal(c)
+	return json
+}
+
+func HostHealthFromRedfish(health string) int {
+	switch health {
+	case redfish.HealthOK:
+		return HostHealthGood
+	case redfish.HealthWarning:
+		return HostHealthDegraded
+	case redfish.HealthCritical:
+		return HostHealthBad
+	default:
+		return HostHealthUnknown
+	}
+}
+
+// HostHealthSeverity orders health values from Good (0) to Bad (3). A BMC
+// that can't be reached is as severe as degraded hardware, since the host
+// can't be managed.
+func HostHealthSeverity(health int) int {
+	switch health {
+	case HostHealthGood:
+		return 0
+	case HostHealthDegraded, HostHealthUnreachable:
+		return 2
+	case HostHealthBad:
+		return 3
+	default:
+		return 1
+	}
+}
+
+func WorseHostHealth(a, b int) int {
+	if HostHealthSeverity(b) > HostHealthSeverity(a) {
+		return b
+	}
+
+	return a
+}
+
+func GetHostHealthComponents(name string) ([]*DBHostHealthComponent, error) {
+	rows, err := QueuedQuery(SELECT_HOST_HEALTH_COMPONENTS_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	components := []*DBHostHealthComponent{}
+
+	for rows.Next() {
+		var component DBHostHealthComponent
+
+		if err := rows.Scan(&component.HostName, &component.Component, &component.Health, &component.Message, &component.UpdateTime); err != nil {
+			return nil, err
+		}
+
+		components = append(components, &component)
+	}
+
+	return components, rows.Err()
+}
+
+// SetHostHealth replaces the host's health and unhealthy components
+func SetHostHealth(name string, health int, components []*DBHostHealthComponent) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(UPDATE_HOST_HEALTH_STATEMENT, health, name); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(DELETE_HOST_HEALTH_COMPONENTS_STATEMENT, name); err != nil {
+		return err
+	}
+
+	for _, component := range components {
+		if _, err := tx.Exec(INSERT_HOST_HEALTH_COMPONENT_STATEMENT, name, component.Component, component.Health, component.Message, component.UpdateTime); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PollHealth queries the BMC for the health of the host and its components.
+// A BMC that cannot be reached leaves the host as HostHealthUnreachable so
+// that it is not mistaken for bad hardware.
+func (h *DBHost) PollHealth() error {
+	now := time.Now()
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	report, err := client.Health()
+
+	if err != nil {
+		health := HostHealthUnknown
+
+		if errors.Is(err, redfish.ErrUnreachable) {
+			health = HostHealthUnreachable
+		}
+
+		h.Health = health
+		components := []*DBHostHealthComponent{{HostName: h.Name, Component: HostComponentBMC, Health: health, Message: err.Error(), UpdateTime: now}}
+
+		if dbErr := SetHostHealth(h.Name, health, components); dbErr != nil {
+			return dbErr
+		}
+
+		// The hardware's health isn't known either way, so its issues are
+		// left open rather than resolved until the BMC answers again
+		if dbErr := ReportRaisedHostIssues(h.Name, IssueSourceBMC, []*DBHostIssue{{Component: HostComponentBMC, Severity: health, Message: err.Error()}}); dbErr != nil {
+			return dbErr
+		}
+
+		return err
+	}
+
+	health := HostHealthFromRedfish(report.HealthRollup)
+
+	if report.HealthRollup == "" {
+		health = HostHealthFromRedfish(report.Health)
+	}
+
+	components := []*DBHostHealthComponent{}
+
+	for _, component := range report.Components {
+		components = append(components, &DBHostHealthComponent{
+			HostName:   h.Name,
+			Component:  component.Component,
+			Health:     HostHealthFromRedfish(component.Health),
+			Message:    component.Message,
+			UpdateTime: now,
+		})
+
+		health = WorseHostHealth(health, HostHealthFromRedfish(component.Health))
+	}
+
+	h.Health = health
+
+	if err := SetHostHealth(h.Name, health, components); err != nil {
+		return err
+	}
+
+	if err := ReportHostIssues(h.Name, IssueSourceBMC, nil); err != nil {
+		return err
+	}
+
+	return h.reportHealthIssues(components)
+}
+
+func (h *DBHost) reportHealthIssues(components []*DBHostHealthComponent) error {
+	found := []*DBHostIssue{}
+
+	for _, component := range components {
+		if component.Health != HostHealthGood {
+			found = append(found, &DBHostIssue{Component: component.Component, Severity: component.Health, Message: component.Message})
+		}
+	}
+
+	return ReportHostIssues(h.Name, IssueSourceHealth, found)
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"encoding/json"
+	"net"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// The host's network interfaces as of the last hardware poll. MAC addresses
+// are how hosts are recognized when they network boot.
+const HOST_INTERFACES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_interfaces (
+	host_name TEXT NOT NULL,
+	interface_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	mac_address TEXT NOT NULL,
+	link_status TEXT NOT NULL,
+	speed_mbps INTEGER NOT NULL,
+	PRIMARY KEY (host_name, interface_id)
+);
+CREATE INDEX IF NOT EXISTS host_interfaces_mac ON host_interfaces (mac_address);`
+
+const INSERT_HOST_INTERFACE_STATEMENT = `INSERT INTO host_interfaces (host_name, interface_id, name, mac_address, link_status, speed_mbps) VALUES (?, ?, ?, ?, ?, ?);`
+const SELECT_HOST_INTERFACES_STATEMENT = `SELECT interface_id, name, mac_address, link_status, speed_mbps FROM host_interfaces WHERE host_name = ? ORDER BY interface_id;`
+const SELECT_HOST_BY_MAC_STATEMENT = `SELECT host_name FROM host_interfaces WHERE mac_address = ? LIMIT 1;`
+const DELETE_HOST_INTERFACES_STATEMENT = `DELETE FROM host_interfaces WHERE host_name = ?;`
+
+type DBHostInterface struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	MACAddress string `json:"mac_address"`
+	LinkStatus string `json:"link_status"`
+	SpeedMbps  int    `json:"speed_mbps"`
+}
+
+func (i *DBHostInterface) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+// NormalizeMAC writes a MAC address the way iPXE does, lowercase and colon
+// separated, or returns "" if it isn't one
+func NormalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(mac)
+
+	if err != nil {
+		return ""
+	}
+
+	return hw.String()
+}
+
+func SetHostInterfaces(name string, nics []redfish.EthernetInterface) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DELETE_HOST_INTERFACES_STATEMENT, name); err != nil {
+		return err
+	}
+
+	for _, nic := range nics {
+		// Partitioned and virtual interfaces can have a MACAddress that
+		// differs from the port's burned in one
+		mac := NormalizeMAC(nic.MACAddress)
+
+		if mac == "" {
+			mac = NormalizeMAC(nic.PermanentMACAddress)
+		}
+
+		description := nic.Description
+
+		if description == "" {
+			description = nic.Name
+		}
+
+		if _, err := tx.Exec(INSERT_HOST_INTERFACE_STATEMENT, name, nic.ID, description, mac, nic.LinkStatus, nic.SpeedMbps); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetHostInterfaces(name string) ([]*DBHostInterface, error) {
+	rows, err := QueuedQuery(SELECT_HOST_INTERFACES_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	nics := []*DBHostInterface{}
+
+	for rows.Next() {
+		var nic DBHostInterface
+
+		if err := rows.Scan(&nic.ID, &nic.Name, &nic.MACAddress, &nic.LinkStatus, &nic.SpeedMbps); err != nil {
+			return nil, err
+		}
+
+		nics = append(nics, &nic)
+	}
+
+	return nics, rows.Err()
+}
+
+// FindHostByMAC returns the name of the host with a network interface with
+// this MAC address, or "" if there is none
+func FindHostByMAC(mac string) (string, error) {
+	mac = NormalizeMAC(mac)
+
+	if mac == "" {
+		return "", nil
+	}
+
+	rows, err := QueuedQuery(SELECT_HOST_BY_MAC_STATEMENT, mac)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return "", rows.Err()
+	}
+
+	var name string
+	return name, rows.Scan(&name)
+}
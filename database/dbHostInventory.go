@@ -0,0 +1,166 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// A snapshot is only added when the hardware changes. Polls that find the
+// same hardware move last_seen forward instead.
+const HOST_INVENTORY_STATEMENT = `CREATE TABLE IF NOT EXISTS host_inventory (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_name TEXT NOT NULL,
+	first_seen TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL,
+	cpu_count INTEGER NOT NULL,
+	cpu_speed_mhz INTEGER NOT NULL,
+	cpu_cores INTEGER NOT NULL,
+	memory_total_mib INTEGER NOT NULL,
+	memory_speed_mhz INTEGER NOT NULL,
+	virtual_storage_size_mib INTEGER NOT NULL,
+	networking_provider TEXT NOT NULL,
+	networking_speed_mbps INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS host_inventory_host ON host_inventory (host_name, first_seen);`
+
+const HOST_INVENTORY_COLUMNS = `id, host_name, first_seen, last_seen, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps`
+
+const INSERT_HOST_INVENTORY_STATEMENT = `INSERT INTO host_inventory (host_name, first_seen, last_seen, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const SELECT_HOST_INVENTORY_HISTORY_STATEMENT = `SELECT ` + HOST_INVENTORY_COLUMNS + ` FROM host_inventory WHERE host_name = ? ORDER BY first_seen DESC, id DESC LIMIT ?;`
+const UPDATE_HOST_INVENTORY_SEEN_STATEMENT = `UPDATE host_inventory SET last_seen = ? WHERE id = ?;`
+const DELETE_HOST_INVENTORY_STATEMENT = `DELETE FROM host_inventory WHERE host_name = ?;`
+
+type DBHostInventory struct {
+	ID                    int       `json:"id"`
+	HostName              string    `json:"-"`
+	FirstSeen             time.Time `json:"first_seen"`
+	LastSeen              time.Time `json:"last_seen"`
+	CPUCount              int       `json:"cpu_count"`
+	CPUSpeedMHz           int       `json:"cpu_speed_mhz"`
+	CPUCores              int       `json:"cpu_cores"`
+	MemoryTotalMiB        int       `json:"memory_total_mib"`
+	MemorySpeedMHz        int       `json:"memory_speed_mhz"`
+	VirtualStorageSizeMiB int       `json:"virtual_storage_size_mib"`
+	NetworkingProvider    string    `json:"networking_provider"`
+	NetworkingSpeedMbps   int       `json:"networking_speed_mbps"`
+}
+
+func (i *DBHostInventory) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+type inventoryField struct {
+	component, unit string
+	value           func(i *DBHostInventory) int
+}
+
+// Hardware doesn't shrink or slow down on its own, so a drop in any of
+// these means something failed or was pulled
+var inventoryFields = []inventoryField{
+	{"CPU count", "", func(i *DBHostInventory) int { return i.CPUCount }},
+	{"CPU cores", "", func(i *DBHostInventory) int { return i.CPUCores }},
+	{"CPU speed", " MHz", func(i *DBHostInventory) int { return i.CPUSpeedMHz }},
+	{"Memory size", " MiB", func(i *DBHostInventory) int { return i.MemoryTotalMiB }},
+	{"Memory speed", " MHz", func(i *DBHostInventory) int { return i.MemorySpeedMHz }},
+	{"Storage size", " MiB", func(i *DBHostInventory) int { return i.VirtualStorageSizeMiB }},
+	{"Network speed", " Mbps", func(i *DBHostInventory) int { return i.NetworkingSpeedMbps }},
+}
+
+func inventoryFromRedfish(name string, inv *redfish.Inventory, at time.Time) *DBHostInventory {
+	return &DBHostInventory{
+		HostName:              name,
+		FirstSeen:             at,
+		LastSeen:              at,
+		CPUCount:              inv.CPUCount,
+		CPUSpeedMHz:           inv.CPUSpeedMHz,
+		CPUCores:              inv.CPUCores,
+		MemoryTotalMiB:        inv.MemoryTotalMiB,
+		MemorySpeedMHz:        inv.MemorySpeedMHz,
+		VirtualStorageSizeMiB: inv.VirtualStorageSizeMiB,
+		NetworkingProvider:    inv.NetworkingProvider,
+		NetworkingSpeedMbps:   inv.NetworkingSpeedMbps,
+	}
+}
+
+func (i *DBHostInventory) sameHardware(other *DBHostInventory) bool {
+	for _, field := range inventoryFields {
+		if field.value(i) != field.value(other) {
+			return false
+		}
+	}
+
+	return i.NetworkingProvider == other.NetworkingProvider
+}
+
+func GetHostInventoryHistory(name string, limit int) ([]*DBHostInventory, error) {
+	rows, err := QueuedQuery(SELECT_HOST_INVENTORY_HISTORY_STATEMENT, name, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	history := []*DBHostInventory{}
+
+	for rows.Next() {
+		var i DBHostInventory
+
+		if err := rows.Scan(&i.ID, &i.HostName, &i.FirstSeen, &i.LastSeen, &i.CPUCount, &i.CPUSpeedMHz, &i.CPUCores, &i.MemoryTotalMiB, &i.MemorySpeedMHz, &i.VirtualStorageSizeMiB, &i.NetworkingProvider, &i.NetworkingSpeedMbps); err != nil {
+			return nil, err
+		}
+
+		history = append(history, &i)
+	}
+
+	return history, rows.Err()
+}
+
+// recordInventory compares a poll with the last snapshot, stores it if the
+// hardware changed and raises an issue for anything that dropped
+func (h *DBHost) recordInventory(inv *redfish.Inventory) error {
+	now := time.Now()
+	current := inventoryFromRedfish(h.Name, inv, now)
+
+	history, err := GetHostInventoryHistory(h.Name, 1)
+
+	if err != nil {
+		return err
+	}
+
+	if len(history) > 0 && history[0].sameHardware(current) {
+		return QueuedExec(UPDATE_HOST_INVENTORY_SEEN_STATEMENT, now, history[0].ID)
+	}
+
+	if err := QueuedExec(INSERT_HOST_INVENTORY_STATEMENT, h.Name, now, now, current.CPUCount, current.CPUSpeedMHz, current.CPUCores, current.MemoryTotalMiB, current.MemorySpeedMHz, current.VirtualStorageSizeMiB, current.NetworkingProvider, current.NetworkingSpeedMbps); err != nil {
+		return err
+	}
+
+	if len(history) == 0 {
+		return nil
+	}
+
+	found := []*DBHostIssue{}
+
+	for _, field := range inventoryFields {
+		before, after := field.value(history[0]), field.value(current)
+
+		if after < before {
+			found = append(found, &DBHostIssue{
+				Component: field.component,
+				Severity:  HostHealthDegraded,
+				Message:   fmt.Sprintf("%s dropped from %d%s to %d%s", field.component, before, field.unit, after, field.unit),
+			})
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+
+	return ReportRaisedHostIssues(h.Name, IssueSourceInventory, found)
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrIssueNotFound = errors.New("issue not found")
+
+const HOST_ISSUES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_issues (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	host_name TEXT NOT NULL,
+	source TEXT NOT NULL,
+	component TEXT NOT NULL,
+	severity INTEGER NOT NULL,
+	message TEXT NOT NULL,
+	first_seen TIMESTAMP NOT NULL,
+	last_seen TIMESTAMP NOT NULL,
+	resolved_time TIMESTAMP,
+	notified_severity INTEGER,
+	acknowledged_by TEXT NOT NULL DEFAULT '',
+	acknowledged_time TIMESTAMP,
+	silenced_until TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS host_issues_open ON host_issues (host_name, source, component) WHERE resolved_time IS NULL;`
+
+const HOST_ISSUE_COLUMNS = `id, host_name, source, component, severity, message, first_seen, last_seen, resolved_time, notified_severity, acknowledged_by, acknowledged_time, silenced_until`
+
+const INSERT_HOST_ISSUE_STATEMENT = `INSERT INTO host_issues (host_name, source, component, severity, message, first_seen, last_seen) VALUES (?, ?, ?, ?, ?, ?, ?);`
+const SELECT_HOST_ISSUE_STATEMENT = `SELECT ` + HOST_ISSUE_COLUMNS + ` FROM host_issues WHERE id = ?;`
+const SELECT_OPEN_HOST_ISSUES_STATEMENT = `SELECT ` + HOST_ISSUE_COLUMNS + ` FROM host_issues WHERE host_name = ? AND source = ? AND resolved_time IS NULL;`
+const SELECT_ISSUES_STATEMENT = `SELECT ` + HOST_ISSUE_COLUMNS + ` FROM host_issues WHERE (? = '' OR host_name = ?) AND (? OR resolved_time IS NULL) ORDER BY last_seen DESC LIMIT 500;`
+const UPDATE_HOST_ISSUE_SEEN_STATEMENT = `UPDATE host_issues SET severity = ?, message = ?, last_seen = ? WHERE id = ?;`
+const UPDATE_HOST_ISSUE_RESOLVED_STATEMENT = `UPDATE host_issues SET resolved_time = ? WHERE id = ?;`
+const UPDATE_HOST_ISSUE_NOTIFIED_STATEMENT = `UPDATE host_issues SET notified_severity = ? WHERE id = ?;`
+const UPDATE_HOST_ISSUE_ACKNOWLEDGED_STATEMENT = `UPDATE host_issues SET acknowledged_by = ?, acknowledged_time = ? WHERE id = ?;`
+const UPDATE_HOST_ISSUE_SILENCED_STATEMENT = `UPDATE host_issues SET silenced_until = ? WHERE id = ?;`
+const DELETE_HOST_ISSUES_STATEMENT = `DELETE FROM host_issues WHERE host_name = ?;`
+
+const (
+	IssueSourceHealth    = "health"
+	IssueSourceBMC       = "bmc"
+	IssueSourceInventory = "inventory"
+	IssueSourceDrives    = "drives"
+	IssueSourceHardware  = "hardware"
+)
+
+type DBHostIssue struct {
+	ID               int        `json:"id"`
+	HostName         string     `json:"host_name"`
+	Source           string     `json:"source"`
+	Component        string     `json:"component"`
+	Severity         int        `json:"severity"`
+	Message          string     `json:"message"`
+	FirstSeen        time.Time  `json:"first_seen"`
+	LastSeen         time.Time  `json:"last_seen"`
+	ResolvedTime     *time.Time `json:"resolved_time"`
+	NotifiedSeverity *int       `json:"-"`
+	AcknowledgedBy   string     `json:"acknowledged_by"`
+	AcknowledgedTime *time.Time `json:"acknowledged_time"`
+	SilencedUntil    *time.Time `json:"silenced_until"`
+}
+
+func (i *DBHostIssue) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+func (i *DBHostIssue) Silenced(at time.Time) bool {
+	return i.SilencedUntil != nil && i.SilencedUntil.After(at)
+}
+
+func (i *DBHostIssue) Notified() bool {
+	return i.NotifiedSeverity != nil
+}
+
+// Escalated is true when the issue is worse than it was when admins were
+// last told about it, including when they haven't been told at all
+func (i *DBHostIssue) Escalated() bool {
+	return !i.Notified() || HostHealthSeverity(i.Severity) > HostHealthSeverity(*i.NotifiedSeverity)
+}
+
+func GetHostIssue(id int) (*DBHostIssue, error) {
+	issues, err := queryHostIssues(SELECT_HOST_ISSUE_STATEMENT, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(issues) == 0 {
+		return nil, nil
+	}
+
+	return issues[0], nil
+}
+
+// ListHostIssues lists the most recent issues, for one host if name is set
+func ListHostIssues(name string, includeResolved bool) ([]*DBHostIssue, error) {
+	return queryHostIssues(SELECT_ISSUES_STATEMENT, name, name, includeResolved)
+}
+
+func AcknowledgeHostIssue(id int, email string) error {
+	if err := requireHostIssue(id); err != nil {
+		return err
+	}
+
+	return QueuedExec(UPDATE_HOST_ISSUE_ACKNOWLEDGED_STATEMENT, email, time.Now(), id)
+}
+
+// SilenceHostIssue stops emails about the issue until the given time. A zero
+// time lifts the silence.
+func SilenceHostIssue(id int, until time.Time) error {
+	if err := requireHostIssue(id); err != nil {
+		return err
+	}
+
+	if until.IsZero() {
+		return QueuedExec(UPDATE_HOST_ISSUE_SILENCED_STATEMENT, nil, id)
+	}
+
+	return QueuedExec(UPDATE_HOST_ISSUE_SILENCED_STATEMENT, until, id)
+}
+
+func ResolveHostIssue(id int) error {
+	issue, err := GetHostIssue(id)
+
+	if err != nil {
+		return err
+	}
+
+	if issue == nil {
+		return ErrIssueNotFound
+	}
+
+	if issue.ResolvedTime != nil {
+		return nil
+	}
+
+	return QueuedExec(UPDATE_HOST_ISSUE_RESOLVED_STATEMENT, time.Now(), id)
+}
+
+func requireHostIssue(id int) error {
+	issue, err := GetHostIssue(id)
+
+	if err != nil {
+		return err
+	}
+
+	if issue == nil {
+		return ErrIssueNotFound
+	}
+
+	return nil
+}
+
+func queryHostIssues(query string, args ...interface{}) ([]*DBHostIssue, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	issues := []*DBHostIssue{}
+
+	for rows.Next() {
+		var issue DBHostIssue
+		var resolved, acknowledged, silenced sql.NullTime
+		var notified sql.NullInt64
+
+		if err := rows.Scan(&issue.ID, &issue.HostName, &issue.Source, &issue.Component, &issue.Severity, &issue.Message, &issue.FirstSeen, &issue.LastSeen, &resolved, &notified, &issue.AcknowledgedBy, &acknowledged, &silenced); err != nil {
+			return nil, err
+		}
+
+		issue.ResolvedTime = nullTime(resolved)
+		issue.AcknowledgedTime = nullTime(acknowledged)
+		issue.SilencedUntil = nullTime(silenced)
+
+		if notified.Valid {
+			severity := int(notified.Int64)
+			issue.NotifiedSeverity = &severity
+		}
+
+		issues = append(issues, &issue)
+	}
+
+	return issues, rows.Err()
+}
+
+// SyncHostIssues records the problems currently reported by one source for
+// a host. Problems that are new get an issue, ones that are still present
+// are updated, and open issues that are no longer reported are resolved.
+// The open and newly resolved issues are returned so admins can be alerted.
+func SyncHostIssues(name, source string, found []*DBHostIssue) (current, resolved []*DBHostIssue, err error) {
+	return syncHostIssues(name, source, found, true)
+}
+
+// RaiseHostIssues is SyncHostIssues for sources that only ever see a problem
+// once, like a change between two polls. Their issues stay open until they
+// are resolved by hand.
+func RaiseHostIssues(name, source string, found []*DBHostIssue) ([]*DBHostIssue, error) {
+	current, _, err := syncHostIssues(name, source, found, false)
+	return current, err
+}
+
+func syncHostIssues(name, source string, found []*DBHostIssue, resolveMissing bool) (current, resolved []*DBHostIssue, err error) {
+	existing, err := queryHostIssues(SELECT_OPEN_HOST_ISSUES_STATEMENT, name, source)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stale := make(map[string]*DBHostIssue)
+
+	for _, issue := range existing {
+		stale[issue.Component] = issue
+	}
+
+	now := time.Now()
+
+	for _, issue := range found {
+		if open, ok := stale[issue.Component]; ok {
+			delete(stale, issue.Component)
+
+			if err := QueuedExec(UPDATE_HOST_ISSUE_SEEN_STATEMENT, issue.Severity, issue.Message, now, open.ID); err != nil {
+				return nil, nil, err
+			}
+
+			open.Severity = issue.Severity
+			open.Message = issue.Message
+			open.LastSeen = now
+			current = append(current, open)
+
+			continue
+		}
+
+		if err := QueuedExec(INSERT_HOST_ISSUE_STATEMENT, name, source, issue.Component, issue.Severity, issue.Message, now, now); err != nil {
+			return nil, nil, err
+		}
+
+		current = append(current, &DBHostIssue{
+			HostName:  name,
+			Source:    source,
+			Component: issue.Component,
+			Severity:  issue.Severity,
+			Message:   issue.Message,
+			FirstSeen: now,
+			LastSeen:  now,
+		})
+	}
+
+	if resolveMissing {
+		for _, issue := range stale {
+			if err := QueuedExec(UPDATE_HOST_ISSUE_RESOLVED_STATEMENT, now, issue.ID); err != nil {
+				return nil, nil, err
+			}
+
+			issue.ResolvedTime = &now
+			resolved = append(resolved, issue)
+		}
+	}
+
+	// Newly inserted issues need their IDs so they can be marked as notified
+	if open, err := queryHostIssues(SELECT_OPEN_HOST_ISSUES_STATEMENT, name, source); err == nil {
+		ids := make(map[string]int)
+
+		for _, issue := range open {
+			ids[issue.Component] = issue.ID
+		}
+
+		for _, issue := range current {
+			issue.ID = ids[issue.Component]
+		}
+	}
+
+	return current, resolved, nil
+}
+
+func MarkHostIssueNotified(issue *DBHostIssue) error {
+	if err := QueuedExec(UPDATE_HOST_ISSUE_NOTIFIED_STATEMENT, issue.Severity, issue.ID); err != nil {
+		return err
+	}
+
+	severity := issue.Severity
+	issue.NotifiedSeverity = &severity
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package database
+
+const HOST_LABELS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_labels (
+	host_name TEXT NOT NULL,
+	key TEXT NOT NULL,
+	value TEXT NOT NULL,
+	PRIMARY KEY (host_name, key)
+);
+CREATE INDEX IF NOT EXISTS host_labels_key ON host_labels (key, value);`
+
+const SELECT_HOST_LABELS_STATEMENT = `SELECT key, value FROM host_labels WHERE host_name = ? ORDER BY key;`
+const SELECT_ALL_HOST_LABELS_STATEMENT = `SELECT host_name, key, value FROM host_labels;`
+const SELECT_HOSTS_WITH_LABEL_STATEMENT = `SELECT host_name FROM host_labels WHERE key = ? AND (? OR value = ?);`
+const UPSERT_HOST_LABEL_STATEMENT = `INSERT INTO host_labels (host_name, key, value) VALUES (?, ?, ?) ON CONFLICT (host_name, key) DO UPDATE SET value = excluded.value;`
+const DELETE_HOST_LABEL_STATEMENT = `DELETE FROM host_labels WHERE host_name = ? AND key = ?;`
+const DELETE_HOST_LABELS_STATEMENT = `DELETE FROM host_labels WHERE host_name = ?;`
+const SEARCH_HOSTS_STATEMENT = `SELECT name, health, cpu_count, cpu_speed_mhz, cpu_cores, memory_total_mib, memory_speed_mhz, virtual_storage_size_mib, networking_provider, networking_speed_mbps, ipmi_address, ipmi_username, ipmi_password, ipmi_redfish_version FROM hosts
+	WHERE cpu_cores >= ? AND memory_total_mib >= ? AND virtual_storage_size_mib >= ? AND networking_speed_mbps >= ? AND (? < 0 OR health = ?) ORDER BY name;`
+
+// HostLabelSelector matches hosts with a label. Without a value, any value
+// matches.
+type HostLabelSelector struct {
+	Key      string
+	Value    string
+	AnyValue bool
+}
+
+// HostSearch narrows down hosts. Every condition has to hold. Health is -1
+// for any health. Available leaves out hosts in maintenance.
+type HostSearch struct {
+	Labels         []HostLabelSelector
+	MinCores       int
+	MinMemoryMiB   int
+	MinStorageMiB  int
+	MinNetworkMbps int
+	Health         int
+	Available      bool
+}
+
+func GetHostLabels(name string) (map[string]string, error) {
+	rows, err := QueuedQuery(SELECT_HOST_LABELS_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	labels := map[string]string{}
+
+	for rows.Next() {
+		var key, value string
+
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		labels[key] = value
+	}
+
+	return labels, rows.Err()
+}
+
+// UpdateHostLabels sets the labels in changes and removes those set to nil.
+// With replace, labels not in changes are removed as well.
+func UpdateHostLabels(name string, changes map[string]*string, replace bool) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if replace {
+		if _, err := tx.Exec(DELETE_HOST_LABELS_STATEMENT, name); err != nil {
+			return err
+		}
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			_, err = tx.Exec(DELETE_HOST_LABEL_STATEMENT, name, key)
+		} else {
+			_, err = tx.Exec(UPSERT_HOST_LABEL_STATEMENT, name, key, *value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func hostsWithLabel(selector HostLabelSelector) (map[string]bool, error) {
+	rows, err := QueuedQuery(SELECT_HOSTS_WITH_LABEL_STATEMENT, selector.Key, selector.AnyValue, selector.Value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	names := map[string]bool{}
+
+	for rows.Next() {
+		var name string
+
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+
+		names[name] = true
+	}
+
+	return names, rows.Err()
+}
+
+func allHostLabels() (map[string]map[string]string, error) {
+	rows, err := QueuedQuery(SELECT_ALL_HOST_LABELS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	labels := map[string]map[string]string{}
+
+	for rows.Next() {
+		var name, key, value string
+
+		if err := rows.Scan(&name, &key, &value); err != nil {
+			return nil, err
+		}
+
+		if labels[name] == nil {
+			labels[name] = map[string]string{}
+		}
+
+		labels[name][key] = value
+	}
+
+	return labels, rows.Err()
+}
+
+// SearchHosts lists the hosts matching search, with their labels and
+// maintenance. Each label
+// selector is looked up on its own through the label index and the results
+// intersected.
+func SearchHosts(search HostSearch) ([]*DBHost, error) {
+	var matching map[string]bool
+
+	for _, selector := range search.Labels {
+		names, err := hostsWithLabel(selector)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if matching != nil {
+			for name := range matching {
+				if !names[name] {
+					delete(matching, name)
+				}
+			}
+		} else {
+			matching = names
+		}
+
+		if len(matching) == 0 {
+			return []*DBHost{}, nil
+		}
+	}
+
+	maintenance, err := allHostMaintenance()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := QueuedQuery(SEARCH_HOSTS_STATEMENT, search.MinCores, search.MinMemoryMiB, search.MinStorageMiB, search.MinNetworkMbps, search.Health, search.Health)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := []*DBHost{}
+
+	for rows.Next() {
+		host, err := scanHost(rows)
+
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		if search.Available && maintenance[host.Name] != nil {
+			continue
+		}
+
+		if matching == nil || matching[host.Name] {
+			host.Maintenance = maintenance[host.Name]
+			hosts = append(hosts, host)
+		}
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	labels, err := allHostLabels()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range hosts {
+		host.Labels = labels[host.Name]
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func createLabeledHost(t *testing.T, name string, cores int, labels map[string]string) {
+	t.Helper()
+
+	if _, err := CreateHost(name, HostHealthGood, 0, 0, cores, 0, 0, 0, "", 0, "192.0.2.1", "root", "calvin", HostRedfishVersion_Dell_iDRAC_9); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost(name) })
+
+	changes := map[string]*string{}
+
+	for key, value := range labels {
+		changes[key] = &value
+	}
+
+	if err := UpdateHostLabels(name, changes, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// searchLabeled leaves out hosts from other tests
+func searchLabeled(t *testing.T, search HostSearch) []string {
+	t.Helper()
+
+	hosts, err := SearchHosts(search)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+
+	for _, host := range hosts {
+		if host.Labels["suite"] == "labels" {
+			names = append(names, host.Name)
+		}
+	}
+
+	return names
+}
+
+func TestSearchHostsByLabel(t *testing.T) {
+	createLabeledHost(t, "labels-1", 8, map[string]string{"suite": "labels", "site": "durham", "rack": "4"})
+	createLabeledHost(t, "labels-2", 16, map[string]string{"suite": "labels", "site": "durham"})
+	createLabeledHost(t, "labels-3", 32, map[string]string{"suite": "labels", "site": "manchester", "rack": "1"})
+
+	if _, err := SetHostMaintenance("labels-2", "fans", nil, "admin@unh.edu"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		search HostSearch
+		want   []string
+	}{
+		{HostSearch{Health: -1}, []string{"labels-1", "labels-2", "labels-3"}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "site", Value: "durham"}}}, []string{"labels-1", "labels-2"}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "rack", AnyValue: true}}}, []string{"labels-1", "labels-3"}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "site", Value: "durham"}, {Key: "rack", AnyValue: true}}}, []string{"labels-1"}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "site", Value: "dover"}}}, []string{}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "site", Value: "durham"}}, Available: true}, []string{"labels-1"}},
+		{HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "site", Value: "durham"}}, MinCores: 16}, []string{"labels-2"}},
+	} {
+		if got := searchLabeled(t, test.search); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%+v: hosts = %q, want %q", test.search, got, test.want)
+		}
+	}
+
+	// Labels set to nil are removed, and replacing removes the rest too
+	site := "dover"
+
+	if err := UpdateHostLabels("labels-1", map[string]*string{"rack": nil, "site": &site}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := searchLabeled(t, HostSearch{Health: -1, Labels: []HostLabelSelector{{Key: "rack", AnyValue: true}}}); !reflect.DeepEqual(got, []string{"labels-3"}) {
+		t.Errorf("after removing rack: hosts = %q", got)
+	}
+
+	suite := "labels"
+
+	if err := UpdateHostLabels("labels-3", map[string]*string{"suite": &suite}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if labels, err := GetHostLabels("labels-3"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(labels, map[string]string{"suite": "labels"}) {
+		t.Errorf("after replacing: labels = %v", labels)
+	}
+}
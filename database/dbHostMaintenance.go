@@ -0,0 +1,108 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Hosts taken out of service by an admin. A host is back in service when its
+// row is deleted.
+const HOST_MAINTENANCE_STATEMENT = `CREATE TABLE IF NOT EXISTS host_maintenance (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	reason TEXT NOT NULL,
+	expected_return TIMESTAMP,
+	set_by TEXT NOT NULL,
+	start_time TIMESTAMP NOT NULL
+);`
+
+const HOST_MAINTENANCE_COLUMNS = `host_name, reason, expected_return, set_by, start_time`
+
+// Changing the reason or expected return of a host already in maintenance
+// keeps its start time
+const UPSERT_HOST_MAINTENANCE_STATEMENT = `INSERT INTO host_maintenance (` + HOST_MAINTENANCE_COLUMNS + `) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (host_name) DO UPDATE SET reason = excluded.reason, expected_return = excluded.expected_return, set_by = excluded.set_by;`
+const SELECT_HOST_MAINTENANCE_STATEMENT = `SELECT ` + HOST_MAINTENANCE_COLUMNS + ` FROM host_maintenance WHERE host_name = ?;`
+const SELECT_ALL_HOST_MAINTENANCE_STATEMENT = `SELECT ` + HOST_MAINTENANCE_COLUMNS + ` FROM host_maintenance;`
+const DELETE_HOST_MAINTENANCE_STATEMENT = `DELETE FROM host_maintenance WHERE host_name = ?;`
+
+type DBHostMaintenance struct {
+	HostName       string     `json:"host_name"`
+	Reason         string     `json:"reason"`
+	ExpectedReturn *time.Time `json:"expected_return"`
+	SetBy          string     `json:"set_by"`
+	StartTime      time.Time  `json:"start_time"`
+}
+
+func (m *DBHostMaintenance) JSON() []byte {
+	json, _ := json.Marshal(m)
+	return json
+}
+
+// SetHostMaintenance takes a host out of service, or updates why it is out
+// of service
+func SetHostMaintenance(name, reason string, expectedReturn *time.Time, setBy string) (*DBHostMaintenance, error) {
+	if err := QueuedExec(UPSERT_HOST_MAINTENANCE_STATEMENT, name, reason, expectedReturn, setBy, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return GetHostMaintenance(name)
+}
+
+// GetHostMaintenance is nil when the host is in service
+func GetHostMaintenance(name string) (*DBHostMaintenance, error) {
+	maintenance, err := queryHostMaintenance(SELECT_HOST_MAINTENANCE_STATEMENT, name)
+
+	if err != nil || len(maintenance) == 0 {
+		return nil, err
+	}
+
+	return maintenance[0], nil
+}
+
+func EndHostMaintenance(name string) error {
+	return QueuedExec(DELETE_HOST_MAINTENANCE_STATEMENT, name)
+}
+
+// allHostMaintenance maps the hosts in maintenance to why they are
+func allHostMaintenance() (map[string]*DBHostMaintenance, error) {
+	maintenance, err := queryHostMaintenance(SELECT_ALL_HOST_MAINTENANCE_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byHost := map[string]*DBHostMaintenance{}
+
+	for _, m := range maintenance {
+		byHost[m.HostName] = m
+	}
+
+	return byHost, nil
+}
+
+func queryHostMaintenance(query string, args ...interface{}) ([]*DBHostMaintenance, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	maintenance := []*DBHostMaintenance{}
+
+	for rows.Next() {
+		var m DBHostMaintenance
+		var expectedReturn sql.NullTime
+
+		if err := rows.Scan(&m.HostName, &m.Reason, &expectedReturn, &m.SetBy, &m.StartTime); err != nil {
+			return nil, err
+		}
+
+		m.ExpectedReturn = nullTime(expectedReturn)
+		maintenance = append(maintenance, &m)
+	}
+
+	return maintenance, rows.Err()
+}
@@ -0,0 +1,43 @@
+package database
+
+import "OpnLaaS.cyber.unh.edu/redfish"
+
+func (h *DBHost) MediaStatus() (*redfish.MediaStatus, error) {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.MediaStatus()
+}
+
+// InsertISO mounts an ISO from the catalog in the host's virtual CD drive
+// and, if boot is set, has the host boot from it once on its next start
+func (h *DBHost) InsertISO(iso *DBISO, boot bool) error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	if err := client.InsertMedia(iso.URL); err != nil {
+		return err
+	}
+
+	if !boot {
+		return nil
+	}
+
+	return client.BootOnce(redfish.BootTargetCd)
+}
+
+func (h *DBHost) EjectMedia() error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	return client.EjectMedia()
+}
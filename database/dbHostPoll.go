@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const HOST_POLLS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_polls (
+	host_name TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	last_poll TIMESTAMP,
+	last_success TIMESTAMP,
+	last_error TEXT NOT NULL DEFAULT '',
+	last_error_time TIMESTAMP,
+	next_poll TIMESTAMP NOT NULL,
+	PRIMARY KEY (host_name, kind)
+);`
+
+const RECORD_HOST_POLL_SUCCESS_STATEMENT = `INSERT INTO host_polls (host_name, kind, last_poll, last_success, next_poll) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (host_name, kind) DO UPDATE SET last_poll = excluded.last_poll, last_success = excluded.last_success, next_poll = excluded.next_poll;`
+const RECORD_HOST_POLL_ERROR_STATEMENT = `INSERT INTO host_polls (host_name, kind, last_poll, last_error, last_error_time, next_poll) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT (host_name, kind) DO UPDATE SET last_poll = excluded.last_poll, last_error = excluded.last_error, last_error_time = excluded.last_error_time, next_poll = excluded.next_poll;`
+const SELECT_HOST_POLLS_STATEMENT = `SELECT host_name, kind, last_poll, last_success, last_error, last_error_time, next_poll FROM host_polls WHERE host_name = ? ORDER BY kind;`
+const SELECT_ALL_HOST_POLLS_STATEMENT = `SELECT host_name, kind, last_poll, last_success, last_error, last_error_time, next_poll FROM host_polls;`
+const DELETE_HOST_POLLS_STATEMENT = `DELETE FROM host_polls WHERE host_name = ?;`
+
+type DBHostPoll struct {
+	HostName      string     `json:"-"`
+	Kind          string     `json:"kind"`
+	LastPoll      *time.Time `json:"last_poll"`
+	LastSuccess   *time.Time `json:"last_success"`
+	LastError     string     `json:"last_error"`
+	LastErrorTime *time.Time `json:"last_error_time"`
+	NextPoll      time.Time  `json:"next_poll"`
+}
+
+func (p *DBHostPoll) JSON() []byte {
+	json, _ := json.Marshal(p)
+	return json
+}
+
+func RecordHostPoll(name, kind string, at time.Time, pollErr error, next time.Time) error {
+	if pollErr != nil {
+		return QueuedExec(RECORD_HOST_POLL_ERROR_STATEMENT, name, kind, at, pollErr.Error(), at, next)
+	}
+
+	return QueuedExec(RECORD_HOST_POLL_SUCCESS_STATEMENT, name, kind, at, at, next)
+}
+
+func GetHostPolls(name string) ([]*DBHostPoll, error) {
+	return queryHostPolls(SELECT_HOST_POLLS_STATEMENT, name)
+}
+
+func ListHostPolls() ([]*DBHostPoll, error) {
+	return queryHostPolls(SELECT_ALL_HOST_POLLS_STATEMENT)
+}
+
+func queryHostPolls(query string, args ...interface{}) ([]*DBHostPoll, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	polls := []*DBHostPoll{}
+
+	for rows.Next() {
+		var poll DBHostPoll
+		var lastPoll, lastSuccess, lastErrorTime sql.NullTime
+
+		if err := rows.Scan(&poll.HostName, &poll.Kind, &lastPoll, &lastSuccess, &poll.LastError, &lastErrorTime, &poll.NextPoll); err != nil {
+			return nil, err
+		}
+
+		poll.LastPoll = nullTime(lastPoll)
+		poll.LastSuccess = nullTime(lastSuccess)
+		poll.LastErrorTime = nullTime(lastErrorTime)
+
+		polls = append(polls, &poll)
+	}
+
+	return polls, rows.Err()
+}
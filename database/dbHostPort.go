@@ -0,0 +1,144 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// The host's physical network ports as of the last hardware poll
+const HOST_PORTS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_ports (
+	host_name TEXT NOT NULL,
+	port_id TEXT NOT NULL,
+	adapter TEXT NOT NULL,
+	slot TEXT NOT NULL,
+	mac_address TEXT NOT NULL,
+	link_status TEXT NOT NULL,
+	speed_mbps INTEGER NOT NULL,
+	PRIMARY KEY (host_name, port_id)
+);`
+
+// What admins know about how ports are cabled. Kept apart from the ports so
+// that polls don't wipe it, and so it's still there if a port goes missing
+// and comes back.
+const HOST_PORT_ANNOTATIONS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_port_annotations (
+	host_name TEXT NOT NULL,
+	port_id TEXT NOT NULL,
+	switch_name TEXT NOT NULL,
+	switch_port TEXT NOT NULL,
+	vlan INTEGER,
+	PRIMARY KEY (host_name, port_id)
+);
+CREATE INDEX IF NOT EXISTS host_port_annotations_switch ON host_port_annotations (switch_name);`
+
+const HOST_PORT_COLUMNS = `p.host_name, p.port_id, p.adapter, p.slot, p.mac_address, p.link_status, p.speed_mbps, COALESCE(a.switch_name, ''), COALESCE(a.switch_port, ''), a.vlan`
+
+const INSERT_HOST_PORT_STATEMENT = `INSERT INTO host_ports (host_name, port_id, adapter, slot, mac_address, link_status, speed_mbps) VALUES (?, ?, ?, ?, ?, ?, ?);`
+const SELECT_HOST_PORTS_STATEMENT = `SELECT ` + HOST_PORT_COLUMNS + ` FROM host_ports p LEFT JOIN host_port_annotations a ON a.host_name = p.host_name AND a.port_id = p.port_id WHERE p.host_name = ? ORDER BY p.port_id;`
+const SELECT_HOST_PORT_STATEMENT = `SELECT ` + HOST_PORT_COLUMNS + ` FROM host_ports p LEFT JOIN host_port_annotations a ON a.host_name = p.host_name AND a.port_id = p.port_id WHERE p.host_name = ? AND p.port_id = ?;`
+const SELECT_SWITCH_PORTS_STATEMENT = `SELECT ` + HOST_PORT_COLUMNS + ` FROM host_port_annotations a JOIN host_ports p ON a.host_name = p.host_name AND a.port_id = p.port_id WHERE a.switch_name = ? ORDER BY a.switch_port, p.host_name;`
+const UPSERT_HOST_PORT_ANNOTATION_STATEMENT = `INSERT INTO host_port_annotations (host_name, port_id, switch_name, switch_port, vlan) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (host_name, port_id) DO UPDATE SET switch_name = excluded.switch_name, switch_port = excluded.switch_port, vlan = excluded.vlan;`
+const DELETE_HOST_PORT_ANNOTATION_STATEMENT = `DELETE FROM host_port_annotations WHERE host_name = ? AND port_id = ?;`
+const DELETE_HOST_PORTS_STATEMENT = `DELETE FROM host_ports WHERE host_name = ?;`
+const DELETE_HOST_PORT_ANNOTATIONS_STATEMENT = `DELETE FROM host_port_annotations WHERE host_name = ?;`
+
+type DBHostPort struct {
+	HostName   string `json:"host_name"`
+	ID         string `json:"id"`
+	Adapter    string `json:"adapter"`
+	Slot       string `json:"slot"`
+	MACAddress string `json:"mac_address"`
+	LinkStatus string `json:"link_status"`
+	SpeedMbps  int    `json:"speed_mbps"`
+	SwitchName string `json:"switch_name"`
+	SwitchPort string `json:"switch_port"`
+	VLAN       *int   `json:"vlan"`
+}
+
+func (p *DBHostPort) JSON() []byte {
+	json, _ := json.Marshal(p)
+	return json
+}
+
+func SetHostPorts(name string, ports []redfish.NICPort) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DELETE_HOST_PORTS_STATEMENT, name); err != nil {
+		return err
+	}
+
+	for _, port := range ports {
+		if _, err := tx.Exec(INSERT_HOST_PORT_STATEMENT, name, port.ID, port.Adapter, port.Slot, NormalizeMAC(port.MACAddress), port.LinkStatus, port.SpeedMbps); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetHostPorts(name string) ([]*DBHostPort, error) {
+	return queryHostPorts(SELECT_HOST_PORTS_STATEMENT, name)
+}
+
+func GetHostPort(name, id string) (*DBHostPort, error) {
+	ports, err := queryHostPorts(SELECT_HOST_PORT_STATEMENT, name, id)
+
+	if err != nil || len(ports) == 0 {
+		return nil, err
+	}
+
+	return ports[0], nil
+}
+
+// ListSwitchPorts lists the host ports cabled to a switch
+func ListSwitchPorts(switchName string) ([]*DBHostPort, error) {
+	return queryHostPorts(SELECT_SWITCH_PORTS_STATEMENT, switchName)
+}
+
+// AnnotateHostPort records where a port is cabled. An empty switch name
+// removes the annotation.
+func AnnotateHostPort(name, id, switchName, switchPort string, vlan *int) error {
+	if switchName == "" {
+		return QueuedExec(DELETE_HOST_PORT_ANNOTATION_STATEMENT, name, id)
+	}
+
+	return QueuedExec(UPSERT_HOST_PORT_ANNOTATION_STATEMENT, name, id, switchName, switchPort, vlan)
+}
+
+func queryHostPorts(query string, args ...interface{}) ([]*DBHostPort, error) {
+	rows, err := QueuedQuery(query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ports := []*DBHostPort{}
+
+	for rows.Next() {
+		var port DBHostPort
+		var vlan sql.NullInt64
+
+		if err := rows.Scan(&port.HostName, &port.ID, &port.Adapter, &port.Slot, &port.MACAddress, &port.LinkStatus, &port.SpeedMbps, &port.SwitchName, &port.SwitchPort, &vlan); err != nil {
+			return nil, err
+		}
+
+		if vlan.Valid {
+			id := int(vlan.Int64)
+			port.VLAN = &id
+		}
+
+		ports = append(ports, &port)
+	}
+
+	return ports, rows.Err()
+}
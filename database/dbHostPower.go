@@ -0,0 +1,25 @@
+package database
+
+import "OpnLaaS.cyber.unh.edu/redfish"
+
+func (h *DBHost) PowerStatus() (*redfish.PowerStatus, error) {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.PowerStatus()
+}
+
+// Power performs one of redfish.PowerActions on the host and returns the
+// Redfish reset type that was used
+func (h *DBHost) Power(action string) (string, error) {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return "", err
+	}
+
+	return client.Power(action)
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// A provision moves from pending to booting when the host fetches its iPXE
+// script, to installing when the installer fetches its template, and to done
+// when the installer reports back. Only a pending provision gets an install
+// script, so a host that network boots again afterwards boots from disk.
+// Provisions with a BIOS profile wait for it to be applied before they are
+// pending, so the resets that apply it don't boot the installer, and fail if
+// it can't be.
+const (
+	ProvisionWaitingBIOS = "waiting_bios"
+	ProvisionPending     = "pending"
+	ProvisionBooting     = "booting"
+	ProvisionInstalling  = "installing"
+	ProvisionDone        = "done"
+	ProvisionFailed      = "failed"
+)
+
+// The token is in every URL the installer fetches, since those URLs can't
+// require a login. The user is who the OS is installed for, who an admin may
+// provision on behalf of.
+const HOST_PROVISIONS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_provisions (
+	host_name TEXT PRIMARY KEY NOT NULL,
+	image_name TEXT NOT NULL,
+	user TEXT NOT NULL,
+	requested_by TEXT NOT NULL,
+	ssh_key TEXT NOT NULL,
+	token TEXT UNIQUE NOT NULL,
+	status TEXT NOT NULL,
+	mac_address TEXT NOT NULL,
+	create_time TIMESTAMP NOT NULL,
+	update_time TIMESTAMP NOT NULL
+);`
+
+const HOST_PROVISION_COLUMNS = `host_name, image_name, user, requested_by, ssh_key, token, status, mac_address, create_time, update_time`
+
+const INSERT_HOST_PROVISION_STATEMENT = `INSERT OR REPLACE INTO host_provisions (` + HOST_PROVISION_COLUMNS + `) VALUES (?, ?, ?, ?, ?, ?, ?, '', ?, ?);`
+const SELECT_HOST_PROVISION_STATEMENT = `SELECT ` + HOST_PROVISION_COLUMNS + ` FROM host_provisions WHERE host_name = ?;`
+const SELECT_HOST_PROVISION_BY_TOKEN_STATEMENT = `SELECT ` + HOST_PROVISION_COLUMNS + ` FROM host_provisions WHERE token = ?;`
+const UPDATE_HOST_PROVISION_STATUS_STATEMENT = `UPDATE host_provisions SET status = ?, update_time = ? WHERE host_name = ?;`
+const UPDATE_HOST_PROVISION_BOOTING_STATEMENT = `UPDATE host_provisions SET status = ?, mac_address = ?, update_time = ? WHERE host_name = ? AND status = ?;`
+const UPDATE_WAITING_HOST_PROVISION_STATEMENT = `UPDATE host_provisions SET status = ?, update_time = ? WHERE host_name = ? AND status = ?;`
+const UPDATE_WAITING_HOST_PROVISIONS_STATEMENT = `UPDATE host_provisions SET status = ?, update_time = ? WHERE status = ?;`
+const DELETE_HOST_PROVISION_STATEMENT = `DELETE FROM host_provisions WHERE host_name = ?;`
+
+type DBHostProvision struct {
+	HostName    string    `json:"host_name"`
+	ImageName   string    `json:"image_name"`
+	User        string    `json:"user"`
+	RequestedBy string    `json:"requested_by"`
+	SSHKey      string    `json:"ssh_key"`
+	Token       string    `json:"-"`
+	Status      string    `json:"status"`
+	MACAddress  string    `json:"mac_address"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+func (p *DBHostProvision) JSON() []byte {
+	json, _ := json.Marshal(p)
+	return json
+}
+
+// ProvisionData is what an image's kernel arguments and template are
+// rendered with
+type ProvisionData struct {
+	Host  string
+	MAC   string
+	Image string
+	User  struct {
+		Email     string
+		FirstName string
+		LastName  string
+	}
+	SSHKey      string
+	BaseURL     string
+	TemplateURL string
+	DoneURL     string
+}
+
+func newToken() (string, error) {
+	raw := make([]byte, 16)
+
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(raw), nil
+}
+
+// CreateHostProvision arms a host to be installed with image the next time
+// it network boots, replacing any earlier provision. With waitForBIOS, it
+// isn't armed until a BIOS profile is applied, see ApplyBIOSProfile.
+func CreateHostProvision(name, image, user, requestedBy, sshKey string, waitForBIOS bool) (*DBHostProvision, error) {
+	token, err := newToken()
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	status := ProvisionPending
+
+	if waitForBIOS {
+		status = ProvisionWaitingBIOS
+	}
+
+	if err := QueuedExec(INSERT_HOST_PROVISION_STATEMENT, name, image, user, requestedBy, sshKey, token, status, now, now); err != nil {
+		return nil, err
+	}
+
+	return GetHostProvision(name)
+}
+
+func GetHostProvision(name string) (*DBHostProvision, error) {
+	return queryHostProvision(SELECT_HOST_PROVISION_STATEMENT, name)
+}
+
+func GetHostProvisionByToken(token string) (*DBHostProvision, error) {
+	return queryHostProvision(SELECT_HOST_PROVISION_BY_TOKEN_STATEMENT, token)
+}
+
+func queryHostProvision(statement string, args ...interface{}) (*DBHostProvision, error) {
+	rows, err := QueuedQuery(statement, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var p DBHostProvision
+
+	if err := rows.Scan(&p.HostName, &p.ImageName, &p.User, &p.RequestedBy, &p.SSHKey, &p.Token, &p.Status, &p.MACAddress, &p.CreateTime, &p.UpdateTime); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// StartHostProvision moves a pending provision to booting. It reports false
+// if the provision wasn't pending, such as when another interface of the
+// same host got there first.
+func StartHostProvision(name, mac string) (bool, error) {
+	result, err := QueuedExecResult(UPDATE_HOST_PROVISION_BOOTING_STATEMENT, ProvisionBooting, mac, time.Now(), name, ProvisionPending)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// armHostProvision makes a provision that waited for its BIOS profile
+// pending
+func armHostProvision(name string) error {
+	return QueuedExec(UPDATE_WAITING_HOST_PROVISION_STATEMENT, ProvisionPending, time.Now(), name, ProvisionWaitingBIOS)
+}
+
+// FailHostProvision ends a provision whose BIOS profile couldn't be applied
+func FailHostProvision(name string) error {
+	return QueuedExec(UPDATE_WAITING_HOST_PROVISION_STATEMENT, ProvisionFailed, time.Now(), name, ProvisionWaitingBIOS)
+}
+
+func SetHostProvisionStatus(name, status string) error {
+	return QueuedExec(UPDATE_HOST_PROVISION_STATUS_STATEMENT, status, time.Now(), name)
+}
+
+func DeleteHostProvision(name string) error {
+	return QueuedExec(DELETE_HOST_PROVISION_STATEMENT, name)
+}
+
+// Data gathers what the provision's templates are rendered with. baseURL is
+// where the host reaches the coordinator.
+func (p *DBHostProvision) Data(image *DBOSImage, baseURL string) (*ProvisionData, error) {
+	data := &ProvisionData{
+		Host:        p.HostName,
+		MAC:         p.MACAddress,
+		Image:       image.Name,
+		SSHKey:      p.SSHKey,
+		BaseURL:     baseURL,
+		TemplateURL: baseURL + "/pxe/templates/" + p.Token,
+		DoneURL:     baseURL + "/pxe/done/" + p.Token,
+	}
+
+	// cloud-init's nocloud datasource fetches user-data and meta-data from
+	// under a directory
+	if image.TemplateKind == OSTemplateAutoinstall {
+		data.TemplateURL += "/"
+	}
+
+	user, err := GetUser(p.User)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if user != nil {
+		data.User.Email = user.Email
+		data.User.FirstName = user.FirstName
+		data.User.LastName = user.LastName
+	}
+
+	return data, nil
+}
+
+func render(name, text string, data *ProvisionData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// RenderIPXE writes the iPXE script that boots the image's installer
+func RenderIPXE(image *DBOSImage, data *ProvisionData) (string, error) {
+	args, err := render("kernel_args", image.KernelArgs, data)
+
+	if err != nil {
+		return "", err
+	}
+
+	script := "#!ipxe\n"
+	script += fmt.Sprintf("echo Installing %s on %s\n", image.Name, data.Host)
+	script += strings.TrimSpace("kernel "+image.KernelURL+" "+strings.Join(strings.Fields(args), " ")) + "\n"
+
+	if image.InitrdURL != "" {
+		script += "initrd " + image.InitrdURL + "\n"
+	}
+
+	return script + "boot\n", nil
+}
+
+// LocalBootIPXE is served to hosts that have nothing to install, so that
+// they carry on to the next boot device
+const LocalBootIPXE = "#!ipxe\necho No install pending, booting from disk\nexit\n"
+
+func RenderInstallTemplate(image *DBOSImage, data *ProvisionData) (string, error) {
+	return render("template", image.Template, data)
+}
+
+// NetworkBoot has the host boot from the network once and starts or
+// restarts it
+func (h *DBHost) NetworkBoot() error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	if err := client.BootOnce(redfish.BootTargetPxe); err != nil {
+		return err
+	}
+
+	status, err := client.PowerStatus()
+
+	if err != nil {
+		return err
+	}
+
+	action := "on"
+
+	if status.PowerState == "On" {
+		action = "reset"
+	}
+
+	_, err = client.Power(action)
+	return err
+}
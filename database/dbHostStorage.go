@@ -0,0 +1,266 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// The host's storage controllers, drives and volumes as of the last hardware
+// poll
+
+const HOST_STORAGE_CONTROLLERS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_storage_controllers (
+	host_name TEXT NOT NULL,
+	controller_id TEXT NOT NULL,
+	storage_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	model TEXT NOT NULL,
+	firmware_version TEXT NOT NULL,
+	health INTEGER NOT NULL,
+	PRIMARY KEY (host_name, storage_id, controller_id)
+);`
+
+const HOST_DRIVES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_drives (
+	host_name TEXT NOT NULL,
+	drive_id TEXT NOT NULL,
+	storage_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	manufacturer TEXT NOT NULL,
+	model TEXT NOT NULL,
+	serial_number TEXT NOT NULL,
+	media_type TEXT NOT NULL,
+	protocol TEXT NOT NULL,
+	capacity_bytes INTEGER NOT NULL,
+	life_left_percent REAL,
+	failure_predicted INTEGER NOT NULL,
+	health INTEGER NOT NULL,
+	PRIMARY KEY (host_name, storage_id, drive_id)
+);`
+
+// drives is the IDs of the volume's drives, comma separated
+const HOST_VOLUMES_STATEMENT = `CREATE TABLE IF NOT EXISTS host_volumes (
+	host_name TEXT NOT NULL,
+	volume_id TEXT NOT NULL,
+	storage_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	volume_type TEXT NOT NULL,
+	raid_type TEXT NOT NULL,
+	capacity_bytes INTEGER NOT NULL,
+	drives TEXT NOT NULL,
+	health INTEGER NOT NULL,
+	PRIMARY KEY (host_name, storage_id, volume_id)
+);`
+
+const INSERT_HOST_STORAGE_CONTROLLER_STATEMENT = `INSERT OR REPLACE INTO host_storage_controllers (host_name, controller_id, storage_id, name, model, firmware_version, health) VALUES (?, ?, ?, ?, ?, ?, ?);`
+const INSERT_HOST_DRIVE_STATEMENT = `INSERT OR REPLACE INTO host_drives (host_name, drive_id, storage_id, name, manufacturer, model, serial_number, media_type, protocol, capacity_bytes, life_left_percent, failure_predicted, health) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const INSERT_HOST_VOLUME_STATEMENT = `INSERT OR REPLACE INTO host_volumes (host_name, volume_id, storage_id, name, volume_type, raid_type, capacity_bytes, drives, health) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const SELECT_HOST_STORAGE_CONTROLLERS_STATEMENT = `SELECT controller_id, storage_id, name, model, firmware_version, health FROM host_storage_controllers WHERE host_name = ? ORDER BY storage_id, controller_id;`
+const SELECT_HOST_DRIVES_STATEMENT = `SELECT drive_id, storage_id, name, manufacturer, model, serial_number, media_type, protocol, capacity_bytes, life_left_percent, failure_predicted, health FROM host_drives WHERE host_name = ? ORDER BY storage_id, drive_id;`
+const SELECT_HOST_VOLUMES_STATEMENT = `SELECT volume_id, storage_id, name, volume_type, raid_type, capacity_bytes, drives, health FROM host_volumes WHERE host_name = ? ORDER BY storage_id, volume_id;`
+const DELETE_HOST_STORAGE_CONTROLLERS_STATEMENT = `DELETE FROM host_storage_controllers WHERE host_name = ?;`
+const DELETE_HOST_DRIVES_STATEMENT = `DELETE FROM host_drives WHERE host_name = ?;`
+const DELETE_HOST_VOLUMES_STATEMENT = `DELETE FROM host_volumes WHERE host_name = ?;`
+
+type DBHostStorageController struct {
+	ID              string `json:"id"`
+	Storage         string `json:"storage"`
+	Name            string `json:"name"`
+	Model           string `json:"model"`
+	FirmwareVersion string `json:"firmware_version"`
+	Health          int    `json:"health"`
+}
+
+type DBHostDrive struct {
+	ID               string   `json:"id"`
+	Storage          string   `json:"storage"`
+	Name             string   `json:"name"`
+	Manufacturer     string   `json:"manufacturer"`
+	Model            string   `json:"model"`
+	SerialNumber     string   `json:"serial_number"`
+	MediaType        string   `json:"media_type"`
+	Protocol         string   `json:"protocol"`
+	CapacityBytes    int64    `json:"capacity_bytes"`
+	LifeLeftPercent  *float64 `json:"life_left_percent"`
+	FailurePredicted bool     `json:"failure_predicted"`
+	Health           int      `json:"health"`
+}
+
+type DBHostVolume struct {
+	ID            string   `json:"id"`
+	Storage       string   `json:"storage"`
+	Name          string   `json:"name"`
+	VolumeType    string   `json:"volume_type"`
+	RAIDType      string   `json:"raid_type"`
+	CapacityBytes int64    `json:"capacity_bytes"`
+	Drives        []string `json:"drives"`
+	Health        int      `json:"health"`
+}
+
+// DBHostStorage is everything storage on a host
+type DBHostStorage struct {
+	Controllers []*DBHostStorageController `json:"controllers"`
+	Drives      []*DBHostDrive             `json:"drives"`
+	Volumes     []*DBHostVolume            `json:"volumes"`
+}
+
+func (s *DBHostStorage) JSON() []byte {
+	json, _ := json.Marshal(s)
+	return json
+}
+
+func SetHostStorage(name string, inv *redfish.Inventory) error {
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, statement := range []string{DELETE_HOST_STORAGE_CONTROLLERS_STATEMENT, DELETE_HOST_DRIVES_STATEMENT, DELETE_HOST_VOLUMES_STATEMENT} {
+		if _, err := tx.Exec(statement, name); err != nil {
+			return err
+		}
+	}
+
+	for _, controller := range inv.Controllers {
+		if _, err := tx.Exec(INSERT_HOST_STORAGE_CONTROLLER_STATEMENT, name, controller.MemberID, controller.Storage, controller.Name, controller.Model, controller.FirmwareVersion, HostHealthFromRedfish(controller.Status.Health)); err != nil {
+			return err
+		}
+	}
+
+	for _, drive := range inv.Drives {
+		if _, err := tx.Exec(INSERT_HOST_DRIVE_STATEMENT, name, drive.ID, drive.Storage, drive.Name, drive.Manufacturer, drive.Model, drive.SerialNumber, drive.MediaType, drive.Protocol, drive.CapacityBytes, drive.PredictedMediaLifeLeftPercent, drive.FailurePredicted, HostHealthFromRedfish(drive.Status.Health)); err != nil {
+			return err
+		}
+	}
+
+	for _, volume := range inv.Volumes {
+		drives := []string{}
+
+		for _, link := range volume.Links.Drives {
+			drives = append(drives, path.Base(link.ODataID))
+		}
+
+		if _, err := tx.Exec(INSERT_HOST_VOLUME_STATEMENT, name, volume.ID, volume.Storage, volume.Name, volume.VolumeType, volume.RAIDType, volume.CapacityBytes, strings.Join(drives, ","), HostHealthFromRedfish(volume.Status.Health)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func GetHostStorage(name string) (*DBHostStorage, error) {
+	storage := &DBHostStorage{
+		Controllers: []*DBHostStorageController{},
+		Drives:      []*DBHostDrive{},
+		Volumes:     []*DBHostVolume{},
+	}
+
+	err := queryEach(SELECT_HOST_STORAGE_CONTROLLERS_STATEMENT, name, func(rows *sql.Rows) error {
+		var c DBHostStorageController
+
+		if err := rows.Scan(&c.ID, &c.Storage, &c.Name, &c.Model, &c.FirmwareVersion, &c.Health); err != nil {
+			return err
+		}
+
+		storage.Controllers = append(storage.Controllers, &c)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryEach(SELECT_HOST_DRIVES_STATEMENT, name, func(rows *sql.Rows) error {
+		var d DBHostDrive
+		var lifeLeft sql.NullFloat64
+
+		if err := rows.Scan(&d.ID, &d.Storage, &d.Name, &d.Manufacturer, &d.Model, &d.SerialNumber, &d.MediaType, &d.Protocol, &d.CapacityBytes, &lifeLeft, &d.FailurePredicted, &d.Health); err != nil {
+			return err
+		}
+
+		if lifeLeft.Valid {
+			d.LifeLeftPercent = &lifeLeft.Float64
+		}
+
+		storage.Drives = append(storage.Drives, &d)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = queryEach(SELECT_HOST_VOLUMES_STATEMENT, name, func(rows *sql.Rows) error {
+		var v DBHostVolume
+		var drives string
+
+		if err := rows.Scan(&v.ID, &v.Storage, &v.Name, &v.VolumeType, &v.RAIDType, &v.CapacityBytes, &drives, &v.Health); err != nil {
+			return err
+		}
+
+		v.Drives = []string{}
+
+		if drives != "" {
+			v.Drives = strings.Split(drives, ",")
+		}
+
+		storage.Volumes = append(storage.Volumes, &v)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+func queryEach(query string, arg interface{}, each func(rows *sql.Rows) error) error {
+	rows, err := QueuedQuery(query, arg)
+
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := each(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// reportDriveIssues opens an issue for every drive that predicts it will
+// fail. They resolve themselves once the drive is replaced.
+func (h *DBHost) reportDriveIssues(drives []redfish.Drive) error {
+	found := []*DBHostIssue{}
+
+	for _, drive := range drives {
+		if !drive.FailurePredicted {
+			continue
+		}
+
+		message := "Failure predicted"
+
+		if drive.SerialNumber != "" {
+			message += fmt.Sprintf(" (%s serial %s)", strings.TrimSpace(drive.Model), drive.SerialNumber)
+		}
+
+		found = append(found, &DBHostIssue{
+			Component: "Drive " + drive.ID,
+			Severity:  HostHealthDegraded,
+			Message:   message,
+		})
+	}
+
+	return ReportHostIssues(h.Name, IssueSourceDrives, found)
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"slices"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// Readings are kept as they are polled for TELEMETRY_RAW_RETENTION, and as
+// hourly min/max/sum/count rollups for TELEMETRY_HOURLY_RETENTION. Times are
+// unix seconds so that they can be bucketed in SQL.
+
+const HOST_TELEMETRY_STATEMENT = `CREATE TABLE IF NOT EXISTS host_telemetry (
+	host_name TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	sensor TEXT NOT NULL,
+	unit TEXT NOT NULL,
+	time INTEGER NOT NULL,
+	value REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS host_telemetry_host ON host_telemetry (host_name, metric, time);`
+
+const HOST_TELEMETRY_HOURLY_STATEMENT = `CREATE TABLE IF NOT EXISTS host_telemetry_hourly (
+	host_name TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	sensor TEXT NOT NULL,
+	unit TEXT NOT NULL,
+	hour INTEGER NOT NULL,
+	min REAL NOT NULL,
+	max REAL NOT NULL,
+	sum REAL NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (host_name, metric, sensor, hour)
+);`
+
+const INSERT_HOST_TELEMETRY_STATEMENT = `INSERT INTO host_telemetry (host_name, metric, sensor, unit, time, value) VALUES (?, ?, ?, ?, ?, ?);`
+const UPSERT_HOST_TELEMETRY_HOURLY_STATEMENT = `INSERT INTO host_telemetry_hourly (host_name, metric, sensor, unit, hour, min, max, sum, count) VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1)
+	ON CONFLICT (host_name, metric, sensor, hour) DO UPDATE SET unit = excluded.unit, min = MIN(min, excluded.min), max = MAX(max, excluded.max), sum = sum + excluded.sum, count = count + 1;`
+const PRUNE_HOST_TELEMETRY_STATEMENT = `DELETE FROM host_telemetry WHERE host_name = ? AND time < ?;`
+const PRUNE_HOST_TELEMETRY_HOURLY_STATEMENT = `DELETE FROM host_telemetry_hourly WHERE host_name = ? AND hour < ?;`
+const SELECT_HOST_TELEMETRY_STATEMENT = `SELECT metric, sensor, unit, (time / ?) * ? AS bucket, MIN(value), MAX(value), AVG(value) FROM host_telemetry
+	WHERE host_name = ? AND (? = '' OR metric = ?) AND time >= ? AND time < ?
+	GROUP BY metric, sensor, unit, bucket ORDER BY metric, sensor, unit, bucket;`
+const SELECT_HOST_TELEMETRY_HOURLY_STATEMENT = `SELECT metric, sensor, unit, (hour / ?) * ? AS bucket, MIN(min), MAX(max), SUM(sum) / SUM(count) FROM host_telemetry_hourly
+	WHERE host_name = ? AND (? = '' OR metric = ?) AND hour >= ? AND hour < ?
+	GROUP BY metric, sensor, unit, bucket ORDER BY metric, sensor, unit, bucket;`
+const DELETE_HOST_TELEMETRY_STATEMENT = `DELETE FROM host_telemetry WHERE host_name = ?;`
+const DELETE_HOST_TELEMETRY_HOURLY_STATEMENT = `DELETE FROM host_telemetry_hourly WHERE host_name = ?;`
+
+var TelemetryMetrics = []string{redfish.MetricTemperature, redfish.MetricFan, redfish.MetricPower}
+
+type TelemetryPoint struct {
+	Time time.Time `json:"time"`
+	Min  float64   `json:"min"`
+	Max  float64   `json:"max"`
+	Avg  float64   `json:"avg"`
+}
+
+type TelemetrySeries struct {
+	Metric string           `json:"metric"`
+	Sensor string           `json:"sensor"`
+	Unit   string           `json:"unit"`
+	Points []TelemetryPoint `json:"points"`
+}
+
+func IsTelemetryMetricValid(metric string) bool {
+	return slices.Contains(TelemetryMetrics, metric)
+}
+
+// PollTelemetry records the host's sensor readings and drops readings that
+// are past retention
+func (h *DBHost) PollTelemetry() error {
+	client, err := h.redfishClient()
+
+	if err != nil {
+		return err
+	}
+
+	readings, err := client.Telemetry()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	hour := now - now%3600
+
+	tx, err := QueuedBegin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	for _, reading := range readings {
+		if _, err := tx.Exec(INSERT_HOST_TELEMETRY_STATEMENT, h.Name, reading.Metric, reading.Sensor, reading.Unit, now, reading.Value); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(UPSERT_HOST_TELEMETRY_HOURLY_STATEMENT, h.Name, reading.Metric, reading.Sensor, reading.Unit, hour, reading.Value, reading.Value, reading.Value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(PRUNE_HOST_TELEMETRY_STATEMENT, h.Name, now-int64(lib.Config.TelemetryRawRetention.Seconds())); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(PRUNE_HOST_TELEMETRY_HOURLY_STATEMENT, h.Name, now-int64(lib.Config.TelemetryHourlyRetention.Seconds())); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetHostTelemetry buckets readings between from and to into steps. Raw
+// readings are used unless the step is an hour or more, or the range reaches
+// back past raw retention, in which case the step is rounded up to whole
+// hours and the rollups are used.
+func GetHostTelemetry(name, metric string, from, to time.Time, step time.Duration) ([]*TelemetrySeries, error) {
+	statement := SELECT_HOST_TELEMETRY_STATEMENT
+
+	if step >= time.Hour || from.Before(time.Now().Add(-lib.Config.TelemetryRawRetention)) {
+		statement = SELECT_HOST_TELEMETRY_HOURLY_STATEMENT
+		step = (step + time.Hour - 1).Truncate(time.Hour)
+	}
+
+	seconds := max(int64(step.Seconds()), 1)
+
+	rows, err := QueuedQuery(statement, seconds, seconds, name, metric, metric, from.Unix(), to.Unix())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	series := []*TelemetrySeries{}
+	var current *TelemetrySeries
+
+	for rows.Next() {
+		var s TelemetrySeries
+		var bucket int64
+		var point TelemetryPoint
+
+		if err := rows.Scan(&s.Metric, &s.Sensor, &s.Unit, &bucket, &point.Min, &point.Max, &point.Avg); err != nil {
+			return nil, err
+		}
+
+		point.Time = time.Unix(bucket, 0).UTC()
+
+		if current == nil || current.Metric != s.Metric || current.Sensor != s.Sensor || current.Unit != s.Unit {
+			current = &s
+			series = append(series, current)
+		}
+
+		current.Points = append(current.Points, point)
+	}
+
+	return series, rows.Err()
+}
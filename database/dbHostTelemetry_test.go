@@ -0,0 +1,69 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+const testChassisPath = "/redfish/v1/Chassis/System.Embedded.1"
+
+// Readings are kept raw and rolled up by the hour, and either can be charted
+func TestPollTelemetry(t *testing.T) {
+	lib.Config.TelemetryRawRetention = time.Hour
+	lib.Config.TelemetryHourlyRetention = 24 * time.Hour
+
+	bmc := newFakeBMC(t)
+	bmc.Link(t, testChassisPath, "Thermal", testChassisPath+"/Thermal")
+
+	host, err := CreateHost("telemetry-1", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("telemetry-1") })
+
+	for _, celsius := range []float64{20, 30, 40} {
+		bmc.Set(testChassisPath+"/Thermal", map[string]interface{}{
+			"Temperatures": []map[string]interface{}{{"MemberId": "Inlet", "Name": "Inlet Temp", "ReadingCelsius": celsius}},
+			"Fans":         []map[string]interface{}{{"MemberId": "Fan1", "Name": "Fan 1", "Reading": 6000, "ReadingUnits": "RPM"}},
+		})
+
+		if err := host.PollTelemetry(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+
+	// Steps under an hour read the raw readings, longer ones the rollups,
+	// which are by the start of the hour
+	for step, from := range map[time.Duration]time.Time{59 * time.Minute: now.Add(-time.Minute), 2 * time.Hour: now.Add(-time.Hour)} {
+		series, err := GetHostTelemetry("telemetry-1", redfish.MetricTemperature, from, now.Add(time.Minute), step)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(series) != 1 || series[0].Sensor != "Inlet Temp" || series[0].Unit != "Cel" || len(series[0].Points) != 1 {
+			t.Fatalf("step %s: series = %+v", step, series)
+		}
+
+		if point := series[0].Points[0]; point.Min != 20 || point.Max != 40 || point.Avg != 30 {
+			t.Errorf("step %s: point = %+v", step, point)
+		}
+	}
+
+	series, err := GetHostTelemetry("telemetry-1", "", now.Add(-time.Minute), now.Add(time.Minute), time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series) != 2 || series[0].Metric != redfish.MetricFan || series[1].Metric != redfish.MetricTemperature {
+		t.Errorf("series = %+v", series)
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// The users an admin has given a host to. Until bookings are tracked, this
+// is who may operate a host besides admins, and who hears when it goes out
+// of service.
+const HOST_USERS_STATEMENT = `CREATE TABLE IF NOT EXISTS host_users (
+	host_name TEXT NOT NULL,
+	email TEXT NOT NULL,
+	assigned_by TEXT NOT NULL,
+	assign_time TIMESTAMP NOT NULL,
+	PRIMARY KEY (host_name, email)
+);`
+
+const HOST_USER_COLUMNS = `host_name, email, assigned_by, assign_time`
+
+const INSERT_HOST_USER_STATEMENT = `INSERT OR IGNORE INTO host_users (` + HOST_USER_COLUMNS + `) VALUES (?, ?, ?, ?);`
+const SELECT_HOST_USERS_STATEMENT = `SELECT ` + HOST_USER_COLUMNS + ` FROM host_users WHERE host_name = ? ORDER BY email;`
+const DELETE_HOST_USER_STATEMENT = `DELETE FROM host_users WHERE host_name = ? AND email = ?;`
+const DELETE_HOST_USERS_STATEMENT = `DELETE FROM host_users WHERE host_name = ?;`
+
+type DBHostUser struct {
+	HostName   string    `json:"-"`
+	Email      string    `json:"email"`
+	AssignedBy string    `json:"assigned_by"`
+	AssignTime time.Time `json:"assign_time"`
+}
+
+func (u *DBHostUser) JSON() []byte {
+	json, _ := json.Marshal(u)
+	return json
+}
+
+// AssignHostUser gives a host to a user. Assigning a user twice keeps the
+// first assignment.
+func AssignHostUser(name, email, assignedBy string) error {
+	return QueuedExec(INSERT_HOST_USER_STATEMENT, name, email, assignedBy, time.Now())
+}
+
+// UnassignHostUser reports false when the user didn't have the host
+func UnassignHostUser(name, email string) (bool, error) {
+	result, err := QueuedExecResult(DELETE_HOST_USER_STATEMENT, name, email)
+
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func ListHostUsers(name string) ([]*DBHostUser, error) {
+	users := []*DBHostUser{}
+
+	err := queryEach(SELECT_HOST_USERS_STATEMENT, name, func(rows *sql.Rows) error {
+		var u DBHostUser
+
+		if err := rows.Scan(&u.HostName, &u.Email, &u.AssignedBy, &u.AssignTime); err != nil {
+			return err
+		}
+
+		users = append(users, &u)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// HostUsers are the emails of the people a host is assigned to
+func HostUsers(name string) ([]string, error) {
+	users, err := ListHostUsers(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	emails := []string{}
+
+	for _, user := range users {
+		emails = append(emails, user.Email)
+	}
+
+	return emails, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+func openIssues(t *testing.T, name, source string) []*DBHostIssue {
+	t.Helper()
+
+	issues, err := ListHostIssues(name, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := []*DBHostIssue{}
+
+	for _, issue := range issues {
+		if issue.Source == source {
+			found = append(found, issue)
+		}
+	}
+
+	return found
+}
+
+// A part of the BMC that can't be read is reported, and the rest of the
+// hardware is still polled
+func TestPollHardwarePartial(t *testing.T) {
+	bmc := newFakeBMC(t)
+	host, err := CreateHost("hardware-1", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("hardware-1") })
+
+	// The update service is advertised but missing
+	var root map[string]interface{}
+
+	if err := json.Unmarshal(bmc.resources[redfish.ServiceRootPath], &root); err != nil {
+		t.Fatal(err)
+	}
+
+	working := root
+	broken := map[string]interface{}{"UpdateService": map[string]string{"@odata.id": "/redfish/v1/UpdateService"}}
+
+	for key, value := range root {
+		broken[key] = value
+	}
+
+	bmc.Set(redfish.ServiceRootPath, broken)
+
+	if err := host.PollHardware(); err != nil {
+		t.Fatal(err)
+	}
+
+	if issues := openIssues(t, "hardware-1", IssueSourceHardware); len(issues) != 1 || issues[0].Component != "Firmware inventory" {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	if polled, err := GetHost("hardware-1"); err != nil {
+		t.Fatal(err)
+	} else if polled.Hardware.CPU.Count != 2 || polled.Hardware.Memory.SizeMiB != 262144 {
+		t.Errorf("hardware = %+v", polled.Hardware)
+	}
+
+	if info, err := GetHostBMC("hardware-1"); err != nil || info == nil {
+		t.Errorf("bmc = %+v, %v", info, err)
+	}
+
+	// The issue is resolved once the BMC answers again
+	bmc.Set(redfish.ServiceRootPath, working)
+
+	if err := host.PollHardware(); err != nil {
+		t.Fatal(err)
+	}
+
+	if issues := openIssues(t, "hardware-1", IssueSourceHardware); len(issues) != 0 {
+		t.Errorf("issues = %+v", issues)
+	}
+}
+
+// Ports stay as last read while an adapter can't be read
+func TestPollHardwareAdapterError(t *testing.T) {
+	const adapters = "/redfish/v1/Chassis/System.Embedded.1/NetworkAdapters"
+
+	bmc := newFakeBMC(t)
+	host, err := CreateHost("hardware-2", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, bmc.Address(), "root", "calvin", HostRedfishVersion_Dell_iDRAC_9)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { DeleteHost("hardware-2") })
+
+	if err := host.PollHardware(); err != nil {
+		t.Fatal(err)
+	}
+
+	bmc.Set(adapters, map[string]interface{}{"Members": []map[string]string{
+		{"@odata.id": adapters + "/NIC.Slot.2"},
+	}})
+
+	if err := host.PollHardware(); err != nil {
+		t.Fatal(err)
+	}
+
+	if issues := openIssues(t, "hardware-2", IssueSourceHardware); len(issues) != 1 || issues[0].Component != "Network adapters" {
+		t.Fatalf("issues = %+v", issues)
+	}
+
+	ports, err := GetHostPorts("hardware-2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ports) != 2 || ports[0].ID != "NIC.Integrated.1-1" {
+		t.Errorf("ports = %+v", ports)
+	}
+}
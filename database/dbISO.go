@@ -0,0 +1,105 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrISOExists = errors.New("iso already exists")
+
+// The ISOs admins have approved for users to mount on hosts
+const ISOS_STATEMENT = `CREATE TABLE IF NOT EXISTS isos (
+	name TEXT PRIMARY KEY NOT NULL,
+	url TEXT NOT NULL,
+	description TEXT NOT NULL,
+	create_time TIMESTAMP NOT NULL,
+	created_by TEXT NOT NULL
+);`
+
+const INSERT_ISO_STATEMENT = `INSERT INTO isos (name, url, description, create_time, created_by) VALUES (?, ?, ?, ?, ?);`
+const SELECT_ISO_STATEMENT = `SELECT name, url, description, create_time, created_by FROM isos WHERE name = ?;`
+const SELECT_ALL_ISOS_STATEMENT = `SELECT name, url, description, create_time, created_by FROM isos ORDER BY name;`
+const UPDATE_ISO_STATEMENT = `UPDATE isos SET url = ?, description = ? WHERE name = ?;`
+const DELETE_ISO_STATEMENT = `DELETE FROM isos WHERE name = ?;`
+
+type DBISO struct {
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Description string    `json:"description"`
+	CreateTime  time.Time `json:"create_time"`
+	CreatedBy   string    `json:"created_by"`
+}
+
+func (i *DBISO) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+func CreateISO(name, url, description, createdBy string) (*DBISO, error) {
+	if iso, err := GetISO(name); err != nil {
+		return nil, err
+	} else if iso != nil {
+		return nil, ErrISOExists
+	}
+
+	if err := QueuedExec(INSERT_ISO_STATEMENT, name, url, description, time.Now(), createdBy); err != nil {
+		return nil, err
+	}
+
+	return GetISO(name)
+}
+
+func GetISO(name string) (*DBISO, error) {
+	rows, err := QueuedQuery(SELECT_ISO_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	var iso DBISO
+
+	if err := rows.Scan(&iso.Name, &iso.URL, &iso.Description, &iso.CreateTime, &iso.CreatedBy); err != nil {
+		return nil, err
+	}
+
+	return &iso, nil
+}
+
+func ListISOs() ([]*DBISO, error) {
+	rows, err := QueuedQuery(SELECT_ALL_ISOS_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	isos := []*DBISO{}
+
+	for rows.Next() {
+		var iso DBISO
+
+		if err := rows.Scan(&iso.Name, &iso.URL, &iso.Description, &iso.CreateTime, &iso.CreatedBy); err != nil {
+			return nil, err
+		}
+
+		isos = append(isos, &iso)
+	}
+
+	return isos, rows.Err()
+}
+
+func UpdateISO(name, url, description string) error {
+	return QueuedExec(UPDATE_ISO_STATEMENT, url, description, name)
+}
+
+func DeleteISO(name string) error {
+	return QueuedExec(DELETE_ISO_STATEMENT, name)
+}
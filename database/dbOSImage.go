@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"text/template"
+	"time"
+)
+
+var ErrOSImageExists = errors.New("os image already exists")
+
+const (
+	OSTemplateNone        = ""
+	OSTemplateKickstart   = "kickstart"
+	OSTemplatePreseed     = "preseed"
+	OSTemplateAutoinstall = "autoinstall"
+)
+
+var OSTemplateKinds = []string{OSTemplateNone, OSTemplateKickstart, OSTemplatePreseed, OSTemplateAutoinstall}
+
+// The images hosts can be network installed with. kernel_args and template
+// are Go templates rendered with ProvisionData when a host boots.
+const OS_IMAGES_STATEMENT = `CREATE TABLE IF NOT EXISTS os_images (
+	name TEXT PRIMARY KEY NOT NULL,
+	description TEXT NOT NULL,
+	kernel_url TEXT NOT NULL,
+	initrd_url TEXT NOT NULL,
+	kernel_args TEXT NOT NULL,
+	template_kind TEXT NOT NULL,
+	template TEXT NOT NULL,
+	create_time TIMESTAMP NOT NULL,
+	created_by TEXT NOT NULL
+);`
+
+const OS_IMAGE_COLUMNS = `name, description, kernel_url, initrd_url, kernel_args, template_kind, template, create_time, created_by`
+
+const INSERT_OS_IMAGE_STATEMENT = `INSERT INTO os_images (` + OS_IMAGE_COLUMNS + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`
+const SELECT_OS_IMAGE_STATEMENT = `SELECT ` + OS_IMAGE_COLUMNS + ` FROM os_images WHERE name = ?;`
+const SELECT_ALL_OS_IMAGES_STATEMENT = `SELECT ` + OS_IMAGE_COLUMNS + ` FROM os_images ORDER BY name;`
+const UPDATE_OS_IMAGE_STATEMENT = `UPDATE os_images SET description = ?, kernel_url = ?, initrd_url = ?, kernel_args = ?, template_kind = ?, template = ? WHERE name = ?;`
+const DELETE_OS_IMAGE_STATEMENT = `DELETE FROM os_images WHERE name = ?;`
+
+type DBOSImage struct {
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	KernelURL    string    `json:"kernel_url"`
+	InitrdURL    string    `json:"initrd_url"`
+	KernelArgs   string    `json:"kernel_args"`
+	TemplateKind string    `json:"template_kind"`
+	Template     string    `json:"template"`
+	CreateTime   time.Time `json:"create_time"`
+	CreatedBy    string    `json:"created_by"`
+}
+
+func (i *DBOSImage) JSON() []byte {
+	json, _ := json.Marshal(i)
+	return json
+}
+
+func IsOSTemplateKindValid(kind string) bool {
+	return slices.Contains(OSTemplateKinds, kind)
+}
+
+// CheckTemplates parses the image's kernel arguments and template so that
+// mistakes show up when the image is saved rather than when a host boots
+func (i *DBOSImage) CheckTemplates() error {
+	if _, err := template.New("kernel_args").Parse(i.KernelArgs); err != nil {
+		return err
+	}
+
+	_, err := template.New("template").Parse(i.Template)
+	return err
+}
+
+func CreateOSImage(image *DBOSImage, createdBy string) (*DBOSImage, error) {
+	if existing, err := GetOSImage(image.Name); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, ErrOSImageExists
+	}
+
+	if err := QueuedExec(INSERT_OS_IMAGE_STATEMENT, image.Name, image.Description, image.KernelURL, image.InitrdURL, image.KernelArgs, image.TemplateKind, image.Template, time.Now(), createdBy); err != nil {
+		return nil, err
+	}
+
+	return GetOSImage(image.Name)
+}
+
+func GetOSImage(name string) (*DBOSImage, error) {
+	rows, err := QueuedQuery(SELECT_OS_IMAGE_STATEMENT, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	return scanOSImage(rows)
+}
+
+func ListOSImages() ([]*DBOSImage, error) {
+	rows, err := QueuedQuery(SELECT_ALL_OS_IMAGES_STATEMENT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	images := []*DBOSImage{}
+
+	for rows.Next() {
+		image, err := scanOSImage(rows)
+
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+func scanOSImage(rows *sql.Rows) (*DBOSImage, error) {
+	var i DBOSImage
+
+	if err := rows.Scan(&i.Name, &i.Description, &i.KernelURL, &i.InitrdURL, &i.KernelArgs, &i.TemplateKind, &i.Template, &i.CreateTime, &i.CreatedBy); err != nil {
+		return nil, err
+	}
+
+	return &i, nil
+}
+
+func UpdateOSImage(image *DBOSImage) error {
+	return QueuedExec(UPDATE_OS_IMAGE_STATEMENT, image.Description, image.KernelURL, image.InitrdURL, image.KernelArgs, image.TemplateKind, image.Template, image.Name)
+}
+
+func DeleteOSImage(name string) error {
+	return QueuedExec(DELETE_OS_IMAGE_STATEMENT, name)
+}
@@ -22,11 +22,17 @@ const USERS_STATEMENT = `CREATE TABLE IF NOT EXISTS users (
 
 const INSERT_USER_STATEMENT = `INSERT INTO users (email, first_name, last_name, password_hash, create_time) VALUES (?, ?, ?, ?, ?);`
 const SELECT_USER_STATEMENT = `SELECT email, first_name, last_name, password_hash, create_time, privilege FROM users WHERE email = ?;`
+const SELECT_ADMIN_EMAILS_STATEMENT = `SELECT email FROM users WHERE privilege >= ? ORDER BY email;`
 const DELETE_USER_STATEMENT = `DELETE FROM users WHERE email = ?;`
 const UPDATE_USER_NAME_STATEMENT = `UPDATE users SET first_name = ?, last_name = ? WHERE email = ?;`
 const UPDATE_USER_PASSWORD_STATEMENT = `UPDATE users SET password_hash = ? WHERE email = ?;`
 const UPDATE_USER_PRIVILEGE_STATEMENT = `UPDATE users SET privilege = ? WHERE email = ?;`
 
+const (
+	UserPrivilegeBasic = iota
+	UserPrivilegeAdmin
+)
+
 type DBUser struct {
 	// Email, FirstName, LastName, PasswordHash string
 	// CreateTime                               time.Time
@@ -44,6 +50,10 @@ func (u *DBUser) JSON() []byte {
 	return json
 }
 
+func (u *DBUser) IsAdmin() bool {
+	return u.Privilege >= UserPrivilegeAdmin
+}
+
 func UserExists(email string) bool {
 	rows, err := QueuedQuery(SELECT_USER_STATEMENT, email)
 
@@ -90,6 +100,30 @@ func GetUser(email string) (*DBUser, error) {
 	return &user, nil
 }
 
+func ListAdminEmails() ([]string, error) {
+	rows, err := QueuedQuery(SELECT_ADMIN_EMAILS_STATEMENT, UserPrivilegeAdmin)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	emails := []string{}
+
+	for rows.Next() {
+		var email string
+
+		if err := rows.Scan(&email); err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, email)
+	}
+
+	return emails, rows.Err()
+}
+
 func DeleteUser(email string) error {
 	return QueuedExec(DELETE_USER_STATEMENT, email)
 }
@@ -0,0 +1,167 @@
+package database
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"OpnLaaS.cyber.unh.edu/redfish"
+)
+
+// The tests share one database in a temporary directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "coordinator")
+
+	if err != nil {
+		panic(err)
+	}
+
+	lib.Config.DBFile = filepath.Join(dir, "test.db")
+	lib.Config.DBQueueSize = 64
+
+	key, err := lib.NewSecretKey()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if lib.BMCKey, err = lib.ParseSecretKey(key); err != nil {
+		panic(err)
+	}
+
+	if !Connect() {
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeBMC serves the recorded iDRAC 9 the redfish package is tested with.
+// It counts the requests that came with credentials, whether or not they
+// were right. Requests other than GET go to the handlers tests add.
+type fakeBMC struct {
+	*httptest.Server
+	credentialed atomic.Int32
+
+	mu        sync.Mutex
+	resources map[string]json.RawMessage
+	handlers  map[string]func(body map[string]interface{}) int
+}
+
+func newFakeBMC(t *testing.T) *fakeBMC {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "redfish", "testdata", "idrac9.json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bmc := &fakeBMC{handlers: map[string]func(body map[string]interface{}) int{}}
+
+	if err := json.Unmarshal(data, &bmc.resources); err != nil {
+		t.Fatal(err)
+	}
+
+	bmc.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		username, password, ok := r.BasicAuth()
+
+		if ok {
+			bmc.credentialed.Add(1)
+		}
+
+		if path != redfish.ServiceRootPath && (!ok || username != "root" || password != "calvin") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != "GET" {
+			bmc.mu.Lock()
+			handler, found := bmc.handlers[r.Method+" "+path]
+			bmc.mu.Unlock()
+
+			if !found {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(handler(body))
+			return
+		}
+
+		bmc.mu.Lock()
+		resource, found := bmc.resources[path]
+		bmc.mu.Unlock()
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resource)
+	}))
+
+	// Refused certificates are what some tests are after
+	bmc.Config.ErrorLog = log.New(io.Discard, "", 0)
+	bmc.StartTLS()
+
+	t.Cleanup(bmc.Close)
+	return bmc
+}
+
+func (b *fakeBMC) Address() string {
+	return strings.TrimPrefix(b.URL, "https://")
+}
+
+func (b *fakeBMC) Fingerprint() string {
+	return redfish.Fingerprint(b.Certificate())
+}
+
+// Handle answers method requests to path with the status handler returns
+func (b *fakeBMC) Handle(method, path string, handler func(body map[string]interface{}) int) {
+	b.mu.Lock()
+	b.handlers[method+" "+path] = handler
+	b.mu.Unlock()
+}
+
+// Set replaces what the BMC serves at path
+func (b *fakeBMC) Set(path string, resource interface{}) {
+	data, _ := json.Marshal(resource)
+
+	b.mu.Lock()
+	b.resources[path] = data
+	b.mu.Unlock()
+}
+
+// Link points a property of the resource at path to another resource
+func (b *fakeBMC) Link(t *testing.T, path, property, target string) {
+	t.Helper()
+
+	var resource map[string]interface{}
+
+	b.mu.Lock()
+	err := json.Unmarshal(b.resources[path], &resource)
+	b.mu.Unlock()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resource[property] = map[string]string{"@odata.id": target}
+	b.Set(path, resource)
+}
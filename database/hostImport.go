@@ -0,0 +1,284 @@
+package database
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	HostImportFormatCSV  = "csv"
+	HostImportFormatYAML = "yaml"
+)
+
+// What happened to each row of an import. In a dry run, rows that would have
+// been created are valid instead.
+const (
+	HostImportCreated     = "created"
+	HostImportValid       = "valid"
+	HostImportInvalid     = "invalid"
+	HostImportExists      = "exists"
+	HostImportUnreachable = "unreachable"
+	HostImportFailed      = "failed"
+)
+
+// BMCs are probed a few at a time, since an unreachable one takes a while to
+// time out
+const hostImportProbes = 8
+
+var ErrHostImportFormat = errors.New("unknown host import format")
+
+type HostImportRow struct {
+	Name           string            `json:"name" yaml:"name"`
+	Address        string            `json:"address" yaml:"address"`
+	Username       string            `json:"username" yaml:"username"`
+	Password       string            `json:"password" yaml:"password"`
+	RedfishVersion *int              `json:"redfish_version" yaml:"redfish_version"`
+	Labels         map[string]string `json:"labels" yaml:"labels"`
+
+	// The certificate the BMC has to present, when it is already known
+	fingerprint string
+}
+
+type HostImportResult struct {
+	Row            int    `json:"row"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+	Error          string `json:"error,omitempty"`
+	RedfishVersion int    `json:"redfish_version,omitempty"`
+}
+
+// ParseHostImport reads an inventory file. CSV files need a header with at
+// least name, address, username and password. redfish_version and labels
+// are optional, labels being key=value pairs separated by semicolons. YAML
+// files are a list of hosts with the same fields, labels being a map.
+func ParseHostImport(data []byte, format string) ([]*HostImportRow, error) {
+	switch format {
+	case HostImportFormatCSV:
+		return parseHostImportCSV(data)
+	case HostImportFormatYAML:
+		rows := []*HostImportRow{}
+
+		if err := yaml.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+
+		return rows, nil
+	default:
+		return nil, ErrHostImportFormat
+	}
+}
+
+func parseHostImportCSV(data []byte) ([]*HostImportRow, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	columns := map[string]int{}
+
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range []string{"name", "address", "username", "password"} {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("missing %s column", column)
+		}
+	}
+
+	rows := []*HostImportRow{}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		field := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+
+			return ""
+		}
+
+		row := &HostImportRow{
+			Name:     field("name"),
+			Address:  field("address"),
+			Username: field("username"),
+			Password: field("password"),
+			Labels:   map[string]string{},
+		}
+
+		if value := field("redfish_version"); value != "" {
+			version, err := strconv.Atoi(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("line %d: redfish_version is not a number", line)
+			}
+
+			row.RedfishVersion = &version
+		}
+
+		for _, pair := range strings.Split(field("labels"), ";") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+
+			key, value, _ := strings.Cut(pair, "=")
+			row.Labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// validate checks everything about a row that doesn't need the BMC
+func (r *HostImportRow) validate() string {
+	switch {
+	case !lib.IsHostNameValid(r.Name):
+		return "invalid name"
+	case !lib.IsIPMIAddressValid(r.Address):
+		return "invalid address"
+	case r.Username == "" || r.Password == "":
+		return "missing credentials"
+	case r.RedfishVersion != nil && !IsRedfishVersionValid(*r.RedfishVersion):
+		return "invalid redfish_version"
+	}
+
+	for key, value := range r.Labels {
+		if !lib.IsLabelKeyValid(key) || !lib.IsLabelValueValid(value) {
+			return "invalid label " + key
+		}
+	}
+
+	return ""
+}
+
+// ImportHosts validates every row, probes the BMCs of the valid ones and
+// creates their hosts, unless this is a dry run. Every row is reported on,
+// in order.
+func ImportHosts(rows []*HostImportRow, dryRun bool) []*HostImportResult {
+	results := make([]*HostImportResult, len(rows))
+	seen := map[string]bool{}
+	probe := []int{}
+
+	for i, row := range rows {
+		result := &HostImportResult{Row: i + 1, Name: row.Name, Status: HostImportInvalid}
+		results[i] = result
+
+		if result.Error = row.validate(); result.Error != "" {
+			continue
+		}
+
+		if seen[row.Name] {
+			result.Error = "name is repeated"
+			continue
+		}
+
+		seen[row.Name] = true
+
+		if HostExists(row.Name) {
+			result.Status = HostImportExists
+			continue
+		}
+
+		probe = append(probe, i)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, hostImportProbes)
+
+	for _, i := range probe {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(row *HostImportRow, result *HostImportResult) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			importHost(row, result, dryRun)
+		}(rows[i], results[i])
+	}
+
+	wg.Wait()
+	return results
+}
+
+func importHost(row *HostImportRow, result *HostImportResult, dryRun bool) {
+	version, driver, info, err := DetectBMC(row.Address, row.Username, row.Password, row.fingerprint)
+
+	if err != nil {
+		result.Status, result.Error = HostImportUnreachable, err.Error()
+		return
+	}
+
+	if row.RedfishVersion != nil {
+		version = *row.RedfishVersion
+	}
+
+	result.RedfishVersion = version
+
+	if dryRun {
+		result.Status = HostImportValid
+		return
+	}
+
+	host, err := CreateHost(row.Name, HostHealthUnknown, 0, 0, 0, 0, 0, 0, "", 0, row.Address, row.Username, row.Password, version)
+
+	if err != nil {
+		result.Status, result.Error = HostImportFailed, err.Error()
+
+		if err == ErrHostExists {
+			result.Status, result.Error = HostImportExists, ""
+		}
+
+		return
+	}
+
+	result.Status = HostImportCreated
+
+	if err := SetHostBMC(host.Name, driver, info); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not store BMC details for host %s: %s", host.Name, err.Error()))
+	}
+
+	if err := PinHostCertificate(host.Name, info.CertificateFingerprint); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not pin certificate of host %s: %s", host.Name, err.Error()))
+	}
+
+	if len(row.Labels) > 0 {
+		labels := map[string]*string{}
+
+		for key, value := range row.Labels {
+			labels[key] = &value
+		}
+
+		if err := UpdateHostLabels(host.Name, labels, true); err != nil {
+			lib.Log.Error(fmt.Sprintf("Could not label host %s: %s", host.Name, err.Error()))
+		}
+	}
+
+	// Outside the server there's no poller, and the server polls new hosts
+	// on its own soon enough
+	PollHostNow(host.Name)
+}
@@ -0,0 +1,161 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseHostImport(t *testing.T) {
+	version := HostRedfishVersion_Dell_iDRAC_9
+
+	csv := "Name, Address, Username, Password, Redfish_Version, Labels\n" +
+		fmt.Sprintf("import-1, 10.0.0.1, root, calvin, %d, site=durham; rack = 4\n", version) +
+		"import-2, 10.0.0.2:8443, admin, secret, , \n"
+
+	yaml := fmt.Sprintf(`
+- name: import-1
+  address: 10.0.0.1
+  username: root
+  password: calvin
+  redfish_version: %d
+  labels:
+    site: durham
+    rack: "4"
+- name: import-2
+  address: 10.0.0.2:8443
+  username: admin
+  password: secret
+`, version)
+
+	want := []*HostImportRow{
+		{Name: "import-1", Address: "10.0.0.1", Username: "root", Password: "calvin", RedfishVersion: &version, Labels: map[string]string{"site": "durham", "rack": "4"}},
+		{Name: "import-2", Address: "10.0.0.2:8443", Username: "admin", Password: "secret", Labels: map[string]string{}},
+	}
+
+	for _, format := range []string{HostImportFormatCSV, HostImportFormatYAML} {
+		data := csv
+
+		if format == HostImportFormatYAML {
+			data = yaml
+		}
+
+		rows, err := ParseHostImport([]byte(data), format)
+
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		// YAML leaves out labels that aren't given
+		if format == HostImportFormatYAML && rows[1].Labels == nil {
+			rows[1].Labels = map[string]string{}
+		}
+
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("%s: rows = %+v", format, rows)
+		}
+	}
+
+	if _, err := ParseHostImport([]byte("name,address,username\nimport-1,10.0.0.1,root\n"), HostImportFormatCSV); err == nil {
+		t.Error("parsed a file without a password column")
+	}
+
+	if _, err := ParseHostImport([]byte("name,address,username,password,redfish_version\nimport-1,10.0.0.1,root,calvin,idrac\n"), HostImportFormatCSV); err == nil {
+		t.Error("parsed a redfish_version that isn't a number")
+	}
+
+	if _, err := ParseHostImport([]byte(csv), "json"); err != ErrHostImportFormat {
+		t.Errorf("err = %v, want %v", err, ErrHostImportFormat)
+	}
+}
+
+// Every row is reported on in order, and a dry run probes the BMCs without
+// creating anything
+func TestImportHosts(t *testing.T) {
+	bmc := newFakeBMC(t)
+
+	if _, err := CreateHost("import-exists", HostHealthGood, 0, 0, 0, 0, 0, 0, "", 0, "192.0.2.1", "root", "calvin", HostRedfishVersion_Dell_iDRAC_9); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		DeleteHost("import-exists")
+		DeleteHost("import-3")
+	})
+
+	generic := HostRedfishVersion_Generic
+	rows := []*HostImportRow{
+		{Name: "import-3", Address: bmc.Address(), Username: "root", Password: "calvin", Labels: map[string]string{"site": "durham"}},
+		{Name: "import 4", Address: bmc.Address(), Username: "root", Password: "calvin"},
+		{Name: "import-5", Address: "10.0.0.300", Username: "root", Password: "calvin"},
+		{Name: "import-6", Address: bmc.Address(), Username: "root"},
+		{Name: "import-7", Address: bmc.Address(), Username: "root", Password: "calvin", Labels: map[string]string{"Site": "durham"}},
+		{Name: "import-3", Address: bmc.Address(), Username: "root", Password: "calvin"},
+		{Name: "import-exists", Address: bmc.Address(), Username: "root", Password: "calvin"},
+		{Name: "import-8", Address: "127.0.0.1:1", Username: "root", Password: "calvin"},
+		{Name: "import-9", Address: bmc.Address(), Username: "root", Password: "calvin", RedfishVersion: &generic},
+	}
+
+	statuses := func(results []*HostImportResult) []string {
+		got := []string{}
+
+		for i, result := range results {
+			if result.Row != i+1 || result.Name != rows[i].Name {
+				t.Errorf("result %d = %+v", i, result)
+			}
+
+			got = append(got, result.Status)
+		}
+
+		return got
+	}
+
+	results := ImportHosts(rows, true)
+	want := []string{HostImportValid, HostImportInvalid, HostImportInvalid, HostImportInvalid, HostImportInvalid, HostImportInvalid, HostImportExists, HostImportUnreachable, HostImportValid}
+
+	if got := statuses(results); !reflect.DeepEqual(got, want) {
+		t.Fatalf("dry run = %q, want %q", got, want)
+	}
+
+	if results[0].RedfishVersion != HostRedfishVersion_Dell_iDRAC_9 || results[8].RedfishVersion != HostRedfishVersion_Generic {
+		t.Errorf("redfish versions = %d, %d", results[0].RedfishVersion, results[8].RedfishVersion)
+	}
+
+	if results[5].Error != "name is repeated" {
+		t.Errorf("repeated name: %+v", results[5])
+	}
+
+	if HostExists("import-3") || HostExists("import-9") {
+		t.Fatal("dry run created hosts")
+	}
+
+	t.Cleanup(func() { DeleteHost("import-9") })
+
+	want[0], want[8] = HostImportCreated, HostImportCreated
+
+	if got := statuses(ImportHosts(rows, false)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("import = %q, want %q", got, want)
+	}
+
+	host, err := GetHost("import-3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if host.IPMI.RedfishVersion != HostRedfishVersion_Dell_iDRAC_9 {
+		t.Errorf("redfish version = %d", host.IPMI.RedfishVersion)
+	}
+
+	if labels, err := GetHostLabels("import-3"); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(labels, map[string]string{"site": "durham"}) {
+		t.Errorf("labels = %v", labels)
+	}
+
+	if cert, err := GetHostCertificate("import-3"); err != nil {
+		t.Fatal(err)
+	} else if cert == nil || cert.Fingerprint != bmc.Fingerprint() {
+		t.Errorf("pinned %+v, want %s", cert, bmc.Fingerprint())
+	}
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+const (
+	PollKindHealth    = "health"
+	PollKindHardware  = "hardware"
+	PollKindTelemetry = "telemetry"
+	PollKindEventLogs = "event_logs"
+	PollKindEvents    = "events"
+)
+
+const pollerTick = time.Minute
+
+var ErrPollerBusy = errors.New("poller is busy")
+
+type pollKind struct {
+	name     string
+	interval func(h *DBHost) time.Duration
+	poll     func(h *DBHost) error
+}
+
+var pollKinds = []pollKind{
+	{PollKindHardware, func(*DBHost) time.Duration { return lib.Config.HardwarePollInterval }, (*DBHost).PollHardware},
+	{PollKindHealth, healthPollInterval, (*DBHost).PollHealth},
+	{PollKindTelemetry, func(*DBHost) time.Duration { return lib.Config.TelemetryPollInterval }, (*DBHost).PollTelemetry},
+	{PollKindEventLogs, func(*DBHost) time.Duration { return lib.Config.EventLogPollInterval }, (*DBHost).PollEventLogs},
+	{PollKindEvents, func(*DBHost) time.Duration { return lib.Config.EventSubscriptionInterval }, (*DBHost).PollEventSubscription},
+}
+
+type pollJob struct {
+	host string
+	kind pollKind
+}
+
+func (j pollJob) key() string {
+	return j.host + "/" + j.kind.name
+}
+
+type Poller struct {
+	jobs chan pollJob
+
+	mu      sync.Mutex
+	pending map[string]bool
+}
+
+var poller *Poller
+
+// StartPoller periodically polls every host with a pool of workers
+func StartPoller() {
+	workers := max(lib.Config.PollWorkers, 1)
+
+	poller = &Poller{
+		jobs:    make(chan pollJob, workers*16),
+		pending: make(map[string]bool),
+	}
+
+	for i := 0; i < workers; i++ {
+		go poller.work()
+	}
+
+	go poller.loop()
+
+	lib.Log.Status(fmt.Sprintf("Host poller started with %d workers", workers))
+}
+
+// PollHostNow queues every kind of poll for a host, regardless of schedule
+func PollHostNow(name string) error {
+	if poller == nil {
+		return ErrPollerBusy
+	}
+
+	for _, kind := range pollKinds {
+		if !poller.enqueue(pollJob{name, kind}) {
+			return ErrPollerBusy
+		}
+	}
+
+	return nil
+}
+
+// pollHostKindNow queues one kind of poll for a host, regardless of schedule
+func pollHostKindNow(name, kind string) bool {
+	if poller == nil {
+		return false
+	}
+
+	for _, k := range pollKinds {
+		if k.name == kind {
+			return poller.enqueue(pollJob{name, k})
+		}
+	}
+
+	return false
+}
+
+func (p *Poller) loop() {
+	ticker := time.NewTicker(pollerTick)
+	defer ticker.Stop()
+
+	for {
+		p.schedule()
+		<-ticker.C
+	}
+}
+
+func (p *Poller) schedule() {
+	hosts, err := ListHosts()
+
+	if err != nil {
+		lib.Log.Error("Could not list hosts to poll: " + err.Error())
+		return
+	}
+
+	polls, err := ListHostPolls()
+
+	if err != nil {
+		lib.Log.Error("Could not list host polls: " + err.Error())
+		return
+	}
+
+	next := make(map[string]time.Time)
+
+	for _, poll := range polls {
+		next[poll.HostName+"/"+poll.Kind] = poll.NextPoll
+	}
+
+	now := time.Now()
+
+	for _, host := range hosts {
+		for _, kind := range pollKinds {
+			job := pollJob{host.Name, kind}
+
+			if at, ok := next[job.key()]; ok && at.After(now) {
+				continue
+			}
+
+			p.enqueue(job)
+		}
+	}
+}
+
+// enqueue never blocks. A job that is already pending is not queued twice,
+// and a full queue is retried on the next tick.
+func (p *Poller) enqueue(job pollJob) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending[job.key()] {
+		return true
+	}
+
+	select {
+	case p.jobs <- job:
+		p.pending[job.key()] = true
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Poller) work() {
+	for job := range p.jobs {
+		p.run(job)
+
+		p.mu.Lock()
+		delete(p.pending, job.key())
+		p.mu.Unlock()
+	}
+}
+
+func (p *Poller) run(job pollJob) {
+	host, err := GetHost(job.host)
+
+	if err != nil || host == nil {
+		return
+	}
+
+	start := time.Now()
+	pollErr := job.kind.poll(host)
+
+	if pollErr != nil {
+		lib.Log.Warning(fmt.Sprintf("Could not poll %s for host %s: %s", job.kind.name, host.Name, pollErr.Error()))
+	}
+
+	if err := RecordHostPoll(host.Name, job.kind.name, start, pollErr, nextPoll(start, job.kind.interval(host))); err != nil {
+		lib.Log.Error(fmt.Sprintf("Could not record %s poll for host %s: %s", job.kind.name, host.Name, err.Error()))
+	}
+}
+
+// nextPoll spreads polls out by up to POLL_JITTER, but never by more than a
+// tenth of the interval, so short intervals like telemetry's stay close to
+// what was asked for
+func nextPoll(from time.Time, interval time.Duration) time.Time {
+	next := from.Add(interval)
+
+	if jitter := min(lib.Config.PollJitter, interval/10); jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(jitter))))
+	}
+
+	return next
+}
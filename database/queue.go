@@ -90,6 +90,23 @@ func QueuedExec(query string, args ...interface{}) error {
 	})
 }
 
+func QueuedExecResult(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := GetQueue().EnqueueOperation(func() error {
+		stmt, err := db.Prepare(query)
+		if err != nil {
+			return err
+		}
+
+		defer stmt.Close()
+		result, err = stmt.Exec(args...)
+
+		return err
+	})
+
+	return result, err
+}
+
 func QueuedQuery(query string, args ...interface{}) (*sql.Rows, error) {
 	var rows *sql.Rows
 	err := GetQueue().EnqueueOperation(func() error {
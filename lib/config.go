@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"time"
+
 	"github.com/Netflix/go-env"
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,14 @@ type Environment struct {
 	Port   int    `env:"PORT,default=8090"`
 	TlsDir string `env:"TLS_DIR"`
 
+	// Where hosts reach the server when they network boot. Taken from the
+	// request when empty.
+	PublicURL string `env:"PUBLIC_URL"`
+
+	// Where the web frontend is served from, the only origin consoles can
+	// be opened from. The server's own origin when empty.
+	FrontendURL string `env:"FRONTEND_URL"`
+
 	// Database setup
 	DBFile      string `env:"DB_FILE,default=opnlaas.db"`
 	DBSalt      string `env:"DB_SALT,required=true"`
@@ -22,6 +32,51 @@ type Environment struct {
 	SmtpUser     string `env:"SMTP_USER,required=true"`
 	SmtpPassword string `env:"SMTP_PASSWORD,required=true"`
 
+	// BMC credential encryption, one of these is required
+	BMCKey     string `env:"BMC_KEY"`
+	BMCKeyFile string `env:"BMC_KEY_FILE"`
+
+	// Host polling
+	HealthPollInterval    time.Duration `env:"HEALTH_POLL_INTERVAL,default=1h"`
+	HardwarePollInterval  time.Duration `env:"HARDWARE_POLL_INTERVAL,default=24h"`
+	TelemetryPollInterval time.Duration `env:"TELEMETRY_POLL_INTERVAL,default=5m"`
+	EventLogPollInterval  time.Duration `env:"EVENT_LOG_POLL_INTERVAL,default=15m"`
+	PollJitter            time.Duration `env:"POLL_JITTER,default=5m"`
+	PollWorkers           int           `env:"POLL_WORKERS,default=4"`
+
+	// Sensor telemetry retention
+	TelemetryRawRetention    time.Duration `env:"TELEMETRY_RAW_RETENTION,default=168h"`
+	TelemetryHourlyRetention time.Duration `env:"TELEMETRY_HOURLY_RETENTION,default=8760h"`
+
+	// BMC event log retention
+	EventLogRetention time.Duration `env:"EVENT_LOG_RETENTION,default=2160h"`
+
+	// BMC event subscriptions. Hosts whose BMCs push their events are still
+	// polled for health, but less often.
+	EventSubscriptionInterval time.Duration `env:"EVENT_SUBSCRIPTION_INTERVAL,default=6h"`
+	PushedHealthPollInterval  time.Duration `env:"PUSHED_HEALTH_POLL_INTERVAL,default=24h"`
+
+	// BMC discovery. Each scan probes this many addresses at a time, and
+	// waits this long for each.
+	DiscoveryPort         int           `env:"DISCOVERY_PORT,default=443"`
+	DiscoveryWorkers      int           `env:"DISCOVERY_WORKERS,default=32"`
+	DiscoveryTimeout      time.Duration `env:"DISCOVERY_TIMEOUT,default=3s"`
+	DiscoveryMaxAddresses int           `env:"DISCOVERY_MAX_ADDRESSES,default=4096"`
+
+	// Where serial console sessions are recorded
+	ConsoleRecordingDir string `env:"CONSOLE_RECORDING_DIR,default=console-recordings"`
+
+	// Hosts with firmware older than the minimum for their model are
+	// emailed to admins this often. 0 turns the report off.
+	FirmwareReportInterval time.Duration `env:"FIRMWARE_REPORT_INTERVAL,default=168h"`
+
+	// How long a BMC gets to install a firmware update before it is
+	// considered failed
+	FirmwareUpdateTimeout time.Duration `env:"FIRMWARE_UPDATE_TIMEOUT,default=2h"`
+
+	// How long a host gets to take in the settings of a BIOS profile
+	BIOSApplyTimeout time.Duration `env:"BIOS_APPLY_TIMEOUT,default=30m"`
+
 	// Configuration
 	LabName              string   `env:"LAB_NAME,default=Sample Laboratory"`
 	LabOrg               string   `env:"LAB_ORG,default=Placebo Pharmaceuticals"`
@@ -41,5 +96,5 @@ func InitEnv() error {
 		return err
 	}
 
-	return nil
+	return loadBMCKey()
 }
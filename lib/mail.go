@@ -0,0 +1,22 @@
+package lib
+
+import "gopkg.in/mail.v2"
+
+// SendEmail sends an HTML email from the lab's SMTP account. Each recipient
+// gets their own copy so that addresses aren't shared.
+func SendEmail(to []string, subject, htmlBody string) error {
+	d := mail.NewDialer(Config.SmtpHost, Config.SmtpPort, Config.SmtpUser, Config.SmtpPassword)
+	messages := []*mail.Message{}
+
+	for _, recipient := range to {
+		m := mail.NewMessage()
+		m.SetHeader("From", Config.SmtpUser)
+		m.SetHeader("To", recipient)
+		m.SetHeader("Subject", subject)
+		m.SetBody("text/html", htmlBody)
+
+		messages = append(messages, m)
+	}
+
+	return d.DialAndSend(messages...)
+}
@@ -3,22 +3,12 @@ package lib
 import (
 	"math/rand"
 	"time"
-
-	"gopkg.in/mail.v2"
 )
 
 func SendEmailTo(to, key string) {
 	emailBody := "Please use the following code to log in: <code>" + key + "</code>"
 
-	m := mail.NewMessage()
-	m.SetHeader("From", Config.SmtpUser)
-	m.SetHeader("To", to)
-	m.SetHeader("Subject", "Login Code")
-	m.SetBody("text/html", emailBody)
-
-	d := mail.NewDialer(Config.SmtpHost, Config.SmtpPort, Config.SmtpUser, Config.SmtpPassword)
-
-	if err := d.DialAndSend(m); err != nil {
+	if err := SendEmail([]string{to}, "Login Code", emailBody); err != nil {
 		Log.Error("Failed to send email to " + to + ": " + err.Error())
 	}
 }
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+const secretPrefix = "v1:"
+
+var (
+	ErrNoSecretKey       = errors.New("BMC_KEY or BMC_KEY_FILE must be set")
+	ErrBadSecretKey      = errors.New("secret key must be 32 base64 encoded bytes")
+	ErrSecretKeyMismatch = errors.New("secret was encrypted with a different key")
+	ErrBadSecret         = errors.New("secret is malformed")
+)
+
+// SecretKey encrypts BMC credentials with AES-256-GCM. Ciphertexts are
+// tagged with the key's ID so that a wrong key is reported as such rather
+// than as corrupt data.
+type SecretKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// The key BMC credentials are encrypted with, loaded by InitEnv
+var BMCKey *SecretKey
+
+func NewSecretKey() (string, error) {
+	raw := make([]byte, 32)
+
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func ParseSecretKey(encoded string) (*SecretKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+
+	if err != nil || len(raw) != 32 {
+		return nil, ErrBadSecretKey
+	}
+
+	block, err := aes.NewCipher(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return &SecretKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func ReadSecretKeyFile(path string) (*SecretKey, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSecretKey(string(data))
+}
+
+func loadBMCKey() error {
+	var err error
+
+	switch {
+	case Config.BMCKey != "":
+		BMCKey, err = ParseSecretKey(Config.BMCKey)
+	case Config.BMCKeyFile != "":
+		BMCKey, err = ReadSecretKeyFile(Config.BMCKeyFile)
+	default:
+		err = ErrNoSecretKey
+	}
+
+	return err
+}
+
+// parseSecret splits a ciphertext written by Encrypt, v1:<key id>:<base64>,
+// into the key ID and sealed bytes
+func parseSecret(value string) (string, []byte, bool) {
+	if !strings.HasPrefix(value, secretPrefix) {
+		return "", nil, false
+	}
+
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, secretPrefix), ":")
+
+	if !ok || len(id) != 8 {
+		return "", nil, false
+	}
+
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", nil, false
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return "", nil, false
+	}
+
+	return id, sealed, true
+}
+
+// IsEncryptedSecret reports whether value is shaped like a ciphertext, which
+// doesn't mean it can be decrypted
+func IsEncryptedSecret(value string) bool {
+	_, _, ok := parseSecret(value)
+	return ok
+}
+
+// Encrypt seals plaintext to a context, such as the row and column it is
+// stored in, so that ciphertexts can't be swapped between rows
+func (k *SecretKey) Encrypt(plaintext, context string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, []byte(plaintext), []byte(context))
+
+	return secretPrefix + k.id + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *SecretKey) Decrypt(ciphertext, context string) (string, error) {
+	id, sealed, ok := parseSecret(ciphertext)
+
+	if !ok {
+		return "", ErrBadSecret
+	}
+
+	if id != k.id {
+		return "", ErrSecretKeyMismatch
+	}
+
+	if len(sealed) < k.aead.NonceSize() {
+		return "", ErrBadSecret
+	}
+
+	nonce, sealed := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, sealed, []byte(context))
+
+	if err != nil {
+		return "", ErrBadSecret
+	}
+
+	return string(plaintext), nil
+}
@@ -1,11 +1,20 @@
 package lib
 
-import "regexp"
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+)
 
 // Leaving the + in the first thing opens up to the possibility of mail bombing
 // sample+1@gmail.com and sample+2@gmail.com point to the same mailbox, but are different emails
 var emailRegex *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-z]{2,4}$`)
 var nameRegex *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9_ ']+$`)
+var hostNameRegex *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]*[a-zA-Z0-9])?$`)
+var labelKeyRegex *regexp.Regexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/\-]*[a-z0-9])?$`)
+var imageNameRegex *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._\-]*$`)
+var switchNameRegex *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:/\-]*$`)
 
 func IsEmailValid(email string) bool {
 	return emailRegex.MatchString(email)
@@ -18,3 +27,66 @@ func IsPasswordValid(password string) bool {
 func IsNameValid(name string) bool {
 	return len(name) > 0 && len(name) <= 48 && nameRegex.MatchString(name)
 }
+
+func IsHostNameValid(name string) bool {
+	return len(name) > 0 && len(name) <= 63 && hostNameRegex.MatchString(name)
+}
+
+// BMCs have to be on a static IPv4 address. A port is allowed so that
+// BMCs behind a NAT or forwarded port can still be reached.
+func IsIPMIAddressValid(address string) bool {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			return false
+		}
+
+		address = host
+	}
+
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() != nil
+}
+
+// Image names show up in URLs, so they are kept to a safe set of characters
+func IsImageNameValid(name string) bool {
+	return len(name) > 0 && len(name) <= 64 && imageNameRegex.MatchString(name)
+}
+
+// BMCs fetch images themselves, so they have to be at an absolute http(s) URL
+func IsImageURLValid(address string) bool {
+	u, err := url.Parse(address)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// BIOS profile names show up in URLs like image names
+func IsProfileNameValid(name string) bool {
+	return len(name) > 0 && len(name) <= 64 && imageNameRegex.MatchString(name)
+}
+
+// Label keys are lowercase so that "Site" and "site" can't both be set
+func IsLabelKeyValid(key string) bool {
+	return len(key) > 0 && len(key) <= 63 && labelKeyRegex.MatchString(key)
+}
+
+func IsLabelValueValid(value string) bool {
+	if len(value) > 256 {
+		return false
+	}
+
+	for _, r := range value {
+		if r < ' ' || r == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Switch and switch port names, such as "leaf-1" and "Ethernet1/24"
+func IsSwitchNameValid(name string) bool {
+	return len(name) > 0 && len(name) <= 64 && switchNameRegex.MatchString(name)
+}
+
+func IsVLANValid(vlan int) bool {
+	return vlan >= 1 && vlan <= 4094
+}
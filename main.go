@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -65,13 +66,72 @@ func withAuth(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+func withAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !withAuth(w, r) {
+		return false
+	}
+
+	email, _ := r.Cookie("email")
+	user, err := database.GetUser(strings.ToLower(email.Value))
+
+	if err != nil || user == nil || !user.IsAdmin() {
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// isAdmin is only meaningful after withAuth succeeded
+func isAdmin(r *http.Request) bool {
+	user, err := database.GetUser(currentUser(r))
+	return err == nil && user != nil && user.IsAdmin()
+}
+
+// currentUser is only meaningful after withAuth or withAdmin succeeded
+func currentUser(r *http.Request) string {
+	email, err := r.Cookie("email")
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(email.Value)
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Header.Get("Content-Type") != "text/plain" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	body, err := json.Marshal(v)
+
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
 func withCors(w http.ResponseWriter, r *http.Request) {
 	origin := r.Header.Get("Origin")
 	if origin != "" {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
 	}
 
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
@@ -79,6 +139,11 @@ func withCors(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	if err := lib.InitEnv(); err != nil {
 		lib.Log.Error("Could not initialize environment: " + err.Error())
 		return
@@ -90,6 +155,21 @@ func main() {
 		return
 	}
 
+	database.StartPoller()
+	database.StartFirmwareReports()
+
+	if err := database.EndInterruptedDiscoveries(); err != nil {
+		lib.Log.Error("Could not end interrupted discoveries: " + err.Error())
+	}
+
+	if err := database.EndInterruptedFirmwareUpdates(); err != nil {
+		lib.Log.Error("Could not end interrupted firmware updates: " + err.Error())
+	}
+
+	if err := database.EndInterruptedBIOSApplies(); err != nil {
+		lib.Log.Error("Could not end interrupted BIOS profiles: " + err.Error())
+	}
+
 	metadataJSON, _ := json.Marshal(map[string]interface{}{
 		"name":                 lib.Config.LabName,
 		"organization":         lib.Config.LabOrg,
@@ -361,6 +441,19 @@ func main() {
 		lib.Log.Basic(fmt.Sprintf("User %s deleted", email.Value))
 	})
 
+	registerHostRoutes()
+	registerIssueRoutes()
+	registerAuditRoutes()
+	registerISORoutes()
+	registerOSImageRoutes()
+	registerProvisionRoutes()
+	registerPortRoutes()
+	registerEventRoutes()
+	registerDiscoveryRoutes()
+	registerConsoleRoutes()
+	registerFirmwareRoutes()
+	registerBIOSRoutes()
+
 	lib.Log.Status(fmt.Sprintf("Server started on port %d", lib.Config.Port))
 	var at string = fmt.Sprintf("%s:%d", lib.Config.Host, lib.Config.Port)
 
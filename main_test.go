@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"OpnLaaS.cyber.unh.edu/database"
+	"OpnLaaS.cyber.unh.edu/lib"
+)
+
+// The tests share one database in a temporary directory, and the routes
+// they need are registered on http.DefaultServeMux once, like main does
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "coordinator")
+
+	if err != nil {
+		panic(err)
+	}
+
+	lib.Config.DBFile = filepath.Join(dir, "test.db")
+	lib.Config.DBQueueSize = 64
+
+	key, err := lib.NewSecretKey()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if lib.BMCKey, err = lib.ParseSecretKey(key); err != nil {
+		panic(err)
+	}
+
+	if !database.Connect() {
+		os.Exit(1)
+	}
+
+	registerHostRoutes()
+	registerEventRoutes()
+	registerProvisionRoutes()
+	registerConsoleRoutes()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.DefaultServeMux)
+	t.Cleanup(server.Close)
+
+	return server
+}
@@ -0,0 +1,86 @@
+package redfish
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrBIOSUnsupported = errors.New("bmc does not expose bios settings")
+
+type Bios struct {
+	ODataID           string                 `json:"@odata.id"`
+	AttributeRegistry string                 `json:"AttributeRegistry"`
+	Attributes        map[string]interface{} `json:"Attributes"`
+	Settings          struct {
+		SettingsObject      Link     `json:"SettingsObject"`
+		SupportedApplyTimes []string `json:"SupportedApplyTimes"`
+	} `json:"@Redfish.Settings"`
+}
+
+// Bios returns the system's current BIOS attributes
+func (c *Client) Bios() (*Bios, error) {
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if system.Bios.ODataID == "" {
+		return nil, ErrBIOSUnsupported
+	}
+
+	var bios Bios
+
+	if err := c.Get(system.Bios.ODataID, &bios); err != nil {
+		return nil, err
+	}
+
+	bios.ODataID = system.Bios.ODataID
+	return &bios, nil
+}
+
+// SetBiosAttributes stages attributes to be applied the next time the
+// system resets. BIOS settings can't change while it runs, so it is up to
+// the caller to reset it.
+func (c *Client) SetBiosAttributes(attributes map[string]interface{}) error {
+	bios, err := c.Bios()
+
+	if err != nil {
+		return err
+	}
+
+	// BMCs with a settings object take changes there and leave the BIOS
+	// resource as what is running
+	target := bios.ODataID
+
+	if bios.Settings.SettingsObject.ODataID != "" {
+		target = bios.Settings.SettingsObject.ODataID
+	}
+
+	body := map[string]interface{}{"Attributes": attributes}
+	onReset := slices.Contains(bios.Settings.SupportedApplyTimes, "OnReset")
+
+	if onReset {
+		body["@Redfish.SettingsApplyTime"] = map[string]string{"ApplyTime": "OnReset"}
+	}
+
+	if err := c.Patch(target, body); err != nil {
+		return err
+	}
+
+	if onReset {
+		return nil
+	}
+
+	manager, err := c.Manager()
+
+	if err != nil {
+		return err
+	}
+
+	if jobs := c.Driver.BIOSJobs(manager); jobs != "" {
+		return c.Post(jobs, map[string]string{"TargetSettingsURI": target}, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package redfish
+
+import (
+	"errors"
+	"slices"
+)
+
+const (
+	BootTargetCd  = "Cd"
+	BootTargetPxe = "Pxe"
+	BootTargetHdd = "Hdd"
+)
+
+var ErrBootTargetUnsupported = errors.New("bmc does not support booting from this device")
+
+type Boot struct {
+	BootSourceOverrideTarget  string   `json:"BootSourceOverrideTarget"`
+	BootSourceOverrideEnabled string   `json:"BootSourceOverrideEnabled"`
+	AllowableTargets          []string `json:"BootSourceOverrideTarget@Redfish.AllowableValues"`
+}
+
+// BootOnce boots the system from target the next time it starts, after which
+// it goes back to its usual boot order
+func (c *Client) BootOnce(target string) error {
+	system, err := c.System()
+
+	if err != nil {
+		return err
+	}
+
+	allowed := system.Boot.AllowableTargets
+
+	if len(allowed) > 0 && !slices.Contains(allowed, target) {
+		return ErrBootTargetUnsupported
+	}
+
+	return c.Patch(system.ODataID, map[string]interface{}{
+		"Boot": map[string]string{
+			"BootSourceOverrideTarget":  target,
+			"BootSourceOverrideEnabled": "Once",
+		},
+	})
+}
@@ -0,0 +1,262 @@
+package redfish
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const ServiceRootPath = "/redfish/v1"
+
+var (
+	ErrUnreachable  = errors.New("bmc unreachable")
+	ErrUnauthorized = errors.New("bmc rejected credentials")
+	ErrNotFound     = errors.New("redfish resource not found")
+	ErrNoSystem     = errors.New("bmc reports no computer systems")
+)
+
+type Client struct {
+	Address  string
+	Username string
+	Password string
+	Driver   Driver
+
+	// How the BMC's certificate is checked, see verifyConnection
+	PinnedFingerprint string
+	TrustedCAs        *x509.CertPool
+
+	// Called whenever a request fails because the certificate was refused
+	OnCertificateError func(err *CertificateError)
+
+	http        *http.Client
+	mu          sync.Mutex
+	fingerprint string
+}
+
+// How long a client keeps a connection to its BMC open between requests.
+// Clients are made for a poll or an action and then dropped, and their idle
+// connections would otherwise stay open for good.
+var idleConnTimeout = 30 * time.Second
+
+func NewClient(address, username, password string) *Client {
+	c := &Client{
+		Address:  address,
+		Username: username,
+		Password: password,
+		Driver:   Generic,
+	}
+
+	c.http = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			IdleConnTimeout: idleConnTimeout,
+
+			// BMCs ship with self-signed certificates, so they are pinned
+			// instead of verified the usual way
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				VerifyConnection:   c.verifyConnection,
+			},
+		},
+	}
+
+	return c
+}
+
+func (c *Client) url(path string) string {
+	return "https://" + c.Address + path
+}
+
+func (c *Client) do(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+
+	if body != nil {
+		data, err := json.Marshal(body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.url(path), reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Probes have no credentials, and some BMCs refuse an empty login even
+	// for the service root
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+
+	if err != nil {
+		var certErr *CertificateError
+
+		if errors.As(err, &certErr) {
+			if c.OnCertificateError != nil {
+				c.OnCertificateError(certErr)
+			}
+
+			return nil, certErr
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, err.Error())
+	}
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		res.Body.Close()
+		return nil, ErrUnauthorized
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	case res.StatusCode >= 400:
+		defer res.Body.Close()
+		return nil, fmt.Errorf("%s %s returned %s%s", method, path, res.Status, errorMessage(res.Body))
+	}
+
+	return res, nil
+}
+
+// Get fetches the resource at path (an @odata.id) and decodes it into v
+func (c *Client) Get(path string, v interface{}) error {
+	res, err := c.do("GET", path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Post sends body to path, usually an action target, and decodes any
+// response into v if it isn't nil
+func (c *Client) Post(path string, body, v interface{}) error {
+	res, err := c.do("POST", path, body)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if v == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Patch updates the resource at path with the properties in body
+func (c *Client) Patch(path string, body interface{}) error {
+	res, err := c.do("PATCH", path, body)
+
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	return nil
+}
+
+// Members fetches every member of the collection at path
+func (c *Client) Members(path string, each func(path string) error) error {
+	var collection Collection
+
+	if err := c.Get(path, &collection); err != nil {
+		return err
+	}
+
+	for _, member := range collection.Members {
+		if err := each(member.ODataID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) ServiceRoot() (*ServiceRoot, error) {
+	var root ServiceRoot
+
+	if err := c.Get(ServiceRootPath, &root); err != nil {
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// System returns the first computer system exposed by the BMC. Every
+// supported BMC manages exactly one system.
+func (c *Client) System() (*ComputerSystem, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var collection Collection
+
+	if err := c.Get(root.Systems.ODataID, &collection); err != nil {
+		return nil, err
+	}
+
+	if len(collection.Members) == 0 {
+		return nil, ErrNoSystem
+	}
+
+	var system ComputerSystem
+
+	if err := c.Get(collection.Members[0].ODataID, &system); err != nil {
+		return nil, err
+	}
+
+	system.ODataID = collection.Members[0].ODataID
+
+	return &system, nil
+}
+
+// errorMessage pulls the human readable part out of a Redfish error response
+func errorMessage(body io.Reader) string {
+	var obj struct {
+		Error struct {
+			Message      string `json:"message"`
+			ExtendedInfo []struct {
+				Message string `json:"Message"`
+			} `json:"@Message.ExtendedInfo"`
+		} `json:"error"`
+	}
+
+	if err := json.NewDecoder(body).Decode(&obj); err != nil {
+		return ""
+	}
+
+	if len(obj.Error.ExtendedInfo) > 0 && obj.Error.ExtendedInfo[0].Message != "" {
+		return ": " + obj.Error.ExtendedInfo[0].Message
+	}
+
+	if obj.Error.Message != "" {
+		return ": " + obj.Error.Message
+	}
+
+	return ""
+}
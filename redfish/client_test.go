@@ -0,0 +1,43 @@
+package redfish
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// A dropped client doesn't hold its connection to the BMC open
+func TestClientIdleConnections(t *testing.T) {
+	defer func(timeout time.Duration) { idleConnTimeout = timeout }(idleConnTimeout)
+	idleConnTimeout = 50 * time.Millisecond
+
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"RedfishVersion": "1.6.0"}`))
+	}))
+
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := NewClient(strings.TrimPrefix(server.URL, "https://"), "", "")
+
+	if _, err := client.ServiceRoot(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("idle connection was kept open")
+	}
+}
@@ -0,0 +1,168 @@
+package redfish
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrConsoleUnsupported = errors.New("bmc does not offer a serial console over ssh")
+
+const defaultSSHPort = 22
+
+type ManagerNetworkProtocol struct {
+	SSH struct {
+		ProtocolEnabled *bool `json:"ProtocolEnabled"`
+		Port            int   `json:"Port"`
+	} `json:"SSH"`
+}
+
+// Console is an SSH session attached to the host's serial console. Reads
+// are what the host prints, writes are typed into it.
+type Console struct {
+	client  *ssh.Client
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+}
+
+func (c *Console) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *Console) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *Console) Close() error {
+	c.session.Close()
+	return c.client.Close()
+}
+
+// consoleAddress is where the BMC's SSH server listens, on the same address
+// as Redfish
+func (c *Client) consoleAddress() (string, error) {
+	manager, err := c.Manager()
+
+	if err != nil {
+		return "", err
+	}
+
+	console := manager.SerialConsole
+
+	if !console.ServiceEnabled || !slices.Contains(console.ConnectTypesSupported, "SSH") {
+		return "", ErrConsoleUnsupported
+	}
+
+	port := defaultSSHPort
+
+	if manager.NetworkProtocol.ODataID != "" {
+		var protocol ManagerNetworkProtocol
+
+		if err := c.Get(manager.NetworkProtocol.ODataID, &protocol); err != nil {
+			return "", err
+		}
+
+		if protocol.SSH.ProtocolEnabled != nil && !*protocol.SSH.ProtocolEnabled {
+			return "", ErrConsoleUnsupported
+		}
+
+		if protocol.SSH.Port != 0 {
+			port = protocol.SSH.Port
+		}
+	}
+
+	host := c.Address
+
+	if h, _, err := net.SplitHostPort(c.Address); err == nil {
+		host = h
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+// OpenConsole logs in to the BMC over SSH with the client's credentials and
+// attaches to the host's serial console. hostKey checks the BMC's SSH host
+// key, since like its certificate it can't be verified any other way.
+func (c *Client) OpenConsole(hostKey ssh.HostKeyCallback) (*Console, error) {
+	if c.Driver.ConsoleCommand() == "" {
+		return nil, ErrConsoleUnsupported
+	}
+
+	address, err := c.consoleAddress()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Some BMCs only take passwords through keyboard-interactive
+	password := c.Password
+	config := &ssh.ClientConfig{
+		User: c.Username,
+		Auth: []ssh.AuthMethod{
+			ssh.Password(password),
+			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+
+				for i := range answers {
+					answers[i] = password
+				}
+
+				return answers, nil
+			}),
+		},
+		HostKeyCallback: hostKey,
+		Timeout:         30 * time.Second,
+	}
+
+	client, err := ssh.Dial("tcp", address, config)
+
+	if err != nil {
+		// Errors from hostKey are kept so callers can tell them apart
+		return nil, fmt.Errorf("%w: %w", ErrUnreachable, err)
+	}
+
+	console, err := c.attachConsole(client)
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return console, nil
+}
+
+func (c *Client) attachConsole(client *ssh.Client) (*Console, error) {
+	session, err := client.NewSession()
+
+	if err != nil {
+		return nil, err
+	}
+
+	console := &Console{client: client, session: session}
+
+	if console.stdin, err = session.StdinPipe(); err != nil {
+		return nil, err
+	}
+
+	if console.stdout, err = session.StdoutPipe(); err != nil {
+		return nil, err
+	}
+
+	// Serial consoles are plain text, so the terminal type hardly matters
+	if err := session.RequestPty("vt100", 24, 80, ssh.TerminalModes{ssh.ECHO: 0}); err != nil {
+		return nil, err
+	}
+
+	if err := session.Start(c.Driver.ConsoleCommand()); err != nil {
+		return nil, err
+	}
+
+	return console, nil
+}
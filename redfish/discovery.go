@@ -0,0 +1,40 @@
+package redfish
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrNotRedfish = errors.New("not a redfish service")
+
+// Probe fetches the service root of whatever listens at address, which
+// Redfish serves without a login, and the fingerprint of its certificate. It
+// gives up after timeout, since most addresses in a scan have nothing
+// listening.
+func Probe(address string, timeout time.Duration) (*ServiceRoot, string, error) {
+	client := NewClient(address, "", "")
+	client.http.Timeout = timeout
+
+	root, err := client.ServiceRoot()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if root.RedfishVersion == "" {
+		return nil, "", ErrNotRedfish
+	}
+
+	return root, client.CertificateFingerprint(), nil
+}
+
+// MatchDriver picks the driver for a BMC from its service root alone
+func MatchDriver(root *ServiceRoot) Driver {
+	for _, driver := range Drivers {
+		if driver.Match(root) {
+			return driver
+		}
+	}
+
+	return Generic
+}
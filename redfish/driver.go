@@ -0,0 +1,341 @@
+package redfish
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Driver covers the differences between BMC vendors. Everything that is
+// plain DMTF Redfish lives on the Client; drivers only step in where a
+// vendor does things their own way.
+type Driver interface {
+	Name() string
+
+	// Match reports whether the driver is meant for the BMC with this
+	// service root
+	Match(root *ServiceRoot) bool
+
+	// Product names the kind of BMC for display, e.g. "iDRAC 9"
+	Product(info *BMCInfo) string
+
+	// EventLog reports whether a log service holds hardware events, such as
+	// the SEL, as opposed to audit or debug logs
+	EventLog(service *LogService) bool
+
+	// ConsoleCommand is run over SSH to attach to the host's serial
+	// console. Empty means the BMC's console isn't known, and none is opened,
+	// since a shell on the BMC would hand its admin login to the user.
+	ConsoleCommand() string
+
+	// InstalledFirmware reports whether a firmware inventory entry is what
+	// is running, as opposed to a previous or available version
+	InstalledFirmware(item *SoftwareInventory) bool
+
+	// BIOSJobs is the collection a job has to be created in for pending
+	// BIOS settings to be applied on the next reset. Empty means the BMC
+	// applies them by itself.
+	BIOSJobs(manager *Manager) string
+}
+
+var (
+	DellIDRAC  Driver = &dellDriver{}
+	HPEiLO     Driver = &hpeDriver{}
+	Supermicro Driver = &supermicroDriver{}
+	LenovoXCC  Driver = &lenovoDriver{}
+	Generic    Driver = &genericDriver{}
+)
+
+// Drivers in the order they are tried during detection. Generic matches
+// anything, so it has to come last.
+var Drivers = []Driver{DellIDRAC, HPEiLO, Supermicro, LenovoXCC, Generic}
+
+func DriverByName(name string) Driver {
+	for _, driver := range Drivers {
+		if driver.Name() == name {
+			return driver
+		}
+	}
+
+	return nil
+}
+
+// BMCInfo is what detection learns about a BMC and the system it manages
+type BMCInfo struct {
+	Driver          string
+	Vendor          string
+	Model           string
+	FirmwareVersion string
+	RedfishVersion  string
+	SystemModel     string
+	SerialNumber    string
+
+	// Of the certificate the BMC presented during detection
+	CertificateFingerprint string
+}
+
+// Detect picks the driver for the BMC from its service root and describes
+// it from its manager and system resources
+func (c *Client) Detect() (Driver, *BMCInfo, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	driver := MatchDriver(root)
+
+	info := &BMCInfo{
+		Driver:         driver.Name(),
+		Vendor:         root.Vendor,
+		RedfishVersion: root.RedfishVersion,
+	}
+
+	if manager, err := c.Manager(); err == nil {
+		info.Model = manager.Model
+		info.FirmwareVersion = manager.FirmwareVersion
+	} else {
+		return nil, nil, err
+	}
+
+	if system, err := c.System(); err == nil {
+		info.SystemModel = system.Model
+		info.SerialNumber = system.SerialNumber
+
+		if info.Vendor == "" {
+			info.Vendor = system.Manufacturer
+		}
+	} else {
+		return nil, nil, err
+	}
+
+	info.CertificateFingerprint = c.CertificateFingerprint()
+	return driver, info, nil
+}
+
+// Manager returns the BMC's own manager resource
+func (c *Client) Manager() (*Manager, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var manager *Manager
+
+	err = c.Members(root.Managers.ODataID, func(path string) error {
+		var m Manager
+
+		if manager != nil {
+			return nil
+		}
+
+		if err := c.Get(path, &m); err != nil {
+			return err
+		}
+
+		m.ODataID = path
+
+		if m.ManagerType == "" || m.ManagerType == "BMC" {
+			manager = &m
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if manager == nil {
+		return nil, ErrNotFound
+	}
+
+	return manager, nil
+}
+
+// vendorMatch checks the Vendor property, which only newer firmware sets,
+// and falls back to the Oem section every vendor fills in
+func vendorMatch(root *ServiceRoot, vendors ...string) bool {
+	for _, vendor := range vendors {
+		if strings.EqualFold(root.Vendor, vendor) {
+			return true
+		}
+
+		if _, ok := root.Oem[vendor]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type genericDriver struct{}
+
+func (d *genericDriver) Name() string {
+	return "generic"
+}
+
+func (d *genericDriver) Match(root *ServiceRoot) bool {
+	return true
+}
+
+func (d *genericDriver) Product(info *BMCInfo) string {
+	return strings.TrimSpace(info.Vendor + " " + info.Model)
+}
+
+func (d *genericDriver) ConsoleCommand() string {
+	return ""
+}
+
+func (d *genericDriver) InstalledFirmware(item *SoftwareInventory) bool {
+	return true
+}
+
+func (d *genericDriver) BIOSJobs(manager *Manager) string {
+	return ""
+}
+
+func (d *genericDriver) EventLog(service *LogService) bool {
+	return service.LogEntryType == "SEL" || logServiceIs(service, "SEL", "EventLog", "Log1")
+}
+
+func logServiceIs(service *LogService, ids ...string) bool {
+	for _, id := range ids {
+		if strings.EqualFold(service.ID, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type dellDriver struct {
+	genericDriver
+}
+
+func (d *dellDriver) Name() string {
+	return "dell-idrac"
+}
+
+func (d *dellDriver) Match(root *ServiceRoot) bool {
+	return vendorMatch(root, "Dell")
+}
+
+// DellGeneration tells iDRAC 7, 8 and 9 apart. The manager model is the
+// server generation (12G, 13G, 14G and up) and each generation shipped with
+// exactly one iDRAC.
+func DellGeneration(info *BMCInfo) int {
+	switch {
+	case strings.HasPrefix(info.Model, "12G"):
+		return 7
+	case strings.HasPrefix(info.Model, "13G"):
+		return 8
+	default:
+		return 9
+	}
+}
+
+func (d *dellDriver) Product(info *BMCInfo) string {
+	return fmt.Sprintf("iDRAC %d", DellGeneration(info))
+}
+
+// The Lifecycle log has firmware, configuration and part replacement events
+// the SEL doesn't
+func (d *dellDriver) EventLog(service *LogService) bool {
+	return logServiceIs(service, "Sel", "Lclog")
+}
+
+// COM2 is the port iDRAC redirects serial output to
+func (d *dellDriver) ConsoleCommand() string {
+	return "console com2"
+}
+
+// iDRAC lists the firmware it keeps for rollback and the updates it has
+// staged next to what is installed, telling them apart by ID
+func (d *dellDriver) InstalledFirmware(item *SoftwareInventory) bool {
+	return strings.HasPrefix(item.ID, "Installed-")
+}
+
+// iDRAC only applies pending BIOS settings through a configuration job, which
+// newer firmware creates by itself when given an apply time
+func (d *dellDriver) BIOSJobs(manager *Manager) string {
+	return manager.ODataID + "/Jobs"
+}
+
+type hpeDriver struct {
+	genericDriver
+}
+
+func (d *hpeDriver) Name() string {
+	return "hpe-ilo"
+}
+
+func (d *hpeDriver) Match(root *ServiceRoot) bool {
+	return vendorMatch(root, "HPE", "Hpe", "Hp")
+}
+
+// iLO reports its generation in the firmware version, e.g. "iLO 5 v2.72"
+func (d *hpeDriver) Product(info *BMCInfo) string {
+	if strings.HasPrefix(info.FirmwareVersion, "iLO") {
+		if fields := strings.Fields(info.FirmwareVersion); len(fields) >= 2 {
+			return fields[0] + " " + fields[1]
+		}
+	}
+
+	return "iLO"
+}
+
+// The Integrated Management Log is the system's, the iLO Event Log is iLO's
+func (d *hpeDriver) EventLog(service *LogService) bool {
+	return logServiceIs(service, "IML", "IEL")
+}
+
+// The iLO virtual serial port
+func (d *hpeDriver) ConsoleCommand() string {
+	return "vsp"
+}
+
+type supermicroDriver struct {
+	genericDriver
+}
+
+func (d *supermicroDriver) Name() string {
+	return "supermicro"
+}
+
+func (d *supermicroDriver) Match(root *ServiceRoot) bool {
+	return vendorMatch(root, "Supermicro")
+}
+
+func (d *supermicroDriver) Product(info *BMCInfo) string {
+	return "Supermicro BMC"
+}
+
+// Supermicro's SSH is a SMASH-CLP shell
+func (d *supermicroDriver) ConsoleCommand() string {
+	return "start /system1/sol1"
+}
+
+type lenovoDriver struct {
+	genericDriver
+}
+
+func (d *lenovoDriver) Name() string {
+	return "lenovo-xcc"
+}
+
+func (d *lenovoDriver) Match(root *ServiceRoot) bool {
+	return vendorMatch(root, "Lenovo")
+}
+
+func (d *lenovoDriver) Product(info *BMCInfo) string {
+	return "XClarity Controller"
+}
+
+func (d *lenovoDriver) EventLog(service *LogService) bool {
+	return logServiceIs(service, "PlatformLog", "EventLog")
+}
+
+func (d *lenovoDriver) ConsoleCommand() string {
+	return "console 1"
+}
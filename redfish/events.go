@@ -0,0 +1,175 @@
+package redfish
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+)
+
+var ErrEventServiceUnsupported = errors.New("bmc does not support event subscriptions")
+
+// The event types subscribed to, when the BMC still wants them listed.
+// Redfish 2020.3 replaced them with registry prefixes and subscribing to
+// everything.
+var subscribedEventTypes = []string{"Alert", "StatusChange"}
+
+type EventService struct {
+	ServiceEnabled            *bool    `json:"ServiceEnabled"`
+	Subscriptions             Link     `json:"Subscriptions"`
+	EventTypesForSubscription []string `json:"EventTypesForSubscription"`
+}
+
+type EventDestination struct {
+	ODataID     string `json:"@odata.id"`
+	ID          string `json:"Id"`
+	Destination string `json:"Destination"`
+	Context     string `json:"Context"`
+}
+
+// Event is what BMCs POST to a subscription's destination
+type Event struct {
+	Context string        `json:"Context"`
+	Events  []EventRecord `json:"Events"`
+}
+
+type EventRecord struct {
+	EventType         string `json:"EventType"`
+	EventID           string `json:"EventId"`
+	EventTimestamp    string `json:"EventTimestamp"`
+	Severity          string `json:"Severity"`
+	MessageSeverity   string `json:"MessageSeverity"`
+	Message           string `json:"Message"`
+	MessageID         string `json:"MessageId"`
+	OriginOfCondition Link   `json:"OriginOfCondition"`
+}
+
+// Health is the severity of the event. Severity was deprecated in favour of
+// MessageSeverity, but older BMCs only send the former.
+func (e *EventRecord) Health() string {
+	if e.MessageSeverity != "" {
+		return e.MessageSeverity
+	}
+
+	return e.Severity
+}
+
+func (c *Client) eventService() (*EventService, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if root.EventService.ODataID == "" {
+		return nil, ErrEventServiceUnsupported
+	}
+
+	var service EventService
+
+	if err := c.Get(root.EventService.ODataID, &service); err != nil {
+		return nil, err
+	}
+
+	if service.ServiceEnabled != nil && !*service.ServiceEnabled || service.Subscriptions.ODataID == "" {
+		return nil, ErrEventServiceUnsupported
+	}
+
+	return &service, nil
+}
+
+// Subscribe has the BMC POST its events to destination and returns the path
+// of the subscription. Earlier subscriptions with the same context are
+// removed first, since BMCs only allow a few.
+func (c *Client) Subscribe(destination, context string) (string, error) {
+	service, err := c.eventService()
+
+	if err != nil {
+		return "", err
+	}
+
+	err = c.Members(service.Subscriptions.ODataID, func(path string) error {
+		var subscription EventDestination
+
+		if err := c.Get(path, &subscription); err != nil {
+			return err
+		}
+
+		if subscription.Context == context {
+			return c.Unsubscribe(path)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	body := map[string]interface{}{
+		"Destination": destination,
+		"Protocol":    "Redfish",
+		"Context":     context,
+	}
+
+	if len(service.EventTypesForSubscription) > 0 {
+		types := []string{}
+
+		for _, eventType := range subscribedEventTypes {
+			if slices.Contains(service.EventTypesForSubscription, eventType) {
+				types = append(types, eventType)
+			}
+		}
+
+		body["EventTypes"] = types
+	}
+
+	res, err := c.do("POST", service.Subscriptions.ODataID, body)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	// The new subscription is in the Location header, or failing that, the
+	// body
+	if location, err := url.Parse(res.Header.Get("Location")); err == nil && location.Path != "" {
+		return location.Path, nil
+	}
+
+	var subscription EventDestination
+
+	if err := json.NewDecoder(res.Body).Decode(&subscription); err != nil || subscription.ODataID == "" {
+		return "", errors.New("bmc did not say where the subscription was created")
+	}
+
+	return subscription.ODataID, nil
+}
+
+// SubscriptionExists checks that the BMC hasn't dropped a subscription, which
+// some do when they are reset
+func (c *Client) SubscriptionExists(path string) (bool, error) {
+	var subscription EventDestination
+
+	if err := c.Get(path, &subscription); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *Client) Unsubscribe(path string) error {
+	res, err := c.do("DELETE", path, nil)
+
+	if err != nil {
+		return err
+	}
+
+	res.Body.Close()
+	return nil
+}
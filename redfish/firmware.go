@@ -0,0 +1,164 @@
+package redfish
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var ErrUpdateUnsupported = errors.New("bmc does not support simple updates")
+
+// Kinds of firmware that minimum versions can be set for
+const (
+	FirmwareBIOS  = "bios"
+	FirmwareBMC   = "bmc"
+	FirmwareNIC   = "nic"
+	FirmwareRAID  = "raid"
+	FirmwareOther = "other"
+)
+
+var FirmwareCategories = []string{FirmwareBIOS, FirmwareBMC, FirmwareNIC, FirmwareRAID}
+
+type UpdateService struct {
+	ServiceEnabled    *bool `json:"ServiceEnabled"`
+	FirmwareInventory Link  `json:"FirmwareInventory"`
+	Actions           struct {
+		SimpleUpdate struct {
+			Target            string   `json:"target"`
+			TransferProtocols []string `json:"TransferProtocol@Redfish.AllowableValues"`
+		} `json:"#UpdateService.SimpleUpdate"`
+	} `json:"Actions"`
+}
+
+type SoftwareInventory struct {
+	ODataID      string `json:"@odata.id"`
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	Version      string `json:"Version"`
+	Manufacturer string `json:"Manufacturer"`
+	SoftwareID   string `json:"SoftwareId"`
+	Updateable   bool   `json:"Updateable"`
+	Status       Status `json:"Status"`
+}
+
+type Firmware struct {
+	SoftwareInventory
+
+	// One of the Firmware constants
+	Category string
+}
+
+// Words in a component's name that give away what kind of firmware it is.
+// BMCs are checked first, since some call themselves network controllers.
+var firmwareKeywords = []struct {
+	category string
+	words    []string
+}{
+	{FirmwareBMC, []string{"bmc", "idrac", "ilo", "xcc", "remote access controller", "management controller"}},
+	{FirmwareBIOS, []string{"bios", "uefi", "system rom"}},
+	{FirmwareRAID, []string{"raid", "perc", "megaraid", "smart array", "hba"}},
+	{FirmwareNIC, []string{"nic", "ethernet", "network", "connectx", "lom"}},
+}
+
+// FirmwareCategory guesses what kind of firmware a component is from its
+// name. There's no standard property for it.
+func FirmwareCategory(item *SoftwareInventory) string {
+	name := " " + strings.Join(strings.FieldsFunc(strings.ToLower(item.Name+" "+item.ID), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+
+	for _, kind := range firmwareKeywords {
+		for _, word := range kind.words {
+			if strings.Contains(name, " "+word+" ") {
+				return kind.category
+			}
+		}
+	}
+
+	return FirmwareOther
+}
+
+func (c *Client) updateService() (*UpdateService, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if root.UpdateService.ODataID == "" {
+		return nil, nil
+	}
+
+	var service UpdateService
+
+	if err := c.Get(root.UpdateService.ODataID, &service); err != nil {
+		return nil, err
+	}
+
+	return &service, nil
+}
+
+// SimpleUpdate has the BMC download the firmware image at imageURI and
+// install it, which it does as a task. The returned path is where the task
+// can be followed, empty when the BMC doesn't make one.
+func (c *Client) SimpleUpdate(imageURI string) (string, error) {
+	service, err := c.updateService()
+
+	if err != nil {
+		return "", err
+	}
+
+	if service == nil || service.ServiceEnabled != nil && !*service.ServiceEnabled || service.Actions.SimpleUpdate.Target == "" {
+		return "", ErrUpdateUnsupported
+	}
+
+	action := service.Actions.SimpleUpdate
+	body := map[string]interface{}{"ImageURI": imageURI}
+
+	// Older BMCs want the protocol spelled out even though it is in the URI
+	if u, err := url.Parse(imageURI); err == nil && slices.Contains(action.TransferProtocols, strings.ToUpper(u.Scheme)) {
+		body["TransferProtocol"] = strings.ToUpper(u.Scheme)
+	}
+
+	return c.startTask(action.Target, body)
+}
+
+// FirmwareInventory lists the firmware installed on the host and its BMC.
+// BMCs without an update service have none to list.
+func (c *Client) FirmwareInventory() ([]Firmware, error) {
+	service, err := c.updateService()
+
+	if err != nil {
+		return nil, err
+	}
+
+	firmware := []Firmware{}
+
+	if service == nil || service.FirmwareInventory.ODataID == "" {
+		return firmware, nil
+	}
+
+	err = c.Members(service.FirmwareInventory.ODataID, func(path string) error {
+		var item SoftwareInventory
+
+		if err := c.Get(path, &item); err != nil {
+			return err
+		}
+
+		if item.Status.Absent() || !c.Driver.InstalledFirmware(&item) {
+			return nil
+		}
+
+		item.ODataID = path
+		firmware = append(firmware, Firmware{item, FirmwareCategory(&item)})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return firmware, nil
+}
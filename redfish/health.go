@@ -0,0 +1,164 @@
+package redfish
+
+import (
+	"fmt"
+	"strings"
+)
+
+type ComponentHealth struct {
+	Component string
+	Health    string
+	Message   string
+}
+
+type HealthReport struct {
+	// Health of the system itself and the worst health of everything in it
+	Health       string
+	HealthRollup string
+
+	// Every subcomponent that does not report OK
+	Components []ComponentHealth
+}
+
+// Health reads the status of the system and each of its processors, DIMMs,
+// storage controllers, drives, volumes and network interfaces
+func (c *Client) Health() (*HealthReport, error) {
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HealthReport{
+		Health:       system.Status.Health,
+		HealthRollup: system.Status.HealthRollup,
+	}
+
+	report.add("System", system.Name, system.Status)
+
+	if system.Processors.ODataID != "" {
+		err := c.Members(system.Processors.ODataID, func(path string) error {
+			var cpu Processor
+
+			if err := c.Get(path, &cpu); err != nil {
+				return err
+			}
+
+			report.add("Processor "+cpu.ID, cpu.Name, cpu.Status)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if system.Memory.ODataID != "" {
+		err := c.Members(system.Memory.ODataID, func(path string) error {
+			var dimm Memory
+
+			if err := c.Get(path, &dimm); err != nil {
+				return err
+			}
+
+			report.add("Memory "+dimm.ID, dimm.Name, dimm.Status)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if system.Storage.ODataID != "" {
+		if err := c.storageHealth(system.Storage.ODataID, report); err != nil {
+			return nil, err
+		}
+	}
+
+	if system.EthernetInterfaces.ODataID != "" {
+		err := c.Members(system.EthernetInterfaces.ODataID, func(path string) error {
+			var nic EthernetInterface
+
+			if err := c.Get(path, &nic); err != nil {
+				return err
+			}
+
+			report.add("Network "+nic.ID, nic.Description, nic.Status)
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+func (c *Client) storageHealth(path string, report *HealthReport) error {
+	return c.Members(path, func(path string) error {
+		var storage Storage
+
+		if err := c.Get(path, &storage); err != nil {
+			return err
+		}
+
+		for _, controller := range storage.StorageControllers {
+			report.add("Storage "+controller.MemberID, controller.Name, controller.Status)
+		}
+
+		for _, link := range storage.Drives {
+			var drive Drive
+
+			if err := c.Get(link.ODataID, &drive); err != nil {
+				return err
+			}
+
+			report.add("Drive "+drive.ID, drive.Name, drive.Status)
+		}
+
+		if storage.Volumes.ODataID == "" {
+			return nil
+		}
+
+		return c.Members(storage.Volumes.ODataID, func(path string) error {
+			var volume Volume
+
+			if err := c.Get(path, &volume); err != nil {
+				return err
+			}
+
+			report.add("Volume "+volume.ID, volume.Name, volume.Status)
+			return nil
+		})
+	})
+}
+
+func (r *HealthReport) add(component, name string, status Status) {
+	if status.Health == "" || status.Health == HealthOK || status.Absent() {
+		return
+	}
+
+	messages := []string{}
+
+	for _, condition := range status.Conditions {
+		if condition.Message != "" {
+			messages = append(messages, condition.Message)
+		}
+	}
+
+	if len(messages) == 0 {
+		if name == "" {
+			name = component
+		}
+
+		messages = append(messages, fmt.Sprintf("%s reports %s health", name, status.Health))
+	}
+
+	r.Components = append(r.Components, ComponentHealth{
+		Component: component,
+		Health:    status.Health,
+		Message:   strings.Join(messages, "; "),
+	})
+}
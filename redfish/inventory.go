@@ -0,0 +1,253 @@
+package redfish
+
+const bytesPerMiB = 1024 * 1024
+
+type Inventory struct {
+	CPUCount              int
+	CPUSpeedMHz           int
+	CPUCores              int
+	MemoryTotalMiB        int
+	MemorySpeedMHz        int
+	VirtualStorageSizeMiB int
+	NetworkingProvider    string
+	NetworkingSpeedMbps   int
+
+	System      *ComputerSystem
+	Interfaces  []EthernetInterface
+	Ports       []NICPort
+	Controllers []StorageController
+	Drives      []Drive
+	Volumes     []Volume
+
+	// Network adapters that couldn't be read, whose ports are missing
+	PortErrors []error
+}
+
+// Inventory walks the system's processors, memory, storage, network
+// interfaces and network ports and summarizes them
+func (c *Client) Inventory() (*Inventory, error) {
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{System: system}
+
+	if err := c.inventoryProcessors(inv); err != nil {
+		return nil, err
+	}
+
+	if err := c.inventoryMemory(inv); err != nil {
+		return nil, err
+	}
+
+	if err := c.inventoryStorage(inv); err != nil {
+		return nil, err
+	}
+
+	if err := c.inventoryNetworking(inv); err != nil {
+		return nil, err
+	}
+
+	if err := c.inventoryPorts(inv); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+func (c *Client) inventoryProcessors(inv *Inventory) error {
+	if inv.System.Processors.ODataID == "" {
+		return nil
+	}
+
+	return c.Members(inv.System.Processors.ODataID, func(path string) error {
+		var cpu Processor
+
+		if err := c.Get(path, &cpu); err != nil {
+			return err
+		}
+
+		if cpu.Status.Absent() || (cpu.ProcessorType != "" && cpu.ProcessorType != "CPU") {
+			return nil
+		}
+
+		inv.CPUCount++
+		inv.CPUCores += cpu.TotalCores
+		inv.CPUSpeedMHz = max(inv.CPUSpeedMHz, cpu.MaxSpeedMHz)
+
+		return nil
+	})
+}
+
+func (c *Client) inventoryMemory(inv *Inventory) error {
+	if inv.System.Memory.ODataID == "" {
+		return nil
+	}
+
+	return c.Members(inv.System.Memory.ODataID, func(path string) error {
+		var dimm Memory
+
+		if err := c.Get(path, &dimm); err != nil {
+			return err
+		}
+
+		if dimm.Status.Absent() {
+			return nil
+		}
+
+		inv.MemoryTotalMiB += dimm.CapacityMiB
+		inv.MemorySpeedMHz = max(inv.MemorySpeedMHz, dimm.OperatingSpeedMhz)
+
+		return nil
+	})
+}
+
+// Virtual storage is the sum of the configured volumes. Controllers without
+// any volumes (HBAs, AHCI) pass their drives straight through, so the drives
+// are counted instead.
+func (c *Client) inventoryStorage(inv *Inventory) error {
+	if inv.System.Storage.ODataID == "" {
+		return c.inventorySimpleStorage(inv)
+	}
+
+	var total int64
+
+	err := c.Members(inv.System.Storage.ODataID, func(path string) error {
+		var storage Storage
+
+		if err := c.Get(path, &storage); err != nil {
+			return err
+		}
+
+		for _, controller := range storage.StorageControllers {
+			controller.Storage = storage.ID
+			inv.Controllers = append(inv.Controllers, controller)
+		}
+
+		var volumes, drives int64
+
+		if storage.Volumes.ODataID != "" {
+			err := c.Members(storage.Volumes.ODataID, func(path string) error {
+				var volume Volume
+
+				if err := c.Get(path, &volume); err != nil {
+					return err
+				}
+
+				volume.Storage = storage.ID
+				inv.Volumes = append(inv.Volumes, volume)
+
+				volumes += volume.CapacityBytes
+				return nil
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, link := range storage.Drives {
+			var drive Drive
+
+			if err := c.Get(link.ODataID, &drive); err != nil {
+				return err
+			}
+
+			if !drive.Status.Absent() {
+				drive.Storage = storage.ID
+				inv.Drives = append(inv.Drives, drive)
+
+				drives += drive.CapacityBytes
+			}
+		}
+
+		if volumes > 0 {
+			total += volumes
+		} else {
+			total += drives
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	inv.VirtualStorageSizeMiB = int(total / bytesPerMiB)
+	return nil
+}
+
+func (c *Client) inventorySimpleStorage(inv *Inventory) error {
+	if inv.System.SimpleStorage.ODataID == "" {
+		return nil
+	}
+
+	var total int64
+
+	err := c.Members(inv.System.SimpleStorage.ODataID, func(path string) error {
+		var storage SimpleStorage
+
+		if err := c.Get(path, &storage); err != nil {
+			return err
+		}
+
+		for _, device := range storage.Devices {
+			if !device.Status.Absent() {
+				total += device.CapacityBytes
+
+				// Devices don't have IDs, but their names are unique
+				inv.Drives = append(inv.Drives, Drive{
+					ID:            device.Name,
+					Name:          device.Name,
+					Manufacturer:  device.Manufacturer,
+					Model:         device.Model,
+					CapacityBytes: device.CapacityBytes,
+					Status:        device.Status,
+					Storage:       storage.ID,
+				})
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	inv.VirtualStorageSizeMiB = int(total / bytesPerMiB)
+	return nil
+}
+
+// The fastest connected interface is reported as the host's networking
+func (c *Client) inventoryNetworking(inv *Inventory) error {
+	if inv.System.EthernetInterfaces.ODataID == "" {
+		return nil
+	}
+
+	return c.Members(inv.System.EthernetInterfaces.ODataID, func(path string) error {
+		var nic EthernetInterface
+
+		if err := c.Get(path, &nic); err != nil {
+			return err
+		}
+
+		inv.Interfaces = append(inv.Interfaces, nic)
+
+		if nic.LinkStatus != "LinkUp" || nic.SpeedMbps <= inv.NetworkingSpeedMbps {
+			return nil
+		}
+
+		inv.NetworkingSpeedMbps = nic.SpeedMbps
+		inv.NetworkingProvider = nic.Description
+
+		if inv.NetworkingProvider == "" {
+			inv.NetworkingProvider = nic.Name
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,207 @@
+package redfish
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadFixture reads a recorded BMC from testdata, a JSON object of paths to
+// the resources the BMC returned for them
+func loadFixture(t *testing.T, fixture string) map[string]json.RawMessage {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", fixture+".json"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resources map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &resources); err != nil {
+		t.Fatal(err)
+	}
+
+	return resources
+}
+
+// fakeBMC serves a recorded BMC. Everything but the service root needs
+// root/calvin, like an iDRAC fresh from the factory.
+func fakeBMC(t *testing.T, fixture string) (*httptest.Server, *Client) {
+	t.Helper()
+	return serveFixture(t, loadFixture(t, fixture))
+}
+
+func serveFixture(t *testing.T, resources map[string]json.RawMessage) (*httptest.Server, *Client) {
+	t.Helper()
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+
+		if username, password, ok := r.BasicAuth(); path != ServiceRootPath && (!ok || username != "root" || password != "calvin") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		resource, ok := resources[path]
+
+		if !ok || r.Method != "GET" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(resource)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, NewClient(strings.TrimPrefix(server.URL, "https://"), "root", "calvin")
+}
+
+func TestInventory(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		cpus        int
+		cores       int
+		speed       int
+		memory      int
+		memorySpeed int
+		storage     int
+		drives      int
+		volumes     int
+		controllers int
+		provider    string
+		network     int
+		ports       []string
+	}{
+		// SimpleStorage is all there is, so the devices are the drives
+		{"idrac7", 2, 16, 3600, 65536, 1600, 1144651, 2, 0, 0, "Integrated NIC 1 Port 1 Partition 1", 1000, []string{"NIC.Integrated.1-1-1", "NIC.Integrated.1-2-1"}},
+
+		// An HBA has no volumes, so its drives are counted
+		{"idrac8", 2, 20, 4000, 131072, 2400, 915725, 2, 0, 1, "Integrated NIC 1 Port 1 Partition 1", 10000, []string{"NIC.Integrated.1-1-1", "NIC.Integrated.1-2-1", "NIC.Embedded.1-1-1"}},
+
+		// The RAID 1 volume is counted instead of both of its drives
+		{"idrac9", 2, 32, 4000, 262144, 2666, 1144064, 2, 1, 2, "Integrated NIC 1 Port 1 Partition 1", 25000, []string{"NIC.Integrated.1-1", "NIC.Integrated.1-2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			_, client := fakeBMC(t, test.fixture)
+			inv, err := client.Inventory()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if inv.CPUCount != test.cpus || inv.CPUCores != test.cores || inv.CPUSpeedMHz != test.speed {
+				t.Errorf("cpus = %d, %d cores at %d MHz, want %d, %d cores at %d MHz", inv.CPUCount, inv.CPUCores, inv.CPUSpeedMHz, test.cpus, test.cores, test.speed)
+			}
+
+			if inv.MemoryTotalMiB != test.memory || inv.MemorySpeedMHz != test.memorySpeed {
+				t.Errorf("memory = %d MiB at %d MHz, want %d MiB at %d MHz", inv.MemoryTotalMiB, inv.MemorySpeedMHz, test.memory, test.memorySpeed)
+			}
+
+			if inv.VirtualStorageSizeMiB != test.storage {
+				t.Errorf("storage = %d MiB, want %d MiB", inv.VirtualStorageSizeMiB, test.storage)
+			}
+
+			if len(inv.Drives) != test.drives || len(inv.Volumes) != test.volumes || len(inv.Controllers) != test.controllers {
+				t.Errorf("%d drives, %d volumes, %d controllers, want %d, %d, %d", len(inv.Drives), len(inv.Volumes), len(inv.Controllers), test.drives, test.volumes, test.controllers)
+			}
+
+			if inv.NetworkingProvider != test.provider || inv.NetworkingSpeedMbps != test.network {
+				t.Errorf("networking = %q at %d Mbps, want %q at %d Mbps", inv.NetworkingProvider, inv.NetworkingSpeedMbps, test.provider, test.network)
+			}
+
+			var ports []string
+
+			for _, port := range inv.Ports {
+				ports = append(ports, port.ID)
+			}
+
+			if strings.Join(ports, ",") != strings.Join(test.ports, ",") {
+				t.Errorf("ports = %v, want %v", ports, test.ports)
+			}
+
+			for _, drive := range inv.Drives {
+				if drive.Storage == "" {
+					t.Errorf("drive %s has no storage", drive.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestInventoryPredictedFailure(t *testing.T) {
+	_, client := fakeBMC(t, "idrac9")
+	inv, err := client.Inventory()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := 0
+
+	for _, drive := range inv.Drives {
+		if drive.FailurePredicted {
+			failing++
+		}
+	}
+
+	if failing != 1 {
+		t.Errorf("%d drives predicted to fail, want 1", failing)
+	}
+
+	port := inv.Ports[0]
+
+	if port.Adapter != "Mellanox Technologies ConnectX-4 Lx" || port.Slot != "Slot 1" || port.LinkStatus != "LinkUp" || port.MACAddress != "e4:43:4b:00:00:01" {
+		t.Errorf("port = %+v", port)
+	}
+}
+
+func TestInventoryUnauthorized(t *testing.T) {
+	_, client := fakeBMC(t, "idrac8")
+	client.Password = "wrong"
+
+	if _, err := client.Inventory(); err != ErrUnauthorized {
+		t.Errorf("err = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+// An adapter that can't be read leaves out its ports, not the inventory
+func TestInventoryAdapterError(t *testing.T) {
+	const adapters = "/redfish/v1/Chassis/System.Embedded.1/NetworkAdapters"
+
+	resources := loadFixture(t, "idrac9")
+	resources[adapters] = json.RawMessage(`{"Members": [{"@odata.id": "` + adapters + `/NIC.Integrated.1"}, {"@odata.id": "` + adapters + `/NIC.Slot.2"}]}`)
+
+	_, client := serveFixture(t, resources)
+	inv, err := client.Inventory()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inv.Ports) != 2 || len(inv.PortErrors) != 1 || !errors.Is(inv.PortErrors[0], ErrNotFound) {
+		t.Errorf("%d ports, errors %v", len(inv.Ports), inv.PortErrors)
+	}
+
+	// With every adapter failing, interfaces aren't passed off as ports
+	delete(resources, adapters+"/NIC.Integrated.1")
+	inv, err = client.Inventory()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inv.Ports) != 0 || len(inv.PortErrors) != 2 {
+		t.Errorf("ports = %+v, errors %v", inv.Ports, inv.PortErrors)
+	}
+}
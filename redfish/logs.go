@@ -0,0 +1,112 @@
+package redfish
+
+// Most BMCs keep thousands of entries, so a single read stops after this many
+// per log. Entries are generally listed newest first.
+const MaxLogEntries = 1000
+
+type LogService struct {
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	LogEntryType string `json:"LogEntryType"`
+	Entries      Link   `json:"Entries"`
+}
+
+type LogEntry struct {
+	ODataID    string `json:"@odata.id"`
+	ID         string `json:"Id"`
+	Name       string `json:"Name"`
+	Created    string `json:"Created"`
+	Severity   string `json:"Severity"`
+	Message    string `json:"Message"`
+	MessageID  string `json:"MessageId"`
+	EntryType  string `json:"EntryType"`
+	SensorType string `json:"SensorType"`
+}
+
+type logEntryCollection struct {
+	Members  []LogEntry `json:"Members"`
+	NextLink string     `json:"Members@odata.nextLink"`
+}
+
+// EventLogs lists the manager's and the system's log services that the
+// driver considers hardware event logs
+func (c *Client) EventLogs() ([]*LogService, error) {
+	paths := []string{}
+
+	manager, err := c.Manager()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if manager.LogServices.ODataID != "" {
+		paths = append(paths, manager.LogServices.ODataID)
+	}
+
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if system.LogServices.ODataID != "" {
+		paths = append(paths, system.LogServices.ODataID)
+	}
+
+	services := []*LogService{}
+
+	for _, path := range paths {
+		err := c.Members(path, func(path string) error {
+			var service LogService
+
+			if err := c.Get(path, &service); err != nil {
+				return err
+			}
+
+			if service.Entries.ODataID != "" && c.Driver.EventLog(&service) {
+				services = append(services, &service)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return services, nil
+}
+
+// LogEntries reads up to MaxLogEntries entries of a log service, following
+// pages. Entries that are only listed as links are fetched one by one.
+func (c *Client) LogEntries(service *LogService) ([]LogEntry, error) {
+	entries := []LogEntry{}
+	path := service.Entries.ODataID
+
+	for path != "" && len(entries) < MaxLogEntries {
+		var page logEntryCollection
+
+		if err := c.Get(path, &page); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range page.Members {
+			if entry.ID == "" && entry.ODataID != "" {
+				if err := c.Get(entry.ODataID, &entry); err != nil {
+					return nil, err
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+
+		path = page.NextLink
+	}
+
+	if len(entries) > MaxLogEntries {
+		entries = entries[:MaxLogEntries]
+	}
+
+	return entries, nil
+}
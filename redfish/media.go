@@ -0,0 +1,143 @@
+package redfish
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrNoVirtualMedia = errors.New("bmc has no virtual cd drive")
+
+type VirtualMedia struct {
+	ODataID        string   `json:"@odata.id"`
+	ID             string   `json:"Id"`
+	Name           string   `json:"Name"`
+	MediaTypes     []string `json:"MediaTypes"`
+	Image          string   `json:"Image"`
+	ImageName      string   `json:"ImageName"`
+	Inserted       bool     `json:"Inserted"`
+	WriteProtected bool     `json:"WriteProtected"`
+	ConnectedVia   string   `json:"ConnectedVia"`
+	Actions        struct {
+		InsertMedia struct {
+			Target string `json:"target"`
+		} `json:"#VirtualMedia.InsertMedia"`
+		EjectMedia struct {
+			Target string `json:"target"`
+		} `json:"#VirtualMedia.EjectMedia"`
+	} `json:"Actions"`
+}
+
+type MediaStatus struct {
+	Device   string `json:"device"`
+	Image    string `json:"image"`
+	Inserted bool   `json:"inserted"`
+}
+
+// VirtualCD finds the virtual drive that takes CD and DVD images. Older BMCs
+// list virtual media under the manager, newer ones under the system.
+func (c *Client) VirtualCD() (*VirtualMedia, error) {
+	paths := []string{}
+
+	if manager, err := c.Manager(); err == nil && manager.VirtualMedia.ODataID != "" {
+		paths = append(paths, manager.VirtualMedia.ODataID)
+	}
+
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if system.VirtualMedia.ODataID != "" {
+		paths = append(paths, system.VirtualMedia.ODataID)
+	}
+
+	var cd *VirtualMedia
+
+	for _, path := range paths {
+		err := c.Members(path, func(path string) error {
+			var media VirtualMedia
+
+			if cd != nil {
+				return nil
+			}
+
+			if err := c.Get(path, &media); err != nil {
+				return err
+			}
+
+			media.ODataID = path
+
+			if slices.Contains(media.MediaTypes, "CD") || slices.Contains(media.MediaTypes, "DVD") {
+				cd = &media
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if cd != nil {
+			return cd, nil
+		}
+	}
+
+	return nil, ErrNoVirtualMedia
+}
+
+func (c *Client) MediaStatus() (*MediaStatus, error) {
+	cd, err := c.VirtualCD()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &MediaStatus{Device: cd.ID, Image: cd.Image, Inserted: cd.Inserted}, nil
+}
+
+// InsertMedia mounts the image at url in the virtual CD drive, ejecting
+// whatever was in it. BMCs without the InsertMedia action take the image
+// as a property instead.
+func (c *Client) InsertMedia(url string) error {
+	cd, err := c.VirtualCD()
+
+	if err != nil {
+		return err
+	}
+
+	if cd.Inserted {
+		if err := c.ejectMedia(cd); err != nil {
+			return err
+		}
+	}
+
+	if cd.Actions.InsertMedia.Target == "" {
+		return c.Patch(cd.ODataID, map[string]interface{}{"Image": url, "Inserted": true, "WriteProtected": true})
+	}
+
+	return c.Post(cd.Actions.InsertMedia.Target, map[string]interface{}{"Image": url, "Inserted": true, "WriteProtected": true}, nil)
+}
+
+func (c *Client) EjectMedia() error {
+	cd, err := c.VirtualCD()
+
+	if err != nil {
+		return err
+	}
+
+	if !cd.Inserted {
+		return nil
+	}
+
+	return c.ejectMedia(cd)
+}
+
+func (c *Client) ejectMedia(cd *VirtualMedia) error {
+	if cd.Actions.EjectMedia.Target == "" {
+		return c.Patch(cd.ODataID, map[string]interface{}{"Image": nil, "Inserted": false})
+	}
+
+	return c.Post(cd.Actions.EjectMedia.Target, map[string]interface{}{}, nil)
+}
@@ -0,0 +1,236 @@
+package redfish
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NICPort is a physical network port, as opposed to an EthernetInterface,
+// which partitioned NICs have several of per port
+type NICPort struct {
+	ID         string
+	Adapter    string
+	Slot       string
+	MACAddress string
+	LinkStatus string
+	SpeedMbps  int
+}
+
+type Location struct {
+	PartLocation struct {
+		ServiceLabel         string `json:"ServiceLabel"`
+		LocationType         string `json:"LocationType"`
+		LocationOrdinalValue *int   `json:"LocationOrdinalValue"`
+	} `json:"PartLocation"`
+}
+
+// Slot describes where a part is plugged in, like "Slot 3", or "" if the BMC
+// doesn't say
+func (l *Location) Slot() string {
+	part := l.PartLocation
+
+	switch {
+	case part.ServiceLabel != "":
+		return part.ServiceLabel
+	case part.LocationType != "" && part.LocationOrdinalValue != nil:
+		return fmt.Sprintf("%s %d", part.LocationType, *part.LocationOrdinalValue)
+	default:
+		return part.LocationType
+	}
+}
+
+type NetworkAdapter struct {
+	ID           string   `json:"Id"`
+	Name         string   `json:"Name"`
+	Manufacturer string   `json:"Manufacturer"`
+	Model        string   `json:"Model"`
+	Location     Location `json:"Location"`
+	Ports        Link     `json:"Ports"`
+	NetworkPorts Link     `json:"NetworkPorts"`
+	Controllers  []struct {
+		Location Location `json:"Location"`
+	} `json:"Controllers"`
+	Status Status `json:"Status"`
+}
+
+// Port replaced NetworkPort in Redfish 2021.2, so older BMCs only have the
+// latter
+
+type Port struct {
+	ID               string   `json:"Id"`
+	LinkStatus       string   `json:"LinkStatus"`
+	CurrentSpeedGbps *float64 `json:"CurrentSpeedGbps"`
+	Ethernet         struct {
+		AssociatedMACAddresses []string `json:"AssociatedMACAddresses"`
+	} `json:"Ethernet"`
+	Status Status `json:"Status"`
+}
+
+type NetworkPort struct {
+	ID                         string   `json:"Id"`
+	LinkStatus                 string   `json:"LinkStatus"`
+	CurrentLinkSpeedMbps       int      `json:"CurrentLinkSpeedMbps"`
+	AssociatedNetworkAddresses []string `json:"AssociatedNetworkAddresses"`
+	Status                     Status   `json:"Status"`
+}
+
+// portLinkStatus writes the link status of either kind of port the way
+// EthernetInterfaces do
+func portLinkStatus(status string) string {
+	switch status {
+	case "Up", "LinkUp":
+		return "LinkUp"
+	case "Down", "LinkDown", "NoLink":
+		return "LinkDown"
+	default:
+		return status
+	}
+}
+
+// inventoryPorts reads the ports of every network adapter. BMCs that don't
+// have NetworkAdapters get a port for each interface instead. An adapter
+// that can't be read is left out and noted in PortErrors, rather than
+// failing the whole inventory.
+func (c *Client) inventoryPorts(inv *Inventory) error {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return err
+	}
+
+	if root.Chassis.ODataID != "" {
+		err := c.Members(root.Chassis.ODataID, func(path string) error {
+			var chassis Chassis
+
+			if err := c.Get(path, &chassis); err != nil {
+				return err
+			}
+
+			if chassis.NetworkAdapters.ODataID == "" {
+				return nil
+			}
+
+			return c.Members(chassis.NetworkAdapters.ODataID, func(path string) error {
+				var adapter NetworkAdapter
+
+				if err := c.Get(path, &adapter); err != nil {
+					inv.PortErrors = append(inv.PortErrors, fmt.Errorf("%s: %w", path, err))
+					return nil
+				}
+
+				if adapter.Status.Absent() {
+					return nil
+				}
+
+				if err := c.adapterPorts(&adapter, inv); err != nil {
+					inv.PortErrors = append(inv.PortErrors, fmt.Errorf("%s: %w", path, err))
+				}
+
+				return nil
+			})
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// Adapters that failed still exist, so their interfaces aren't ports
+	if len(inv.Ports) > 0 || len(inv.PortErrors) > 0 {
+		return nil
+	}
+
+	for _, nic := range inv.Interfaces {
+		mac := nic.PermanentMACAddress
+
+		if mac == "" {
+			mac = nic.MACAddress
+		}
+
+		adapter := nic.Description
+
+		if adapter == "" {
+			adapter = nic.Name
+		}
+
+		inv.Ports = append(inv.Ports, NICPort{
+			ID:         nic.ID,
+			Adapter:    adapter,
+			MACAddress: mac,
+			LinkStatus: nic.LinkStatus,
+			SpeedMbps:  nic.SpeedMbps,
+		})
+	}
+
+	return nil
+}
+
+func (c *Client) adapterPorts(adapter *NetworkAdapter, inv *Inventory) error {
+	name := strings.TrimSpace(adapter.Manufacturer + " " + adapter.Model)
+
+	if name == "" {
+		name = adapter.Name
+	}
+
+	slot := adapter.Location.Slot()
+
+	for i := 0; slot == "" && i < len(adapter.Controllers); i++ {
+		slot = adapter.Controllers[i].Location.Slot()
+	}
+
+	// Port IDs are often only unique within their adapter
+	port := func(id string) NICPort {
+		if !strings.HasPrefix(id, adapter.ID) {
+			id = adapter.ID + "-" + id
+		}
+
+		return NICPort{ID: id, Adapter: name, Slot: slot}
+	}
+
+	if adapter.Ports.ODataID != "" {
+		return c.Members(adapter.Ports.ODataID, func(path string) error {
+			var p Port
+
+			if err := c.Get(path, &p); err != nil {
+				return err
+			}
+
+			nic := port(p.ID)
+			nic.LinkStatus = portLinkStatus(p.LinkStatus)
+
+			if len(p.Ethernet.AssociatedMACAddresses) > 0 {
+				nic.MACAddress = p.Ethernet.AssociatedMACAddresses[0]
+			}
+
+			if p.CurrentSpeedGbps != nil {
+				nic.SpeedMbps = int(*p.CurrentSpeedGbps * 1000)
+			}
+
+			inv.Ports = append(inv.Ports, nic)
+			return nil
+		})
+	}
+
+	if adapter.NetworkPorts.ODataID != "" {
+		return c.Members(adapter.NetworkPorts.ODataID, func(path string) error {
+			var p NetworkPort
+
+			if err := c.Get(path, &p); err != nil {
+				return err
+			}
+
+			nic := port(p.ID)
+			nic.LinkStatus = portLinkStatus(p.LinkStatus)
+			nic.SpeedMbps = p.CurrentLinkSpeedMbps
+
+			if len(p.AssociatedNetworkAddresses) > 0 {
+				nic.MACAddress = p.AssociatedNetworkAddresses[0]
+			}
+
+			inv.Ports = append(inv.Ports, nic)
+			return nil
+		})
+	}
+
+	return nil
+}
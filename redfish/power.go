@@ -0,0 +1,110 @@
+package redfish
+
+import (
+	"errors"
+	"slices"
+)
+
+var ErrPowerActionUnsupported = errors.New("bmc does not support this power action")
+
+// PowerActions maps the actions offered to users onto Redfish reset types,
+// in order of preference
+var PowerActions = map[string][]string{
+	"on":       {"On"},
+	"off":      {"ForceOff"},
+	"shutdown": {"GracefulShutdown"},
+	"restart":  {"GracefulRestart"},
+	"reset":    {"ForceRestart", "PowerCycle"},
+}
+
+type PowerStatus struct {
+	PowerState string   `json:"power_state"`
+	Actions    []string `json:"actions"`
+}
+
+// ResetTypes returns the reset types the system accepts. BMCs either list
+// them on the action itself or in a separate ActionInfo resource.
+func (c *Client) ResetTypes(system *ComputerSystem) ([]string, error) {
+	reset := system.Actions.Reset
+
+	if len(reset.AllowableValues) > 0 || reset.ActionInfo == "" {
+		return reset.AllowableValues, nil
+	}
+
+	var info ActionInfo
+
+	if err := c.Get(reset.ActionInfo, &info); err != nil {
+		return nil, err
+	}
+
+	for _, param := range info.Parameters {
+		if param.Name == "ResetType" {
+			return param.AllowableValues, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *Client) PowerStatus() (*PowerStatus, error) {
+	system, err := c.System()
+
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := c.ResetTypes(system)
+
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PowerStatus{PowerState: system.PowerState, Actions: []string{}}
+
+	for action := range PowerActions {
+		if resetTypeFor(action, allowed) != "" {
+			status.Actions = append(status.Actions, action)
+		}
+	}
+
+	slices.Sort(status.Actions)
+	return status, nil
+}
+
+// Power performs one of the PowerActions and returns the reset type used
+func (c *Client) Power(action string) (string, error) {
+	system, err := c.System()
+
+	if err != nil {
+		return "", err
+	}
+
+	if system.Actions.Reset.Target == "" {
+		return "", ErrPowerActionUnsupported
+	}
+
+	allowed, err := c.ResetTypes(system)
+
+	if err != nil {
+		return "", err
+	}
+
+	resetType := resetTypeFor(action, allowed)
+
+	if resetType == "" {
+		return "", ErrPowerActionUnsupported
+	}
+
+	return resetType, c.Post(system.Actions.Reset.Target, map[string]string{"ResetType": resetType}, nil)
+}
+
+// A BMC that doesn't advertise its reset types gets the preferred one
+func resetTypeFor(action string, allowed []string) string {
+	for _, resetType := range PowerActions[action] {
+		if len(allowed) == 0 || slices.Contains(allowed, resetType) {
+			return resetType
+		}
+	}
+
+	return ""
+}
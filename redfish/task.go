@@ -0,0 +1,107 @@
+package redfish
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var ErrNoTask = errors.New("bmc accepted the request but did not say where its task is")
+
+// Task states that mean the task has finished, one way or another
+const (
+	TaskCompleted = "Completed"
+	TaskKilled    = "Killed"
+	TaskException = "Exception"
+	TaskCancelled = "Cancelled"
+)
+
+// Task is a long running operation, such as a firmware update, that the BMC
+// carries out after accepting the request for it
+type Task struct {
+	ODataID         string    `json:"@odata.id"`
+	ID              string    `json:"Id"`
+	Name            string    `json:"Name"`
+	TaskState       string    `json:"TaskState"`
+	TaskStatus      string    `json:"TaskStatus"`
+	PercentComplete *int      `json:"PercentComplete"`
+	Messages        []Message `json:"Messages"`
+}
+
+type Message struct {
+	Message   string `json:"Message"`
+	MessageID string `json:"MessageId"`
+	Severity  string `json:"Severity"`
+}
+
+func (t *Task) Done() bool {
+	switch t.TaskState {
+	case TaskCompleted, TaskKilled, TaskException, TaskCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Failed is only meaningful once the task is done. Some BMCs complete tasks
+// that went wrong and only say so in TaskStatus.
+func (t *Task) Failed() bool {
+	return t.TaskState != TaskCompleted || t.TaskStatus == HealthCritical
+}
+
+// Message is the task's latest message, which is usually what it is doing
+// or why it failed
+func (t *Task) Message() string {
+	if len(t.Messages) == 0 {
+		return t.TaskState
+	}
+
+	return t.Messages[len(t.Messages)-1].Message
+}
+
+func (c *Client) Task(path string) (*Task, error) {
+	var task Task
+
+	if err := c.Get(path, &task); err != nil {
+		return nil, err
+	}
+
+	// A task monitor that is done answers with the operation's result
+	// instead of the task
+	if task.TaskState == "" {
+		task.TaskState = TaskCompleted
+	}
+
+	return &task, nil
+}
+
+// startTask posts body to an action that runs as a task and returns where
+// the task can be followed. Empty means the BMC finished without one.
+func (c *Client) startTask(target string, body interface{}) (string, error) {
+	res, err := c.do("POST", target, body)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	// The task is in the body, or at the Location header
+	var task Task
+
+	if err := json.NewDecoder(res.Body).Decode(&task); err == nil && task.ODataID != "" && strings.Contains(task.ODataID, "/Task") {
+		return task.ODataID, nil
+	}
+
+	if location, err := url.Parse(res.Header.Get("Location")); err == nil && location.Path != "" {
+		return location.Path, nil
+	}
+
+	if res.StatusCode == http.StatusAccepted {
+		return "", ErrNoTask
+	}
+
+	return "", nil
+}
@@ -0,0 +1,297 @@
+package redfish
+
+import "strings"
+
+const (
+	MetricTemperature = "temperature"
+	MetricFan         = "fan"
+	MetricPower       = "power"
+)
+
+// Reading is a single sensor value. Metric groups sensors of the same kind
+// so that they can be charted together.
+type Reading struct {
+	Metric string
+	Sensor string
+	Unit   string
+	Value  float64
+}
+
+type Chassis struct {
+	ID               string `json:"Id"`
+	Name             string `json:"Name"`
+	Thermal          Link   `json:"Thermal"`
+	Power            Link   `json:"Power"`
+	ThermalSubsystem Link   `json:"ThermalSubsystem"`
+	PowerSubsystem   Link   `json:"PowerSubsystem"`
+	NetworkAdapters  Link   `json:"NetworkAdapters"`
+}
+
+// Thermal and Power are deprecated in favour of the subsystems, but are all
+// that BMCs before Redfish 2020.4 have
+
+type Thermal struct {
+	Temperatures []struct {
+		MemberID       string   `json:"MemberId"`
+		Name           string   `json:"Name"`
+		ReadingCelsius *float64 `json:"ReadingCelsius"`
+		Status         Status   `json:"Status"`
+	} `json:"Temperatures"`
+	Fans []struct {
+		MemberID     string   `json:"MemberId"`
+		Name         string   `json:"Name"`
+		Reading      *float64 `json:"Reading"`
+		ReadingUnits string   `json:"ReadingUnits"`
+		Status       Status   `json:"Status"`
+	} `json:"Fans"`
+}
+
+type Power struct {
+	PowerControl []struct {
+		MemberID           string   `json:"MemberId"`
+		Name               string   `json:"Name"`
+		PowerConsumedWatts *float64 `json:"PowerConsumedWatts"`
+	} `json:"PowerControl"`
+	PowerSupplies []struct {
+		MemberID        string   `json:"MemberId"`
+		Name            string   `json:"Name"`
+		PowerInputWatts *float64 `json:"PowerInputWatts"`
+		Status          Status   `json:"Status"`
+	} `json:"PowerSupplies"`
+}
+
+type SensorReading struct {
+	DataSourceURI string   `json:"DataSourceUri"`
+	DeviceName    string   `json:"DeviceName"`
+	Reading       *float64 `json:"Reading"`
+}
+
+type ThermalSubsystem struct {
+	ThermalMetrics Link `json:"ThermalMetrics"`
+	Fans           Link `json:"Fans"`
+}
+
+type ThermalMetrics struct {
+	TemperatureReadingsCelsius []SensorReading `json:"TemperatureReadingsCelsius"`
+}
+
+type Fan struct {
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	Status       Status `json:"Status"`
+	SpeedPercent struct {
+		Reading  *float64 `json:"Reading"`
+		SpeedRPM *float64 `json:"SpeedRPM"`
+	} `json:"SpeedPercent"`
+}
+
+type PowerSubsystem struct {
+	PowerSupplies Link `json:"PowerSupplies"`
+}
+
+type PowerSupply struct {
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Status  Status `json:"Status"`
+	Metrics Link   `json:"Metrics"`
+}
+
+type PowerSupplyMetrics struct {
+	InputPowerWatts struct {
+		Reading *float64 `json:"Reading"`
+	} `json:"InputPowerWatts"`
+}
+
+// Telemetry reads the temperature, fan and power sensors of every chassis.
+// The newer subsystems are used when a chassis has them.
+func (c *Client) Telemetry() ([]Reading, error) {
+	root, err := c.ServiceRoot()
+
+	if err != nil {
+		return nil, err
+	}
+
+	readings := []Reading{}
+
+	if root.Chassis.ODataID == "" {
+		return readings, nil
+	}
+
+	err = c.Members(root.Chassis.ODataID, func(path string) error {
+		var chassis Chassis
+
+		if err := c.Get(path, &chassis); err != nil {
+			return err
+		}
+
+		var err error
+
+		switch {
+		case chassis.ThermalSubsystem.ODataID != "":
+			err = c.thermalSubsystem(chassis.ThermalSubsystem.ODataID, &readings)
+		case chassis.Thermal.ODataID != "":
+			err = c.thermal(chassis.Thermal.ODataID, &readings)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case chassis.PowerSubsystem.ODataID != "":
+			err = c.powerSubsystem(chassis.PowerSubsystem.ODataID, &readings)
+		case chassis.Power.ODataID != "":
+			err = c.power(chassis.Power.ODataID, &readings)
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return readings, nil
+}
+
+func (c *Client) thermal(path string, readings *[]Reading) error {
+	var thermal Thermal
+
+	if err := c.Get(path, &thermal); err != nil {
+		return err
+	}
+
+	for _, temp := range thermal.Temperatures {
+		if temp.ReadingCelsius != nil && !temp.Status.Absent() {
+			*readings = append(*readings, Reading{MetricTemperature, sensorName(temp.Name, temp.MemberID), "Cel", *temp.ReadingCelsius})
+		}
+	}
+
+	for _, fan := range thermal.Fans {
+		if fan.Reading == nil || fan.Status.Absent() {
+			continue
+		}
+
+		unit := "RPM"
+
+		if fan.ReadingUnits == "Percent" {
+			unit = "%"
+		}
+
+		*readings = append(*readings, Reading{MetricFan, sensorName(fan.Name, fan.MemberID), unit, *fan.Reading})
+	}
+
+	return nil
+}
+
+func (c *Client) power(path string, readings *[]Reading) error {
+	var power Power
+
+	if err := c.Get(path, &power); err != nil {
+		return err
+	}
+
+	for _, control := range power.PowerControl {
+		if control.PowerConsumedWatts != nil {
+			*readings = append(*readings, Reading{MetricPower, sensorName(control.Name, control.MemberID), "W", *control.PowerConsumedWatts})
+		}
+	}
+
+	for _, supply := range power.PowerSupplies {
+		if supply.PowerInputWatts != nil && !supply.Status.Absent() {
+			*readings = append(*readings, Reading{MetricPower, sensorName(supply.Name, supply.MemberID), "W", *supply.PowerInputWatts})
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) thermalSubsystem(path string, readings *[]Reading) error {
+	var subsystem ThermalSubsystem
+
+	if err := c.Get(path, &subsystem); err != nil {
+		return err
+	}
+
+	if subsystem.ThermalMetrics.ODataID != "" {
+		var metrics ThermalMetrics
+
+		if err := c.Get(subsystem.ThermalMetrics.ODataID, &metrics); err != nil {
+			return err
+		}
+
+		for _, temp := range metrics.TemperatureReadingsCelsius {
+			if temp.Reading != nil {
+				*readings = append(*readings, Reading{MetricTemperature, sensorName(temp.DeviceName, temp.DataSourceURI), "Cel", *temp.Reading})
+			}
+		}
+	}
+
+	if subsystem.Fans.ODataID == "" {
+		return nil
+	}
+
+	return c.Members(subsystem.Fans.ODataID, func(path string) error {
+		var fan Fan
+
+		if err := c.Get(path, &fan); err != nil {
+			return err
+		}
+
+		switch {
+		case fan.Status.Absent():
+		case fan.SpeedPercent.SpeedRPM != nil:
+			*readings = append(*readings, Reading{MetricFan, sensorName(fan.Name, fan.ID), "RPM", *fan.SpeedPercent.SpeedRPM})
+		case fan.SpeedPercent.Reading != nil:
+			*readings = append(*readings, Reading{MetricFan, sensorName(fan.Name, fan.ID), "%", *fan.SpeedPercent.Reading})
+		}
+
+		return nil
+	})
+}
+
+func (c *Client) powerSubsystem(path string, readings *[]Reading) error {
+	var subsystem PowerSubsystem
+
+	if err := c.Get(path, &subsystem); err != nil {
+		return err
+	}
+
+	if subsystem.PowerSupplies.ODataID == "" {
+		return nil
+	}
+
+	return c.Members(subsystem.PowerSupplies.ODataID, func(path string) error {
+		var supply PowerSupply
+
+		if err := c.Get(path, &supply); err != nil {
+			return err
+		}
+
+		if supply.Status.Absent() || supply.Metrics.ODataID == "" {
+			return nil
+		}
+
+		var metrics PowerSupplyMetrics
+
+		if err := c.Get(supply.Metrics.ODataID, &metrics); err != nil {
+			return err
+		}
+
+		if metrics.InputPowerWatts.Reading != nil {
+			*readings = append(*readings, Reading{MetricPower, sensorName(supply.Name, supply.ID), "W", *metrics.InputPowerWatts.Reading})
+		}
+
+		return nil
+	})
+}
+
+// sensorName falls back to the last part of an ID or URI for sensors
+// without a name
+func sensorName(name, id string) string {
+	if name != "" {
+		return name
+	}
+
+	return id[strings.LastIndex(id, "/")+1:]
+}
@@ -0,0 +1,133 @@
+package redfish
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testChassisPath = "/redfish/v1/Chassis/System.Embedded.1"
+
+// linkChassis points the chassis of a recorded BMC at the given resources
+func linkChassis(t *testing.T, resources map[string]json.RawMessage, links map[string]string) {
+	t.Helper()
+
+	var chassis map[string]interface{}
+
+	if err := json.Unmarshal(resources[testChassisPath], &chassis); err != nil {
+		t.Fatal(err)
+	}
+
+	for property, path := range links {
+		chassis[property] = map[string]string{"@odata.id": path}
+	}
+
+	data, err := json.Marshal(chassis)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resources[testChassisPath] = data
+}
+
+// BMCs before Redfish 2020.4 only have the Thermal and Power resources.
+// Absent sensors are left out, and sensors without a name go by their ID.
+func TestTelemetryLegacy(t *testing.T) {
+	resources := loadFixture(t, "idrac9")
+
+	linkChassis(t, resources, map[string]string{"Thermal": testChassisPath + "/Thermal", "Power": testChassisPath + "/Power"})
+
+	resources[testChassisPath+"/Thermal"] = json.RawMessage(`{
+		"Temperatures": [
+			{"MemberId": "iDRAC.Embedded.1#SystemBoardInletTemp", "Name": "System Board Inlet Temp", "ReadingCelsius": 21, "Status": {"State": "Enabled"}},
+			{"MemberId": "iDRAC.Embedded.1#CPU2Temp", "Name": "CPU2 Temp", "ReadingCelsius": null, "Status": {"State": "Absent"}}
+		],
+		"Fans": [
+			{"MemberId": "0x17||Fan.Embedded.1A", "Name": "System Board Fan1A", "Reading": 5880, "ReadingUnits": "RPM", "Status": {"State": "Enabled"}},
+			{"MemberId": "Fan.Embedded.2", "Reading": 40, "ReadingUnits": "Percent", "Status": {"State": "Enabled"}}
+		]
+	}`)
+
+	resources[testChassisPath+"/Power"] = json.RawMessage(`{
+		"PowerControl": [
+			{"MemberId": "PowerControl", "Name": "System Power Control", "PowerConsumedWatts": 196}
+		],
+		"PowerSupplies": [
+			{"MemberId": "PSU.Slot.1", "Name": "PS1 Status", "PowerInputWatts": 210, "Status": {"State": "Enabled"}},
+			{"MemberId": "PSU.Slot.2", "Name": "PS2 Status", "PowerInputWatts": 0, "Status": {"State": "Absent"}}
+		]
+	}`)
+
+	_, client := serveFixture(t, resources)
+	readings, err := client.Telemetry()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Reading{
+		{MetricTemperature, "System Board Inlet Temp", "Cel", 21},
+		{MetricFan, "System Board Fan1A", "RPM", 5880},
+		{MetricFan, "Fan.Embedded.2", "%", 40},
+		{MetricPower, "System Power Control", "W", 196},
+		{MetricPower, "PS1 Status", "W", 210},
+	}
+
+	if !reflect.DeepEqual(readings, want) {
+		t.Errorf("readings = %+v, want %+v", readings, want)
+	}
+}
+
+// The subsystems are read instead of Thermal and Power when a chassis has
+// both
+func TestTelemetrySubsystems(t *testing.T) {
+	const (
+		thermal = testChassisPath + "/ThermalSubsystem"
+		power   = testChassisPath + "/PowerSubsystem"
+	)
+
+	resources := loadFixture(t, "idrac9")
+
+	// Thermal and Power are missing, so reading them would fail
+	linkChassis(t, resources, map[string]string{
+		"Thermal":          testChassisPath + "/Thermal",
+		"Power":            testChassisPath + "/Power",
+		"ThermalSubsystem": thermal,
+		"PowerSubsystem":   power,
+	})
+
+	resources[thermal] = json.RawMessage(`{"ThermalMetrics": {"@odata.id": "` + thermal + `/ThermalMetrics"}, "Fans": {"@odata.id": "` + thermal + `/Fans"}}`)
+	resources[thermal+"/ThermalMetrics"] = json.RawMessage(`{"TemperatureReadingsCelsius": [
+		{"DataSourceUri": "` + testChassisPath + `/Sensors/CPU1Temp", "Reading": 45},
+		{"DataSourceUri": "` + testChassisPath + `/Sensors/CPU2Temp", "DeviceName": "CPU 2", "Reading": null}
+	]}`)
+	resources[thermal+"/Fans"] = json.RawMessage(`{"Members": [{"@odata.id": "` + thermal + `/Fans/Fan1"}, {"@odata.id": "` + thermal + `/Fans/Fan2"}, {"@odata.id": "` + thermal + `/Fans/Fan3"}]}`)
+	resources[thermal+"/Fans/Fan1"] = json.RawMessage(`{"Id": "Fan1", "Name": "Fan 1", "SpeedPercent": {"Reading": 30, "SpeedRPM": 6000}}`)
+	resources[thermal+"/Fans/Fan2"] = json.RawMessage(`{"Id": "Fan2", "Name": "Fan 2", "SpeedPercent": {"Reading": 35}}`)
+	resources[thermal+"/Fans/Fan3"] = json.RawMessage(`{"Id": "Fan3", "Name": "Fan 3", "Status": {"State": "Absent"}}`)
+
+	resources[power] = json.RawMessage(`{"PowerSupplies": {"@odata.id": "` + power + `/PowerSupplies"}}`)
+	resources[power+"/PowerSupplies"] = json.RawMessage(`{"Members": [{"@odata.id": "` + power + `/PowerSupplies/PSU1"}, {"@odata.id": "` + power + `/PowerSupplies/PSU2"}]}`)
+	resources[power+"/PowerSupplies/PSU1"] = json.RawMessage(`{"Id": "PSU1", "Name": "PSU 1", "Metrics": {"@odata.id": "` + power + `/PowerSupplies/PSU1/Metrics"}}`)
+	resources[power+"/PowerSupplies/PSU1/Metrics"] = json.RawMessage(`{"InputPowerWatts": {"Reading": 230}}`)
+	resources[power+"/PowerSupplies/PSU2"] = json.RawMessage(`{"Id": "PSU2", "Name": "PSU 2", "Status": {"State": "Absent"}}`)
+
+	_, client := serveFixture(t, resources)
+	readings, err := client.Telemetry()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Reading{
+		{MetricTemperature, "CPU1Temp", "Cel", 45},
+		{MetricFan, "Fan 1", "RPM", 6000},
+		{MetricFan, "Fan 2", "%", 35},
+		{MetricPower, "PSU 1", "W", 230},
+	}
+
+	if !reflect.DeepEqual(readings, want) {
+		t.Errorf("readings = %+v, want %+v", readings, want)
+	}
+}
@@ -0,0 +1,102 @@
+package redfish
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrCertificateChanged   = errors.New("bmc certificate does not match the pinned one")
+	ErrCertificateUntrusted = errors.New("bmc certificate is not signed by a trusted ca")
+)
+
+// CertificateError is returned when the BMC's certificate is refused. It has
+// the fingerprint of the certificate so it can be accepted.
+type CertificateError struct {
+	Err         error
+	Fingerprint string
+}
+
+func (e *CertificateError) Error() string {
+	return e.Err.Error() + " (" + e.Fingerprint + ")"
+}
+
+func (e *CertificateError) Unwrap() error {
+	return e.Err
+}
+
+// Fingerprint is the SHA-256 of a certificate, written the way openssl
+// x509 -fingerprint -sha256 does so admins can compare them
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+
+	return strings.Join(parts, ":")
+}
+
+// ParseCABundle reads PEM certificates, failing if there are none
+func ParseCABundle(bundle string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+
+	if !pool.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, errors.New("no certificates in ca bundle")
+	}
+
+	return pool, nil
+}
+
+// verifyConnection replaces the usual checks, which BMCs' self-signed
+// certificates never pass. With trusted CAs the certificate has to be signed
+// by one of them. Host names aren't checked, since BMCs are reached by
+// address and rarely have it in their certificates. Otherwise it has to be
+// the pinned certificate, and with no pin anything is accepted so that it
+// can be pinned.
+func (c *Client) verifyConnection(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("bmc sent no certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	fingerprint := Fingerprint(leaf)
+
+	c.mu.Lock()
+	c.fingerprint = fingerprint
+	c.mu.Unlock()
+
+	if c.TrustedCAs != nil {
+		intermediates := x509.NewCertPool()
+
+		for _, cert := range state.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+
+		if _, err := leaf.Verify(x509.VerifyOptions{Roots: c.TrustedCAs, Intermediates: intermediates}); err != nil {
+			return &CertificateError{ErrCertificateUntrusted, fingerprint}
+		}
+
+		return nil
+	}
+
+	if c.PinnedFingerprint != "" && fingerprint != c.PinnedFingerprint {
+		return &CertificateError{ErrCertificateChanged, fingerprint}
+	}
+
+	return nil
+}
+
+// CertificateFingerprint is the fingerprint of the certificate the BMC last
+// presented, empty before the first request
+func (c *Client) CertificateFingerprint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.fingerprint
+}
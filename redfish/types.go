@@ -0,0 +1,201 @@
+package redfish
+
+import "encoding/json"
+
+type Link struct {
+	ODataID string `json:"@odata.id"`
+}
+
+type Collection struct {
+	Members []Link `json:"Members"`
+}
+
+const (
+	HealthOK       = "OK"
+	HealthWarning  = "Warning"
+	HealthCritical = "Critical"
+)
+
+type Status struct {
+	State        string      `json:"State"`
+	Health       string      `json:"Health"`
+	HealthRollup string      `json:"HealthRollup"`
+	Conditions   []Condition `json:"Conditions"`
+}
+
+type Condition struct {
+	Message   string `json:"Message"`
+	MessageID string `json:"MessageId"`
+	Severity  string `json:"Severity"`
+}
+
+// Absent components (empty sockets and DIMM slots) are listed by some BMCs
+func (s Status) Absent() bool {
+	return s.State == "Absent"
+}
+
+type ServiceRoot struct {
+	ID             string `json:"Id"`
+	Name           string `json:"Name"`
+	RedfishVersion string `json:"RedfishVersion"`
+	UUID           string `json:"UUID"`
+	Vendor         string `json:"Vendor"`
+	Product        string `json:"Product"`
+	Systems        Link   `json:"Systems"`
+	Chassis        Link   `json:"Chassis"`
+	Managers       Link   `json:"Managers"`
+	EventService   Link   `json:"EventService"`
+	UpdateService  Link   `json:"UpdateService"`
+
+	Oem map[string]json.RawMessage `json:"Oem"`
+}
+
+type Manager struct {
+	ODataID         string `json:"@odata.id"`
+	ID              string `json:"Id"`
+	Name            string `json:"Name"`
+	Model           string `json:"Model"`
+	FirmwareVersion string `json:"FirmwareVersion"`
+	ManagerType     string `json:"ManagerType"`
+	Status          Status `json:"Status"`
+	LogServices     Link   `json:"LogServices"`
+	VirtualMedia    Link   `json:"VirtualMedia"`
+	NetworkProtocol Link   `json:"NetworkProtocol"`
+	SerialConsole   struct {
+		ServiceEnabled        bool     `json:"ServiceEnabled"`
+		ConnectTypesSupported []string `json:"ConnectTypesSupported"`
+	} `json:"SerialConsole"`
+}
+
+type ComputerSystem struct {
+	ODataID            string `json:"@odata.id"`
+	ID                 string `json:"Id"`
+	Name               string `json:"Name"`
+	Manufacturer       string `json:"Manufacturer"`
+	Model              string `json:"Model"`
+	SerialNumber       string `json:"SerialNumber"`
+	PowerState         string `json:"PowerState"`
+	Status             Status `json:"Status"`
+	Processors         Link   `json:"Processors"`
+	Memory             Link   `json:"Memory"`
+	Storage            Link   `json:"Storage"`
+	SimpleStorage      Link   `json:"SimpleStorage"`
+	EthernetInterfaces Link   `json:"EthernetInterfaces"`
+	LogServices        Link   `json:"LogServices"`
+	VirtualMedia       Link   `json:"VirtualMedia"`
+	Bios               Link   `json:"Bios"`
+	Boot               Boot   `json:"Boot"`
+	Actions            struct {
+		Reset ResetAction `json:"#ComputerSystem.Reset"`
+	} `json:"Actions"`
+}
+
+type ResetAction struct {
+	Target          string   `json:"target"`
+	AllowableValues []string `json:"ResetType@Redfish.AllowableValues"`
+	ActionInfo      string   `json:"@Redfish.ActionInfo"`
+}
+
+type ActionInfo struct {
+	Parameters []struct {
+		Name            string   `json:"Name"`
+		AllowableValues []string `json:"AllowableValues"`
+	} `json:"Parameters"`
+}
+
+type Processor struct {
+	ID            string `json:"Id"`
+	Name          string `json:"Name"`
+	ProcessorType string `json:"ProcessorType"`
+	Model         string `json:"Model"`
+	MaxSpeedMHz   int    `json:"MaxSpeedMHz"`
+	TotalCores    int    `json:"TotalCores"`
+	TotalThreads  int    `json:"TotalThreads"`
+	Status        Status `json:"Status"`
+}
+
+type Memory struct {
+	ID                string `json:"Id"`
+	Name              string `json:"Name"`
+	CapacityMiB       int    `json:"CapacityMiB"`
+	OperatingSpeedMhz int    `json:"OperatingSpeedMhz"`
+	Status            Status `json:"Status"`
+}
+
+type Storage struct {
+	ID                 string              `json:"Id"`
+	Name               string              `json:"Name"`
+	Drives             []Link              `json:"Drives"`
+	Volumes            Link                `json:"Volumes"`
+	StorageControllers []StorageController `json:"StorageControllers"`
+	Status             Status              `json:"Status"`
+}
+
+type StorageController struct {
+	MemberID        string `json:"MemberId"`
+	Name            string `json:"Name"`
+	Model           string `json:"Model"`
+	FirmwareVersion string `json:"FirmwareVersion"`
+	Status          Status `json:"Status"`
+
+	// The ID of the Storage the controller was found under, which isn't
+	// part of the resource
+	Storage string `json:"-"`
+}
+
+type Drive struct {
+	ID                            string   `json:"Id"`
+	Name                          string   `json:"Name"`
+	Manufacturer                  string   `json:"Manufacturer"`
+	Model                         string   `json:"Model"`
+	SerialNumber                  string   `json:"SerialNumber"`
+	MediaType                     string   `json:"MediaType"`
+	Protocol                      string   `json:"Protocol"`
+	CapacityBytes                 int64    `json:"CapacityBytes"`
+	PredictedMediaLifeLeftPercent *float64 `json:"PredictedMediaLifeLeftPercent"`
+	FailurePredicted              bool     `json:"FailurePredicted"`
+	Status                        Status   `json:"Status"`
+
+	// The ID of the Storage the drive was found under
+	Storage string `json:"-"`
+}
+
+type Volume struct {
+	ID            string `json:"Id"`
+	Name          string `json:"Name"`
+	VolumeType    string `json:"VolumeType"`
+	RAIDType      string `json:"RAIDType"`
+	CapacityBytes int64  `json:"CapacityBytes"`
+	Links         struct {
+		Drives []Link `json:"Drives"`
+	} `json:"Links"`
+	Status Status `json:"Status"`
+
+	// The ID of the Storage the volume was found under
+	Storage string `json:"-"`
+}
+
+// SimpleStorage is all that older iDRAC 7/8 firmware exposes
+type SimpleStorage struct {
+	ID      string `json:"Id"`
+	Name    string `json:"Name"`
+	Devices []struct {
+		Name          string `json:"Name"`
+		Manufacturer  string `json:"Manufacturer"`
+		Model         string `json:"Model"`
+		CapacityBytes int64  `json:"CapacityBytes"`
+		Status        Status `json:"Status"`
+	} `json:"Devices"`
+	Status Status `json:"Status"`
+}
+
+type EthernetInterface struct {
+	ID                  string `json:"Id"`
+	Name                string `json:"Name"`
+	Description         string `json:"Description"`
+	MACAddress          string `json:"MACAddress"`
+	PermanentMACAddress string `json:"PermanentMACAddress"`
+	SpeedMbps           int    `json:"SpeedMbps"`
+	LinkStatus          string `json:"LinkStatus"`
+	Status              Status `json:"Status"`
+}